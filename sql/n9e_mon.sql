@@ -97,7 +97,7 @@ create table `event_cur` (
   `endpoint` varchar(255) not null default '' comment 'endpoint',
   `endpoint_alias` varchar(255) not null default '' comment 'endpoint alias',
   `priority` tinyint(4) not null default 2 comment '优先级',
-  `event_type` varchar(45) not null default '' comment 'alert|recovery',
+  `event_type` varchar(45) not null default '' comment 'alert|recovery|flapping',
   `category` tinyint(4) not null default 2 comment '1阈值 2智能',
   `status` int(10) not null default 0 comment 'event status',
   `detail` text comment 'counter points pred_points 详情',
@@ -128,7 +128,7 @@ create table `event` (
   `endpoint` varchar(255) not null default '' comment 'endpoint',
   `endpoint_alias` varchar(255) not null default '' comment 'endpoint alias',
   `priority` tinyint(4) not null default 2 comment '优先级',
-  `event_type` varchar(45) not null default '' comment 'alert|recovery',
+  `event_type` varchar(45) not null default '' comment 'alert|recovery|flapping',
   `category` tinyint(4) not null default 2 comment '1阈值 2智能',
   `status` int(10) not null default 0 comment 'event status',
   `detail` text comment 'counter points pred_points 详情',
@@ -160,6 +160,7 @@ CREATE TABLE `stra` (
   `alert_dur` int(4) NOT NULL COMMENT '单位秒，持续异常n秒则产生异常event',
   `recovery_dur` int(4) NOT NULL DEFAULT 0 COMMENT '单位秒，持续正常n秒则产生恢复event，0表示立即产生恢复event',
   `exprs` varchar(1024) NOT NULL DEFAULT '' COMMENT '规则表达式',
+  `exprs_logic` varchar(255) NOT NULL DEFAULT '' COMMENT '规则表达式之间的布尔组合，为空表示同时满足',
   `tags` varchar(1024) DEFAULT '' COMMENT 'tags过滤',
   `enable_stime` varchar(6)  NOT NULL DEFAULT '00:00' COMMENT '策略生效开始时间',
   `enable_etime` varchar(6)  NOT NULL DEFAULT '23:59' COMMENT '策略生效终止时间',
@@ -176,6 +177,8 @@ CREATE TABLE `stra` (
   `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
   `need_upgrade` int(2)  not null default 0 comment 'need upgrade',
   `alert_upgrade` text comment 'alert upgrade',
+  `inhibit` varchar(1024) NOT NULL DEFAULT '[]' COMMENT '这些策略告警时抑制本策略的event',
+  `aggr` varchar(255) NOT NULL DEFAULT '{}' COMMENT '集群聚合配置，func为空表示单机策略',
   PRIMARY KEY (`id`),
   KEY `idx_nid` (`nid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
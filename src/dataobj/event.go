@@ -4,7 +4,7 @@ package dataobj
 type Event struct {
 	ID        string    `json:"-"`
 	Sid       int64     `json:"sid"`
-	EventType string    `json:"event_type"` // alert/recover
+	EventType string    `json:"event_type"` // alert/recovery/flapping
 	Hashid    uint64    `json:"hashid"`     // 全局唯一 根据counter计算
 	Etime     int64     `json:"etime"`
 	Endpoint  string    `json:"endpoint"`
@@ -16,9 +16,11 @@ type Event struct {
 }
 
 type History struct {
-	Key         string            `json:"-"`              // 用于计算event的hashid
-	Metric      string            `json:"metric"`         // 指标名
-	Tags        map[string]string `json:"tags,omitempty"` // endpoint/counter
-	Granularity int               `json:"-"`              // alarm补齐数据时需要
-	Points      []*RRDData        `json:"points"`         // 现场值
+	Key         string            `json:"-"`                     // 用于计算event的hashid
+	Metric      string            `json:"metric"`                // 指标名
+	Tags        map[string]string `json:"tags,omitempty"`        // endpoint/counter
+	Granularity int               `json:"-"`                     // alarm补齐数据时需要
+	Points      []*RRDData        `json:"points"`                // 现场值
+	PredPoints  []*RRDData        `json:"pred_points,omitempty"` // 预测值
+	Comparison  int64             `json:"comparison,omitempty"`  // 同比窗口相对现场的时间偏移，单位秒
 }
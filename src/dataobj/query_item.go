@@ -24,9 +24,12 @@ type QueryDataForUI struct {
 	Comparisons []int64  `json:"comparisons"` //环比多少时间
 }
 
+// QueryDataResp Partial为true时触发了transfer的查询限制，Data只是部分数据，Limits中是触发的限制
 type QueryDataResp struct {
-	Data []*TsdbQueryResponse
-	Msg  string
+	Data    []*TsdbQueryResponse
+	Msg     string
+	Partial bool
+	Limits  []string
 }
 
 // judge 数据层 必须
@@ -22,6 +22,7 @@ type Stra struct {
 	LastUpdated      string       `json:"last_updated"`
 	ExclNid          []int64      `json:"excl_nid"`
 	Exprs            []Exp        `json:"exprs"`
+	ExprsLogic       string       `json:"exprs_logic"`
 	Tags             []Tag        `json:"tags"`
 	EnableDaysOfWeek []int        `json:"enable_days_of_week"`
 	Converge         []int        `json:"converge"`
@@ -35,7 +36,7 @@ type Stra struct {
 
 type Exp struct {
 	Eopt      string  `json:"eopt"`
-	Func      string  `json:"func"`
+	Func      string  `json:"func"` // all,max,min,sum,avg,diff,pdiff,happen,nodata,c_avg*,stddev,zscore,pN
 	Metric    string  `json:"metric"`
 	Params    []int   `json:"params"`
 	Threshold float64 `json:"threshold"`
@@ -53,4 +54,3 @@ type AlertUpgrade struct {
 	Duration int     `json:"duration"`
 	Level    int     `json:"level"`
 }
-
@@ -15,7 +15,7 @@ type Event struct {
 	Endpoint      string    `json:"endpoint"`
 	EndpointAlias string    `json:"endpoint_alias"`
 	Priority      int       `json:"priority"`
-	EventType     string    `json:"event_type"` // alert|recovery
+	EventType     string    `json:"event_type"` // alert|recovery|flapping
 	Category      int       `json:"category"`
 	Status        uint16    `json:"status"`
 	HashId        uint64    `json:"hashid"  xorm:"hashid"`
@@ -36,6 +36,7 @@ type EventDetail struct {
 	Tags       map[string]string   `json:"tags"`
 	Points     []*EventDetailPoint `json:"points"`
 	PredPoints []*EventDetailPoint `json:"pred_points,omitempty"` // 预测值, 预测值不为空时, 现场值对应的是实际值
+	Comparison int64               `json:"comparison,omitempty"`  // 同比窗口相对现场的时间偏移, 单位秒
 }
 
 type EventDetailPoint struct {
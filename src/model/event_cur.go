@@ -20,7 +20,7 @@ type EventCur struct {
 	Endpoint      string    `json:"endpoint"`
 	EndpointAlias string    `json:"endpoint_alias"`
 	Priority      int       `json:"priority"`
-	EventType     string    `json:"event_type"` // alert|recovery
+	EventType     string    `json:"event_type"` // alert|recovery|flapping
 	Category      int       `json:"category"`
 	Status        uint16    `json:"status"`
 	HashId        uint64    `json:"hashid"  xorm:"hashid"`
@@ -231,6 +231,13 @@ func EventCurGet(col string, value interface{}) (*EventCur, error) {
 	return &obj, nil
 }
 
+// EventCurGetsBySid 策略当前所有未恢复的event
+func EventCurGetsBySid(sid int64) ([]EventCur, error) {
+	var obj []EventCur
+	err := DB["mon"].Where("sid=?", sid).Cols("id", "sid", "endpoint", "nid", "hashid").Find(&obj)
+	return obj, err
+}
+
 func (e *EventCur) EventIgnore() error {
 	_, err := DB["mon"].Exec("update event_cur set ignore_alert=1 where id=?", e.Id)
 	return err
@@ -1,12 +1,14 @@
 package model
 
-// 0 0 0 0 0 0 处理中
-// 0 0 0 0 x 1 已发送
-// 0 0 0 0 1 x 已回调
-// 0 0 0 1 0 0 已屏蔽
-// 0 0 1 0 0 0 被收敛
-// 0 1 0 0 x 0 无接收人
-// 1 0 0 0 x 0 升级发送
+// 0 0 0 0 0 0 0 处理中
+// 0 0 0 0 0 x 1 已发送
+// 0 0 0 0 0 1 x 已回调
+// 0 0 0 0 1 0 0 已屏蔽
+// 0 0 0 1 0 0 0 被收敛
+// 0 0 1 0 0 x 0 无接收人
+// 0 1 0 0 0 x 0 升级发送
+// 1 0 x 0 0 0 x 抖动中
+// 最高位 1 表示已抑制，其他位都为0
 const (
 	FLAG_SEND = iota
 	FLAG_CALLBACK
@@ -14,6 +16,8 @@ const (
 	FLAG_CONVERGE
 	FLAG_NONEUSER
 	FLAG_UPGRADE
+	FLAG_FLAPPING
+	FLAG_INHIBIT
 )
 
 const (
@@ -24,6 +28,8 @@ const (
 	STATUS_MASK     = "mask"      // 已屏蔽
 	STATUS_CONVERGE = "converge"  // 频率限制
 	STATUS_UPGRADE  = "upgrade"   // 升级报警
+	STATUS_FLAPPING = "flapping"  // 抖动中
+	STATUS_INHIBIT  = "inhibit"   // 已抑制
 )
 
 func StatusConvert(s []string) []string {
@@ -45,6 +51,10 @@ func StatusConvert(s []string) []string {
 			status = append(status, "已收敛")
 		case STATUS_UPGRADE:
 			status = append(status, "已升级")
+		case STATUS_FLAPPING:
+			status = append(status, "抖动中")
+		case STATUS_INHIBIT:
+			status = append(status, "已抑制")
 		}
 	}
 
@@ -65,6 +75,10 @@ func GetStatus(status string) int {
 		return 1 << FLAG_CONVERGE
 	case STATUS_UPGRADE:
 		return 1 << FLAG_UPGRADE
+	case STATUS_FLAPPING:
+		return 1 << FLAG_FLAPPING
+	case STATUS_INHIBIT:
+		return 1 << FLAG_INHIBIT
 	}
 
 	return 0
@@ -92,6 +106,10 @@ func GetFlagsByStatus(ss []string) []uint16 {
 			flags[s] = getConverge()
 		case STATUS_UPGRADE:
 			flags[s] = getUpgrade()
+		case STATUS_FLAPPING:
+			flags[s] = getFlapping()
+		case STATUS_INHIBIT:
+			flags[s] = getInhibit()
 		}
 	}
 	uss := make([][]uint16, 0)
@@ -109,10 +127,19 @@ func GetStatusByFlag(flag uint16) []string {
 		return ret
 	}
 
+	if (flag>>FLAG_INHIBIT)&0x01 == 1 {
+		ret = append(ret, STATUS_INHIBIT)
+		return ret
+	}
+
 	if (flag>>FLAG_UPGRADE)&0x01 == 1 {
 		ret = append(ret, STATUS_UPGRADE)
 	}
 
+	if (flag>>FLAG_FLAPPING)&0x01 == 1 {
+		ret = append(ret, STATUS_FLAPPING)
+	}
+
 	if (flag>>FLAG_CONVERGE)&0x01 == 1 {
 		ret = append(ret, STATUS_CONVERGE)
 		return ret
@@ -143,9 +170,9 @@ func getDoing() []uint16 {
 	return []uint16{0}
 }
 
-// x 0 0 0 x 1 已发送
+// x x 0 0 0 x 1 已发送
 func getSend() []uint16 {
-	return []uint16{1, 3, 33, 35}
+	return []uint16{1, 3, 33, 35, 65}
 }
 
 // x 0 0 0 1 x 已回调
@@ -163,9 +190,9 @@ func getConverge() []uint16 {
 	return []uint16{8, 40}
 }
 
-// x 1 0 0 x 0 无接收人
+// x x 1 0 0 x 0 无接收人
 func getNoneUser() []uint16 {
-	return []uint16{16, 18, 48, 50}
+	return []uint16{16, 18, 48, 50, 80}
 }
 
 // 1 x x 0 x x 已升级
@@ -173,6 +200,16 @@ func getUpgrade() []uint16 {
 	return []uint16{32, 33, 34, 35, 40, 41, 42, 43, 48, 49, 50, 51, 56, 57, 58, 59}
 }
 
+// 1 0 x 0 0 0 x 抖动中
+func getFlapping() []uint16 {
+	return []uint16{64, 65, 80}
+}
+
+// 最高位1，其他位0 已抑制
+func getInhibit() []uint16 {
+	return []uint16{128}
+}
+
 func interSection(ss [][]uint16) []uint16 {
 	if len(ss) == 0 {
 		return []uint16{}
@@ -33,6 +33,38 @@ func EndpointIdsByNodeIds(nodeIds []int64) ([]int64, error) {
 	return ids, err
 }
 
+// NodeIdsGetByEndpointIdents 批量查询endpoint挂载的节点，key是endpoint的ident
+func NodeIdsGetByEndpointIdents(idents []string) (map[string][]int64, error) {
+	ret := make(map[string][]int64)
+	if len(idents) == 0 {
+		return ret, nil
+	}
+
+	var endpoints []Endpoint
+	err := DB["mon"].In("ident", idents).Find(&endpoints)
+	if err != nil {
+		return ret, err
+	}
+
+	ids := make([]int64, 0, len(endpoints))
+	identOf := make(map[int64]string, len(endpoints))
+	for _, e := range endpoints {
+		ids = append(ids, e.Id)
+		identOf[e.Id] = e.Ident
+	}
+
+	nes, err := NodeEndpointGetByEndpointIds(ids)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, ne := range nes {
+		ident := identOf[ne.EndpointId]
+		ret[ident] = append(ret[ident], ne.NodeId)
+	}
+	return ret, nil
+}
+
 func NodeEndpointGetByEndpointIds(endpointsIds []int64) ([]NodeEndpoint, error) {
 	if endpointsIds == nil || len(endpointsIds) == 0 {
 		return []NodeEndpoint{}, nil
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"xorm.io/xorm"
+
+	"github.com/didi/nightingale/src/toolkits/str"
 )
 
 type Stra struct {
@@ -19,6 +21,7 @@ type Stra struct {
 	RecoveryDur         int       `json:"recovery_dur"`                 //单位秒，持续正常2分钟则产生恢复event，0表示立即产生恢复event
 	RecoveryNotify      int       `json:"recovery_notify"`              //0 发送恢复通知 1不发送恢复通知
 	ExprsStr            string    `xorm:"exprs" json:"-"`               //多个条件的监控实例需要相同，并且同时满足才产生event
+	ExprsLogic          string    `json:"exprs_logic"`                  //多个条件之间的布尔组合，例如(A AND B) OR C，为空表示所有条件同时满足
 	TagsStr             string    `xorm:"tags" json:"-"`                //tag过滤条件
 	EnableStime         string    `json:"enable_stime"`                 //策略生效开始时间
 	EnableEtime         string    `json:"enable_etime"`                 //策略生效终止时间 支持23:00-02:00
@@ -34,6 +37,8 @@ type Stra struct {
 	LastUpdated         time.Time `xorm:"<-" json:"last_updated"`
 	NeedUpgrade         int       `xorm:"need_upgrade" json:"need_upgrade"`
 	AlertUpgradeStr     string    `xorm:"alert_upgrade" json:"-"`
+	InhibitStr          string    `xorm:"inhibit" json:"-"` //被哪些策略抑制
+	AggrStr             string    `xorm:"aggr" json:"-"`    //集群聚合配置
 
 	ExclNid          []int64      `xorm:"-" json:"excl_nid"`
 	Exprs            []Exp        `xorm:"-" json:"exprs"`
@@ -45,9 +50,14 @@ type Stra struct {
 	LeafNids         []int64      `xorm:"-" json:"leaf_nids"` //叶子节点id
 	Endpoints        []string     `xorm:"-" json:"endpoints"`
 	AlertUpgrade     AlertUpgrade `xorm:"-" json:"alert_upgrade"`
+	Inhibit          []Inhibit    `xorm:"-" json:"inhibit"`
+	Aggr             StraAggr     `xorm:"-" json:"aggr"`
 	JudgeInstance    string       `xorm:"-" json:"judge_instance"`
 }
 
+// stra表exprs字段的长度
+const maxExprsLen = 1024
+
 type StraLog struct {
 	Id      int64     `json:"id"`
 	Sid     int64     `json:"sid"`
@@ -58,11 +68,61 @@ type StraLog struct {
 }
 
 type Exp struct {
-	Eopt      string  `json:"eopt"`
-	Func      string  `json:"func"`      //all,max,min
-	Metric    string  `json:"metric"`    //metric
-	Params    []int   `json:"params"`    //连续n秒
-	Threshold float64 `json:"threshold"` //阈值
+	Eopt      string              `json:"eopt"`
+	Func      string              `json:"func"`                //all,max,min,stddev,zscore,pN
+	Metric    string              `json:"metric"`              //metric
+	Params    []int               `json:"params"`              //连续n秒
+	Threshold float64             `json:"threshold"`           //阈值
+	Overrides []ThresholdOverride `json:"overrides,omitempty"` //按tag覆盖阈值，按顺序第一个匹配的生效
+}
+
+// ThresholdOverride series的tag包含Tags中的所有tag时，使用Threshold作为阈值
+type ThresholdOverride struct {
+	Tags      string  `json:"tags"` //格式和counter中的tag相同，例如 mount=/data,device=sdb
+	Threshold float64 `json:"threshold"`
+
+	tagsMap map[string]string
+}
+
+// UnmarshalJSON Decode以及judge从monapi获取策略时都经过json解析，tags在这里拆分一次，判断时不再重复解析
+// 直接在代码中构造的override没有经过json解析，ThresholdOf中再按照Tags拆分
+func (o *ThresholdOverride) UnmarshalJSON(data []byte) error {
+	type override ThresholdOverride
+	var v override
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*o = ThresholdOverride(v)
+	o.tagsMap = str.DictedTagstring(o.Tags)
+	return nil
+}
+
+// ThresholdOf 返回series实际使用的阈值
+func (e Exp) ThresholdOf(tags map[string]string) float64 {
+	for _, o := range e.Overrides {
+		matcher := o.tagsMap
+		if matcher == nil {
+			matcher = str.DictedTagstring(o.Tags)
+		}
+		if matchTags(matcher, tags) {
+			return o.Threshold
+		}
+	}
+	return e.Threshold
+}
+
+func matchTags(matcher, tags map[string]string) bool {
+	if len(matcher) == 0 {
+		return false
+	}
+
+	for k, v := range matcher {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
 }
 
 type Tag struct {
@@ -71,6 +131,28 @@ type Tag struct {
 	Tval []string `json:"tval"` //修改为数组
 }
 
+// Inhibit 策略Sid正在告警时，抑制本策略在相同endpoint或者相同节点下的event
+type Inhibit struct {
+	Sid   int64  `json:"sid"`
+	Scope string `json:"scope"` // endpoint|node
+}
+
+// StraAggr 集群策略，先把所有endpoint的数据按时间聚合成一条曲线再判断，event产生在节点上
+// Func为空表示普通的单机策略，ratio表示满足Eopt Threshold的series所占的百分比
+type StraAggr struct {
+	Func      string  `json:"func"`      // sum|avg|max|min|ratio
+	Eopt      string  `json:"eopt"`      // ratio使用
+	Threshold float64 `json:"threshold"` // ratio使用
+}
+
+var AggrFuncs = map[string]bool{
+	"sum":   true,
+	"avg":   true,
+	"max":   true,
+	"min":   true,
+	"ratio": true,
+}
+
 type AlertUpgrade struct {
 	Users    []int64 `json:"users"`
 	Groups   []int64 `json:"groups"`
@@ -78,6 +160,28 @@ type AlertUpgrade struct {
 	Level    int     `json:"level"`
 }
 
+// 告警函数以及需要的最少参数个数，分位值函数pN单独校验
+var ExpFuncs = map[string]int{
+	"all":            0,
+	"max":            0,
+	"min":            0,
+	"sum":            0,
+	"avg":            0,
+	"diff":           0,
+	"pdiff":          0,
+	"happen":         1,
+	"nodata":         0,
+	"c_avg":          1,
+	"c_avg_abs":      1,
+	"c_avg_rate":     1,
+	"c_avg_rate_abs": 1,
+	"stddev":         0,
+	"zscore":         0,
+	"predict_linear": 1,
+	"dod_pdiff":      0,
+	"wow_pdiff":      0,
+}
+
 var MathOperators = map[string]bool{
 	">":  true,
 	"<":  true,
@@ -178,6 +282,35 @@ func StraGet(col string, val interface{}) (*Stra, error) {
 	return &obj, nil
 }
 
+// CheckInhibit 抑制规则依赖的策略必须存在
+func (s *Stra) CheckInhibit() error {
+	if len(s.Inhibit) == 0 {
+		return nil
+	}
+
+	sids := make([]int64, 0, len(s.Inhibit))
+	for _, inhibit := range s.Inhibit {
+		sids = append(sids, inhibit.Sid)
+	}
+
+	var ids []int64
+	err := DB["mon"].Table("stra").In("id", sids).Select("id").Find(&ids)
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		exists[id] = true
+	}
+	for _, sid := range sids {
+		if !exists[sid] {
+			return fmt.Errorf("inhibit stra %d not found", sid)
+		}
+	}
+	return nil
+}
+
 func StraDel(id int64) error {
 	session := DB["mon"].NewSession()
 	defer session.Close()
@@ -347,14 +480,46 @@ func (s *Stra) Encode() error {
 	if err != nil {
 		return fmt.Errorf("encode exprs err:%v", err)
 	}
+	if len(exprs) > maxExprsLen {
+		return fmt.Errorf("exprs too long: %d bytes, max %d bytes, reduce threshold overrides", len(exprs), maxExprsLen)
+	}
 	s.ExprsStr = string(exprs)
 
+	for i := range s.Exprs {
+		for j := range s.Exprs[i].Overrides {
+			o := &s.Exprs[i].Overrides[j]
+			o.tagsMap = str.DictedTagstring(o.Tags)
+		}
+	}
+
 	//校验exprs
 	var exprsTmp []Exp
 	err = json.Unmarshal(exprs, &exprsTmp)
 	for _, exp := range exprsTmp {
 		if _, found := MathOperators[exp.Eopt]; !found {
-			return fmt.Errorf("unknown exp.eopt:%s", exp)
+			return fmt.Errorf("unknown exp.eopt:%v", exp)
+		}
+
+		if err := checkExpFunc(exp); err != nil {
+			return err
+		}
+	}
+
+	s.ExprsLogic = strings.TrimSpace(s.ExprsLogic)
+	if s.ExprsLogic != "" {
+		logic, err := ParseExprsLogic(s.ExprsLogic, len(s.Exprs))
+		if err != nil {
+			return err
+		}
+
+		used := make(map[int]bool)
+		for _, index := range logic.Indexes() {
+			used[index] = true
+		}
+		for i := range s.Exprs {
+			if !used[i] {
+				return fmt.Errorf("exprs_logic: %s is not used", ExprsLogicName(i))
+			}
 		}
 	}
 
@@ -417,6 +582,31 @@ func (s *Stra) Encode() error {
 	}
 	s.NotifyUserStr = string(notifyUser)
 
+	//校验抑制规则
+	for _, inhibit := range s.Inhibit {
+		if inhibit.Sid <= 0 || inhibit.Sid == s.Id {
+			return fmt.Errorf("illegal inhibit sid %d", inhibit.Sid)
+		}
+
+		if inhibit.Scope != "endpoint" && inhibit.Scope != "node" {
+			return fmt.Errorf("unknown inhibit scope %s", inhibit.Scope)
+		}
+	}
+	inhibit, err := json.Marshal(s.Inhibit)
+	if err != nil {
+		return err
+	}
+	s.InhibitStr = string(inhibit)
+
+	if err := s.checkAggr(); err != nil {
+		return err
+	}
+	aggr, err := json.Marshal(s.Aggr)
+	if err != nil {
+		return err
+	}
+	s.AggrStr = string(aggr)
+
 	return nil
 }
 
@@ -463,29 +653,119 @@ func (s *Stra) Decode() error {
 		return err
 	}
 
+	if s.InhibitStr != "" {
+		err = json.Unmarshal([]byte(s.InhibitStr), &s.Inhibit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.AggrStr != "" {
+		err = json.Unmarshal([]byte(s.AggrStr), &s.Aggr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Stra) IsAggr() bool {
+	return s.Aggr.Func != ""
+}
+
+// 集群策略只支持一个条件，聚合之后的曲线上没有nodata的概念
+func (s *Stra) checkAggr() error {
+	if !s.IsAggr() {
+		return nil
+	}
+
+	if !AggrFuncs[s.Aggr.Func] {
+		return fmt.Errorf("unknown aggr.func:%s", s.Aggr.Func)
+	}
+
+	if s.Aggr.Func == "ratio" && !MathOperators[s.Aggr.Eopt] {
+		return fmt.Errorf("unknown aggr.eopt:%s", s.Aggr.Eopt)
+	}
+
+	if len(s.Exprs) != 1 || s.ExprsLogic != "" {
+		return fmt.Errorf("aggr stra only support one expr")
+	}
+
+	if s.Exprs[0].Func == "nodata" {
+		return fmt.Errorf("aggr stra not support nodata")
+	}
+	return nil
+}
+
+func checkExpFunc(exp Exp) error {
+	paramsCount, found := ExpFuncs[exp.Func]
+	if !found {
+		if _, ok := ParsePercentileFunc(exp.Func); ok {
+			return nil
+		}
+		return fmt.Errorf("unknown exp.func:%s", exp.Func)
+	}
+
+	if len(exp.Params) < paramsCount {
+		return fmt.Errorf("exp.func:%s need %d params", exp.Func, paramsCount)
+	}
+	return checkOverrides(exp)
+}
+
+func checkOverrides(exp Exp) error {
+	if len(exp.Overrides) > 0 && exp.Func == "nodata" {
+		return fmt.Errorf("exp.func:nodata not support threshold overrides")
+	}
+
+	for _, o := range exp.Overrides {
+		if strings.TrimSpace(o.Tags) == "" {
+			return fmt.Errorf("override tags is blank")
+		}
+
+		for _, tag := range strings.Split(o.Tags, ",") {
+			pair := strings.SplitN(strings.TrimSpace(tag), "=", 2)
+			if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+				return fmt.Errorf("illegal override tags:%s", o.Tags)
+			}
+		}
+	}
 	return nil
 }
 
+// ParsePercentileFunc 分位值函数的格式为pN，例如p50 p99 p99.9，N的取值范围是(0,100]
+func ParsePercentileFunc(fn string) (float64, bool) {
+	if !strings.HasPrefix(fn, "p") {
+		return 0, false
+	}
+
+	percentile, err := strconv.ParseFloat(fn[1:], 64)
+	if err != nil || percentile <= 0 || percentile > 100 {
+		return 0, false
+	}
+	return percentile, true
+}
+
 // 00:00-23:59
 func checkDurationString(str string) error {
 	slice := strings.Split(str, ":")
 	if len(slice) != 2 {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration %s", str)
 	}
 
 	hour, err := strconv.Atoi(slice[0])
 	if err != nil {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration %s", str)
 	}
 	if hour < 0 || hour > 23 {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration %s", str)
 	}
 	minute, err := strconv.Atoi(slice[1])
 	if err != nil {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration %s", str)
 	}
 	if minute < 0 || minute > 59 {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration %s", str)
 	}
 
 	return nil
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExprsLogic 多个告警条件之间的布尔组合，条件按顺序用A B C...表示
+// 例如 "(A AND B) OR C"，运算符支持 AND/&& 和 OR/||，AND优先级高于OR
+type ExprsLogic struct {
+	Op    string // and|or，叶子节点为空
+	Index int    // 叶子节点对应的exprs下标
+	Left  *ExprsLogic
+	Right *ExprsLogic
+}
+
+func ParseExprsLogic(str string, count int) (*ExprsLogic, error) {
+	tokens, err := tokenizeExprsLogic(str)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &logicParser{tokens: tokens, count: count}
+	logic, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("exprs_logic: unexpected %s", p.tokens[p.pos])
+	}
+	return logic, nil
+}
+
+// Eval triggered为每个条件是否触发
+func (l *ExprsLogic) Eval(triggered []bool) bool {
+	switch l.Op {
+	case "and":
+		return l.Left.Eval(triggered) && l.Right.Eval(triggered)
+	case "or":
+		return l.Left.Eval(triggered) || l.Right.Eval(triggered)
+	default:
+		return l.Index < len(triggered) && triggered[l.Index]
+	}
+}
+
+// Fired 返回使表达式成立的那些分支上的条件下标
+func (l *ExprsLogic) Fired(triggered []bool) []int {
+	if !l.Eval(triggered) {
+		return []int{}
+	}
+
+	switch l.Op {
+	case "and":
+		return append(l.Left.Fired(triggered), l.Right.Fired(triggered)...)
+	case "or":
+		return append(l.Left.Fired(triggered), l.Right.Fired(triggered)...)
+	default:
+		return []int{l.Index}
+	}
+}
+
+// Indexes 表达式中引用到的所有条件下标
+func (l *ExprsLogic) Indexes() []int {
+	if l.Op == "" {
+		return []int{l.Index}
+	}
+	return append(l.Left.Indexes(), l.Right.Indexes()...)
+}
+
+func ExprsLogicName(index int) string {
+	return string(rune('A' + index))
+}
+
+func tokenizeExprsLogic(str string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(str); {
+		c := str[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(str[i:], "&&"):
+			tokens = append(tokens, "and")
+			i += 2
+		case strings.HasPrefix(str[i:], "||"):
+			tokens = append(tokens, "or")
+			i += 2
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i
+			for j < len(str) && ((str[j] >= 'a' && str[j] <= 'z') || (str[j] >= 'A' && str[j] <= 'Z')) {
+				j++
+			}
+
+			word := strings.ToUpper(str[i:j])
+			switch {
+			case word == "AND" || word == "OR":
+				tokens = append(tokens, strings.ToLower(word))
+			case len(word) == 1:
+				tokens = append(tokens, word)
+			default:
+				return nil, fmt.Errorf("exprs_logic: unknown token %s", str[i:j])
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("exprs_logic: unknown char %c", c)
+		}
+	}
+	return tokens, nil
+}
+
+type logicParser struct {
+	tokens []string
+	pos    int
+	count  int
+}
+
+func (p *logicParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *logicParser) parseOr() (*ExprsLogic, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &ExprsLogic{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *logicParser) parseAnd() (*ExprsLogic, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &ExprsLogic{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *logicParser) parseFactor() (*ExprsLogic, error) {
+	token := p.peek()
+	p.pos++
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("exprs_logic: unexpected end")
+	case token == "(":
+		logic, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("exprs_logic: missing )")
+		}
+		p.pos++
+		return logic, nil
+	case len(token) == 1 && token[0] >= 'A' && token[0] <= 'Z':
+		index := int(token[0] - 'A')
+		if index >= p.count {
+			return nil, fmt.Errorf("exprs_logic: %s out of range, only %d exprs", token, p.count)
+		}
+		return &ExprsLogic{Index: index}, nil
+	default:
+		return nil, fmt.Errorf("exprs_logic: unexpected %s", token)
+	}
+}
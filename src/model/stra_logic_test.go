@@ -0,0 +1,46 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExprsLogic(t *testing.T) {
+	tests := []struct {
+		logic     string
+		triggered []bool
+		result    bool
+		fired     []int
+	}{
+		{"A OR B", []bool{false, true}, true, []int{1}},
+		{"A || B", []bool{false, false}, false, []int{}},
+		{"A and B", []bool{true, false}, false, []int{}},
+		{"(A AND B) OR C", []bool{true, false, true}, true, []int{2}},
+		{"(A && B) || C", []bool{true, true, false}, true, []int{0, 1}},
+		{"A AND B OR C", []bool{false, true, true}, true, []int{2}},
+		{"A AND (B OR C)", []bool{true, false, true}, true, []int{0, 2}},
+	}
+
+	for _, tt := range tests {
+		logic, err := ParseExprsLogic(tt.logic, len(tt.triggered))
+		if err != nil {
+			t.Fatalf("%s: parse err:%v", tt.logic, err)
+		}
+
+		if result := logic.Eval(tt.triggered); result != tt.result {
+			t.Errorf("%s %v: expect %v, got %v", tt.logic, tt.triggered, tt.result, result)
+		}
+
+		if fired := logic.Fired(tt.triggered); !reflect.DeepEqual(fired, tt.fired) {
+			t.Errorf("%s %v: expect fired %v, got %v", tt.logic, tt.triggered, tt.fired, fired)
+		}
+	}
+}
+
+func TestParseExprsLogicError(t *testing.T) {
+	for _, logic := range []string{"", "A OR", "(A OR B", "A OR B)", "A XOR B", "A OR D", "A B", "A | B"} {
+		if _, err := ParseExprsLogic(logic, 3); err == nil {
+			t.Errorf("%q should be illegal", logic)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestThresholdOf(t *testing.T) {
+	var exp Exp
+	data := `{"eopt":">","func":"all","metric":"disk.bytes.used.percent","threshold":90,` +
+		`"overrides":[{"tags":"mount=/data,device=sdb","threshold":80},{"tags":"mount=/data","threshold":85}]}`
+	if err := json.Unmarshal([]byte(data), &exp); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		tags      map[string]string
+		threshold float64
+	}{
+		{map[string]string{"mount": "/data", "device": "sdb"}, 80},
+		{map[string]string{"mount": "/data", "device": "sdc"}, 85},
+		{map[string]string{"mount": "/"}, 90},
+		{nil, 90},
+	}
+	for _, c := range cases {
+		if threshold := exp.ThresholdOf(c.tags); threshold != c.threshold {
+			t.Errorf("%v: expect %v, got %v", c.tags, c.threshold, threshold)
+		}
+	}
+}
+
+// 代码中直接构造的override没有经过json解析，同样生效
+func TestThresholdOfLiteral(t *testing.T) {
+	exp := Exp{
+		Threshold: 90,
+		Overrides: []ThresholdOverride{{Tags: "mount=/data", Threshold: 85}},
+	}
+	if threshold := exp.ThresholdOf(map[string]string{"mount": "/data"}); threshold != 85 {
+		t.Fatalf("expect 85, got %v", threshold)
+	}
+	if threshold := exp.ThresholdOf(map[string]string{"mount": "/"}); threshold != 90 {
+		t.Fatalf("expect 90, got %v", threshold)
+	}
+}
+
+// exprs超过字段长度时拒绝保存
+func TestEncodeExprsTooLong(t *testing.T) {
+	exp := Exp{Eopt: ">", Func: "all", Metric: "disk.bytes.used.percent", Threshold: 90}
+	for i := 0; i < 50; i++ {
+		exp.Overrides = append(exp.Overrides, ThresholdOverride{Tags: fmt.Sprintf("mount=/data%d", i), Threshold: 80})
+	}
+
+	s := &Stra{Exprs: []Exp{exp}}
+	if err := s.Encode(); err == nil || !strings.Contains(err.Error(), "exprs too long") {
+		t.Fatalf("expect exprs too long, got %v", err)
+	}
+}
@@ -116,6 +116,20 @@ func (e *EndpointIndexMap) GetIndexByClude(endpoint, metric string, include, exc
 	return GetAllCounter(GetSortTags(fullmatch)), nil
 }
 
+// GetEndpointsByMetric 上报过metric的所有endpoint，包括没有挂到服务树节点上的endpoint
+func (e *EndpointIndexMap) GetEndpointsByMetric(metric string) []string {
+	e.RLock()
+	defer e.RUnlock()
+
+	ret := []string{}
+	for endpoint, metricIndexMap := range e.M {
+		if _, exists := metricIndexMap.GetMetricIndex(metric); exists {
+			ret = append(ret, endpoint)
+		}
+	}
+	return ret
+}
+
 func (e *EndpointIndexMap) GetEndpoints() []string {
 	e.RLock()
 	defer e.RUnlock()
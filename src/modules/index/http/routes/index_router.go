@@ -228,11 +228,13 @@ func GetIndexByFullTags(c *gin.Context) {
 	render.Data(c, resp, nil)
 }
 
+// CludeRecv all_endpoints为true时忽略endpoints，查询所有上报过metric的endpoint
 type CludeRecv struct {
-	Endpoints []string         `json:"endpoints"`
-	Metric    string           `json:"metric"`
-	Include   []*cache.TagPair `json:"include"`
-	Exclude   []*cache.TagPair `json:"exclude"`
+	Endpoints    []string         `json:"endpoints"`
+	AllEndpoints bool             `json:"all_endpoints"`
+	Metric       string           `json:"metric"`
+	Include      []*cache.TagPair `json:"include"`
+	Exclude      []*cache.TagPair `json:"exclude"`
 }
 
 type XcludeResp struct {
@@ -260,7 +262,12 @@ func GetIndexByClude(c *gin.Context) {
 		tagList := []string{}
 		tagFilter := make(map[string]struct{})
 
-		for _, endpoint := range r.Endpoints {
+		endpoints := r.Endpoints
+		if r.AllEndpoints && metric != "" {
+			endpoints = cache.IndexDB.GetEndpointsByMetric(metric)
+		}
+
+		for _, endpoint := range endpoints {
 			if endpoint == "" {
 				logger.Debugf("非法请求: endpoint字段缺失:%v", r)
 				continue
@@ -50,6 +50,10 @@ func Query(reqs []*dataobj.QueryData) ([]*dataobj.TsdbQueryResponse, error) {
 	if resp.Msg != "" {
 		return nil, errors.New(resp.Msg)
 	}
+	// 数据不完整时判断结果不可信，比如nodata会把没查到的曲线当成没有数据
+	if resp.Partial {
+		return nil, fmt.Errorf("query partial result, limits hit: %v", resp.Limits)
+	}
 	return resp.Data, nil
 }
 
@@ -80,11 +84,13 @@ type XCludeStruct struct {
 	Tagv []string `json:"tagv"`
 }
 
+// IndexReq AllEndpoints为true时忽略Endpoints，查询所有上报过metric的endpoint
 type IndexReq struct {
-	Endpoints []string       `json:"endpoints"`
-	Metric    string         `json:"metric"`
-	Include   []XCludeStruct `json:"include,omitempty"`
-	Exclude   []XCludeStruct `json:"exclude,omitempty"`
+	Endpoints    []string       `json:"endpoints"`
+	AllEndpoints bool           `json:"all_endpoints,omitempty"`
+	Metric       string         `json:"metric"`
+	Include      []XCludeStruct `json:"include,omitempty"`
+	Exclude      []XCludeStruct `json:"exclude,omitempty"`
 }
 
 type IndexData struct {
@@ -17,28 +17,15 @@ func Push(event *dataobj.Event) error {
 		return err
 	}
 
-	succ := false
-	if len(RedisConnPools) == 0 {
-		return errors.New("redis publish failed: empty conn pool")
+	if RedisClient == nil {
+		return errors.New("redis publish failed: redis not initialized")
 	}
 
-	for i := range RedisConnPools {
-		rc := RedisConnPools[i].Get()
-		defer rc.Close()
-
-		// 写入用lpush 读出应该用 rpop
-		_, err = rc.Do("RPUSH", event.Partition, string(bytes))
-
-		if err == nil {
-			succ = true
-			break
-		}
-	}
-
-	if succ {
-		logger.Debugf("redis publish succ, event: %s", string(bytes))
-		return nil
+	// 写入用rpush 读出应该用 brpop
+	if _, err = RedisClient.Do("RPUSH", event.Partition, string(bytes)); err != nil {
+		return fmt.Errorf("redis publish failed:%v", err)
 	}
 
-	return fmt.Errorf("redis publish failed finally:%v", err)
+	logger.Debugf("redis publish succ, event: %s", string(bytes))
+	return nil
 }
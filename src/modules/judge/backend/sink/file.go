@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+type FileSinkSection struct {
+	Enabled bool         `yaml:"enabled"`
+	Dir     string       `yaml:"dir"`
+	Retry   RetrySection `yaml:"retry"`
+}
+
+// FileSink 每个event一行json，按天写到dir下的event.YYYYMMDD.log中
+type FileSink struct {
+	dir  string
+	day  string
+	file *os.File
+}
+
+func NewFileSink(cfg FileSinkSection) *FileSink {
+	return &FileSink{dir: cfg.Dir}
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Send(event *dataobj.Event) error {
+	bs, err := json.Marshal(payload{ID: event.ID, Event: event})
+	if err != nil {
+		return err
+	}
+
+	if err = s.rotate(time.Now().Format("20060102")); err != nil {
+		return err
+	}
+
+	_, err = s.file.Write(append(bs, '\n'))
+	return err
+}
+
+// 只在worker中调用，不需要加锁
+func (s *FileSink) rotate(day string) error {
+	if s.file != nil && s.day == day {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path.Join(s.dir, "event."+day+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.day = day
+	return nil
+}
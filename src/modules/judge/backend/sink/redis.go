@@ -0,0 +1,22 @@
+package sink
+
+import (
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/judge/backend/redi"
+)
+
+type RedisSinkSection struct {
+	Enabled bool         `yaml:"enabled"`
+	Retry   RetrySection `yaml:"retry"`
+}
+
+// RedisSink 按照event.Partition写入redis队列，monapi从队列中读取
+type RedisSink struct{}
+
+func (s *RedisSink) Name() string {
+	return "redis"
+}
+
+func (s *RedisSink) Send(event *dataobj.Event) error {
+	return redi.Push(event)
+}
@@ -0,0 +1,220 @@
+package sink
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/spool"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// Sink event的出口，Send返回error时会按照sink的配置重试
+type Sink interface {
+	Name() string
+	Send(event *dataobj.Event) error
+}
+
+type SinkSection struct {
+	QueueSize int                `yaml:"queueSize"`
+	Spool     SpoolSection       `yaml:"spool"`
+	Redis     RedisSinkSection   `yaml:"redis"`
+	Webhook   WebhookSinkSection `yaml:"webhook"`
+	File      FileSinkSection    `yaml:"file"`
+}
+
+// SpoolSection 内存队列满了或者进程退出时，event写入磁盘，之后按顺序继续发送
+// 每个sink使用dir下单独的目录
+type SpoolSection struct {
+	Enabled     bool   `yaml:"enabled"`
+	Dir         string `yaml:"dir"`
+	SegmentSize int    `yaml:"segmentSize"` // 单个segment文件的大小，单位MB
+	MaxSize     int    `yaml:"maxSize"`     // 每个sink占用磁盘的上限，单位MB，超过之后丢弃
+}
+
+// times为0表示一直重试直到成功，interval单位是毫秒
+type RetrySection struct {
+	Times    int `yaml:"times"`
+	Interval int `yaml:"interval"`
+}
+
+const DefaultSendInterval = 100 * time.Millisecond
+
+// 每次从spool中读取的event个数
+const spoolBatch = 100
+
+type worker struct {
+	sink  Sink
+	retry RetrySection
+	queue *spool.Queue
+}
+
+var workers []*worker
+
+func Init(cfg SinkSection) {
+	if cfg.Redis.Enabled {
+		register(&RedisSink{}, cfg.Redis.Retry, cfg)
+	}
+
+	if cfg.Webhook.Enabled {
+		register(NewWebhookSink(cfg.Webhook), cfg.Webhook.Retry, cfg)
+	}
+
+	if cfg.File.Enabled {
+		register(NewFileSink(cfg.File), cfg.File.Retry, cfg)
+	}
+
+	if len(workers) == 0 {
+		logger.Warning("no event sink enabled")
+	}
+}
+
+func register(s Sink, retry RetrySection, cfg SinkSection) {
+	w := &worker{
+		sink:  s,
+		retry: retry,
+		queue: newQueue(s.Name(), cfg),
+	}
+	workers = append(workers, w)
+	go w.loop()
+}
+
+func newQueue(name string, cfg SinkSection) *spool.Queue {
+	if !cfg.Spool.Enabled {
+		return spool.NewQueue(cfg.QueueSize, nil, decodeEvent)
+	}
+
+	dir := filepath.Join(cfg.Spool.Dir, name)
+	sp, err := spool.Open(dir, spool.Options{
+		SegmentSize: int64(cfg.Spool.SegmentSize) * 1024 * 1024,
+		MaxSize:     int64(cfg.Spool.MaxSize) * 1024 * 1024,
+	})
+	if err != nil {
+		// 打不开spool时退化为只使用内存队列
+		logger.Errorf("open sink spool %s err:%v", dir, err)
+		return spool.NewQueue(cfg.QueueSize, nil, decodeEvent)
+	}
+
+	if n := sp.Len(); n > 0 {
+		logger.Infof("sink spool %s has %d events to send", dir, n)
+	}
+	return spool.NewQueue(cfg.QueueSize, sp, decodeEvent)
+}
+
+// queuedEvent 写入spool时保留event中json忽略的ID和Partition，redis sink需要按照Partition写入
+type queuedEvent struct {
+	*dataobj.Event
+	ID        string `json:"id"`
+	Partition string `json:"partition"`
+}
+
+func newQueuedEvent(event *dataobj.Event) *queuedEvent {
+	return &queuedEvent{Event: event, ID: event.ID, Partition: event.Partition}
+}
+
+func (e *queuedEvent) event() *dataobj.Event {
+	event := *e.Event
+	event.ID = e.ID
+	event.Partition = e.Partition
+	return &event
+}
+
+func decodeEvent(bs []byte) (interface{}, error) {
+	e := &queuedEvent{}
+	err := json.Unmarshal(bs, e)
+	return e, err
+}
+
+// payload 发送到外部系统的event带上ID，同一个series的告警和恢复ID相同
+type payload struct {
+	ID string `json:"id"`
+	*dataobj.Event
+}
+
+// Push 把event放到每个sink的队列中，由各自的worker异步发送
+func Push(event *dataobj.Event) {
+	if len(workers) == 0 {
+		logger.Errorf("no event sink, drop event:%v", event)
+		return
+	}
+
+	item := newQueuedEvent(event)
+	for _, w := range workers {
+		if !w.queue.PushFront(item) {
+			stats.Counter.Set("sink."+w.sink.Name()+".drop", 1)
+			logger.Errorf("sink:%s queue is full, drop event:%v", w.sink.Name(), event)
+		}
+	}
+}
+
+// Close 进程退出之前把内存队列中还没有发送的event写入spool，下次启动之后继续发送
+func Close() {
+	for _, w := range workers {
+		if dropped := w.queue.Spill(nil); dropped > 0 {
+			logger.Errorf("sink:%s spill failed, drop %d events", w.sink.Name(), dropped)
+		}
+		w.queue.Close()
+	}
+}
+
+// 内存队列中的event先于spool中的event进入队列，先发送内存队列
+func (w *worker) loop() {
+	for {
+		if items := w.queue.PopBackBy(1); len(items) > 0 {
+			w.send(items[0].(*queuedEvent).event())
+			continue
+		}
+
+		if !w.replay() {
+			time.Sleep(DefaultSendInterval)
+		}
+	}
+}
+
+// replay 按顺序发送spool中的一批event，返回false表示spool中没有数据
+func (w *worker) replay() bool {
+	if w.queue.SpoolLen() == 0 {
+		return false
+	}
+
+	items, err := w.queue.Peek(spoolBatch)
+	if err != nil {
+		logger.Errorf("sink:%s read spool err:%v", w.sink.Name(), err)
+		if len(items) == 0 {
+			return false
+		}
+	}
+
+	for _, item := range items {
+		w.send(item.(*queuedEvent).event())
+	}
+
+	if err := w.queue.Ack(); err != nil {
+		logger.Errorf("sink:%s ack spool err:%v", w.sink.Name(), err)
+	}
+	return true
+}
+
+// 每个sink只有一个worker，失败重试时后面的event等待，保证同一个series的告警和恢复顺序不变
+func (w *worker) send(event *dataobj.Event) {
+	name := w.sink.Name()
+	for i := 1; ; i++ {
+		err := w.sink.Send(event)
+		if err == nil {
+			stats.Counter.Set("sink."+name+".succ", 1)
+			return
+		}
+
+		stats.Counter.Set("sink."+name+".fail", 1)
+		if w.retry.Times > 0 && i > w.retry.Times {
+			logger.Errorf("sink:%s send event:%s failed after %d retries, drop it, err:%v", name, event.ID, w.retry.Times, err)
+			return
+		}
+
+		logger.Warningf("sink:%s send event:%s failed, retry %d, err:%v", name, event.ID, i, err)
+		time.Sleep(time.Duration(w.retry.Interval) * time.Millisecond)
+	}
+}
@@ -0,0 +1,148 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+type failSink struct {
+	fails int
+	calls int
+}
+
+func (s *failSink) Name() string {
+	return "fail"
+}
+
+func (s *failSink) Send(event *dataobj.Event) error {
+	s.calls++
+	if s.calls <= s.fails {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func TestWorkerRetry(t *testing.T) {
+	stats.Counter = stats.NewCounter("test")
+	event := &dataobj.Event{ID: "s_1_host01/cpu.idle"}
+
+	// times为0时一直重试直到成功
+	s := &failSink{fails: 5}
+	(&worker{sink: s, retry: RetrySection{Times: 0}}).send(event)
+	if s.calls != 6 {
+		t.Fatalf("expect 6 calls, got %d", s.calls)
+	}
+
+	// 超过重试次数之后丢弃
+	s = &failSink{fails: 5}
+	(&worker{sink: s, retry: RetrySection{Times: 2}}).send(event)
+	if s.calls != 3 {
+		t.Fatalf("expect 3 calls, got %d", s.calls)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var body map[string]interface{}
+	var token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Token")
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["event_type"] == "recovery" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	s := NewWebhookSink(WebhookSinkSection{Url: ts.URL, Timeout: 1000, Headers: map[string]string{"X-Token": "abc"}})
+	event := &dataobj.Event{ID: "s_1_host01/cpu.idle", Sid: 1, EventType: "alert", Endpoint: "host01"}
+	if err := s.Send(event); err != nil {
+		t.Fatal(err)
+	}
+	if body["id"] != event.ID || body["endpoint"] != "host01" || token != "abc" {
+		t.Fatalf("unexpected webhook request %v token:%s", body, token)
+	}
+
+	// 非2xx视为失败，交给worker重试
+	event.EventType = "recovery"
+	if err := s.Send(event); err == nil {
+		t.Fatal("non-2xx response should be an error")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewFileSink(FileSinkSection{Dir: dir})
+	for _, eventType := range []string{"alert", "recovery"} {
+		if err := s.Send(&dataobj.Event{ID: "s_1_host01/cpu.idle", EventType: eventType}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "event."+time.Now().Format("20060102")+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":"s_1_host01/cpu.idle"`) || !strings.Contains(lines[1], `"event_type":"recovery"`) {
+		t.Fatalf("unexpected file content %s", bs)
+	}
+}
+
+// 进程退出时内存队列中的event写入spool，重新打开之后按顺序读出，ID和Partition不丢失
+func TestSinkSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := SinkSection{QueueSize: 2, Spool: SpoolSection{Enabled: true, Dir: dir}}
+
+	q := newQueue("redis", cfg)
+	for _, id := range []string{"a", "b", "c"} {
+		if !q.PushFront(newQueuedEvent(&dataobj.Event{ID: id, Partition: "/n9e/event/p1"})) {
+			t.Fatalf("push %s failed", id)
+		}
+	}
+	w := &worker{sink: &failSink{}, queue: q}
+	workers = []*worker{w}
+	defer func() { workers = nil }()
+	Close()
+
+	q = newQueue("redis", cfg)
+	defer q.Close()
+	if q.Len() != 0 || q.SpoolLen() != 3 {
+		t.Fatalf("expect 3 events in spool, got memory:%d spool:%d", q.Len(), q.SpoolLen())
+	}
+
+	items, err := q.Peek(spoolBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, item := range items {
+		event := item.(*queuedEvent).event()
+		if event.Partition != "/n9e/event/p1" {
+			t.Fatalf("partition lost: %+v", event)
+		}
+		ids = append(ids, event.ID)
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Fatalf("unexpected order %v", ids)
+	}
+}
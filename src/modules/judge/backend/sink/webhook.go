@@ -0,0 +1,51 @@
+package sink
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+
+	"github.com/toolkits/pkg/net/httplib"
+)
+
+type WebhookSinkSection struct {
+	Enabled bool              `yaml:"enabled"`
+	Url     string            `yaml:"url"`
+	Timeout int               `yaml:"timeout"`
+	Headers map[string]string `yaml:"headers"`
+	Retry   RetrySection      `yaml:"retry"`
+}
+
+// WebhookSink 把event以json的形式POST到url，包括event的id，返回非2xx的状态码视为失败
+type WebhookSink struct {
+	cfg WebhookSinkSection
+}
+
+func NewWebhookSink(cfg WebhookSinkSection) *WebhookSink {
+	return &WebhookSink{cfg: cfg}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Send(event *dataobj.Event) error {
+	req := httplib.Post(s.cfg.Url).JSONBodyQuiet(payload{ID: event.ID, Event: event}).SetTimeout(time.Duration(s.cfg.Timeout) * time.Millisecond)
+	for k, v := range s.cfg.Headers {
+		req = req.Header(k, v)
+	}
+
+	resp, err := req.Response()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook %s response code:%d body:%s", s.cfg.Url, resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"sync"
+	"time"
 
 	"github.com/didi/nightingale/src/dataobj"
 )
@@ -27,3 +28,23 @@ func (this *SafeEventMap) Set(key string, event *dataobj.Event) {
 	defer this.Unlock()
 	this.M[key] = event
 }
+
+// CleanStale 清理很久没有更新的event，series消失之后不再残留
+// 正在恢复计时的series记录在RecoveryStates中，不受影响
+func (this *SafeEventMap) CleanStale(before int64) {
+	this.Lock()
+	defer this.Unlock()
+	for key, event := range this.M {
+		if event.Etime < before {
+			delete(this.M, key)
+		}
+	}
+}
+
+func (this *SafeEventMap) CleanLoop() {
+	t1 := time.NewTicker(time.Duration(600) * time.Second)
+	for {
+		<-t1.C
+		this.CleanStale(time.Now().Unix() - 86400)
+	}
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// 记录每个series在滑动窗口内告警/恢复状态变化的时间，key是event.ID
+type FlapState struct {
+	Changes  []int64 `json:"changes"`
+	Flapping bool    `json:"flapping"`
+}
+
+type SafeFlapMap struct {
+	sync.RWMutex
+	M map[string]*FlapState
+}
+
+var (
+	FlapStates = NewSafeFlapMap()
+)
+
+func NewSafeFlapMap() *SafeFlapMap {
+	return &SafeFlapMap{M: make(map[string]*FlapState)}
+}
+
+// Change 记录一次状态变化，返回窗口内的变化次数以及是否处于抖动状态
+func (this *SafeFlapMap) Change(key string, ts, window int64) (int, bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	s, exists := this.M[key]
+	if !exists {
+		s = &FlapState{}
+		this.M[key] = s
+	}
+
+	s.Changes = append(trimChanges(s.Changes, ts-window), ts)
+	return len(s.Changes), s.Flapping
+}
+
+func (this *SafeFlapMap) SetFlapping(key string, flapping bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	if s, exists := this.M[key]; exists {
+		s.Flapping = flapping
+	}
+}
+
+func (this *SafeFlapMap) IsFlapping(key string) bool {
+	this.RLock()
+	defer this.RUnlock()
+
+	s, exists := this.M[key]
+	return exists && s.Flapping
+}
+
+// Stabilize 处于抖动状态的series在窗口内的变化次数不超过limit时解除抖动，返回是否解除
+func (this *SafeFlapMap) Stabilize(key string, now, window int64, limit int) bool {
+	this.Lock()
+	defer this.Unlock()
+
+	s, exists := this.M[key]
+	if !exists || !s.Flapping {
+		return false
+	}
+
+	s.Changes = trimChanges(s.Changes, now-window)
+	if len(s.Changes) > limit {
+		return false
+	}
+
+	s.Flapping = false
+	return true
+}
+
+func (this *SafeFlapMap) Len() int {
+	this.RLock()
+	defer this.RUnlock()
+	return len(this.M)
+}
+
+// 清理很久没有状态变化的series
+func (this *SafeFlapMap) CleanStale(before int64) {
+	this.Lock()
+	defer this.Unlock()
+	for key, s := range this.M {
+		if len(s.Changes) == 0 || s.Changes[len(s.Changes)-1] < before {
+			delete(this.M, key)
+		}
+	}
+}
+
+func (this *SafeFlapMap) CleanLoop() {
+	t1 := time.NewTicker(time.Duration(600) * time.Second)
+	for {
+		<-t1.C
+		this.CleanStale(time.Now().Unix() - 86400)
+	}
+}
+
+// changes按时间升序排列，去掉before之前的记录
+func trimChanges(changes []int64, before int64) []int64 {
+	i := 0
+	for i < len(changes) && changes[i] <= before {
+		i++
+	}
+	return changes[i:]
+}
@@ -34,6 +34,19 @@ func (this *JudgeItemMap) Len() int {
 	return len(this.M)
 }
 
+// CountBySid 按策略统计series的数量，累加到counts中
+func (this *JudgeItemMap) CountBySid(counts map[int64]int) {
+	this.RLock()
+	defer this.RUnlock()
+	for _, L := range this.M {
+		front := L.Front()
+		if front == nil {
+			continue
+		}
+		counts[front.Value.(*dataobj.JudgeItem).Sid]++
+	}
+}
+
 func (this *JudgeItemMap) CleanStale(before int64) {
 	keys := []string{}
 
@@ -69,6 +82,15 @@ func (this *JudgeItemMap) BatchDelete(keys []string) {
 // 这是个线程不安全的大Map，需要提前初始化好
 var HistoryBigMap = make(map[string]*JudgeItemMap)
 
+// HistorySeriesCount 统计每个策略在HistoryBigMap中的series数量
+func HistorySeriesCount() map[int64]int {
+	counts := make(map[int64]int)
+	for _, historyMap := range HistoryBigMap {
+		historyMap.CountBySid(counts)
+	}
+	return counts
+}
+
 func InitHistoryBigMap() {
 	arr := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "a", "b", "c", "d", "e", "f"}
 	for i := 0; i < 16; i++ {
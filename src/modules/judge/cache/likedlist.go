@@ -96,3 +96,29 @@ func (this *SafeLinkedList) HistoryData(limit int) ([]*dataobj.RRDData, bool) {
 
 	return vs, isEnough
 }
+
+// Items 按从新到旧的顺序返回所有的点
+func (this *SafeLinkedList) Items() []*dataobj.JudgeItem {
+	this.RLock()
+	defer this.RUnlock()
+
+	items := make([]*dataobj.JudgeItem, 0, this.L.Len())
+	for e := this.L.Front(); e != nil; e = e.Next() {
+		items = append(items, e.Value.(*dataobj.JudgeItem))
+	}
+	return items
+}
+
+// PushBackOlder 把比链表中最老的点还要老的数据追加到链表尾部，items需要按从新到旧排列
+func (this *SafeLinkedList) PushBackOlder(items []*dataobj.JudgeItem) {
+	this.Lock()
+	defer this.Unlock()
+
+	for _, item := range items {
+		back := this.L.Back()
+		if back != nil && item.Timestamp >= back.Value.(*dataobj.JudgeItem).Timestamp {
+			continue
+		}
+		this.L.PushBack(item)
+	}
+}
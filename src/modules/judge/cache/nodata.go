@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"sync"
+)
+
+// nodata策略从索引学习到的series，LastSeen是最近一次查到数据点的时间
+type NodataSeries struct {
+	Series
+	LastSeen int64
+}
+
+type SafeNodataMap struct {
+	sync.RWMutex
+	M map[int64]map[string]*NodataSeries
+}
+
+var NodataSeriesMap = NewSafeNodataMap()
+
+func NewSafeNodataMap() *SafeNodataMap {
+	return &SafeNodataMap{M: make(map[int64]map[string]*NodataSeries)}
+}
+
+// Learn 记录索引中查到的series，新学习到的series从s.TS开始计算
+func (this *SafeNodataMap) Learn(sid int64, key string, s Series) {
+	this.Lock()
+	defer this.Unlock()
+
+	ss, exists := this.M[sid]
+	if !exists {
+		ss = make(map[string]*NodataSeries)
+		this.M[sid] = ss
+	}
+
+	if ns, exists := ss[key]; exists {
+		ns.Step = s.Step
+		ns.Dstype = s.Dstype
+		return
+	}
+	ss[key] = &NodataSeries{Series: s, LastSeen: s.TS}
+}
+
+func (this *SafeNodataMap) Seen(sid int64, key string, ts int64) {
+	this.Lock()
+	defer this.Unlock()
+
+	if ns, exists := this.M[sid][key]; exists && ts > ns.LastSeen {
+		ns.LastSeen = ts
+	}
+}
+
+func (this *SafeNodataMap) Get(sid int64) map[string]NodataSeries {
+	this.RLock()
+	defer this.RUnlock()
+
+	ret := make(map[string]NodataSeries, len(this.M[sid]))
+	for key, ns := range this.M[sid] {
+		ret[key] = *ns
+	}
+	return ret
+}
+
+// Expire 去掉索引中已经查不到、并且before之后没有数据的series，indexed是本次索引查询到的series
+// 还在索引中的series一直跟踪，删除之后重新出现在索引中会被重新学习
+func (this *SafeNodataMap) Expire(sid int64, before int64, indexed map[string]struct{}) {
+	this.Lock()
+	defer this.Unlock()
+
+	for key, ns := range this.M[sid] {
+		if _, exists := indexed[key]; exists {
+			continue
+		}
+		if ns.LastSeen < before {
+			delete(this.M[sid], key)
+		}
+	}
+}
+
+// Retain 只保留ids中的策略，策略删除或者迁移到其他judge之后清理
+func (this *SafeNodataMap) Retain(ids map[int64]struct{}) {
+	this.Lock()
+	defer this.Unlock()
+
+	for sid := range this.M {
+		if _, exists := ids[sid]; !exists {
+			delete(this.M, sid)
+		}
+	}
+}
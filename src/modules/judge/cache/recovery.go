@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// 记录处于告警状态的series开始恢复正常的时间，key是event.ID
+// 和LastEvents分开存放，LastEvents被清理或覆盖时不影响恢复的判断
+type SafeRecoveryMap struct {
+	sync.RWMutex
+	M map[string]int64
+}
+
+var (
+	RecoveryStates = NewSafeRecoveryMap()
+)
+
+func NewSafeRecoveryMap() *SafeRecoveryMap {
+	return &SafeRecoveryMap{M: make(map[string]int64)}
+}
+
+func (this *SafeRecoveryMap) Get(key string) (int64, bool) {
+	this.RLock()
+	defer this.RUnlock()
+	ts, exists := this.M[key]
+	return ts, exists
+}
+
+func (this *SafeRecoveryMap) Set(key string, ts int64) {
+	this.Lock()
+	defer this.Unlock()
+	this.M[key] = ts
+}
+
+func (this *SafeRecoveryMap) Delete(key string) {
+	this.Lock()
+	defer this.Unlock()
+	delete(this.M, key)
+}
+
+func (this *SafeRecoveryMap) Len() int {
+	this.RLock()
+	defer this.RUnlock()
+	return len(this.M)
+}
+
+// 清理很久没有更新的series，防止series消失之后状态一直残留
+func (this *SafeRecoveryMap) CleanStale(before int64) {
+	this.Lock()
+	defer this.Unlock()
+	for key, ts := range this.M {
+		if ts < before {
+			delete(this.M, key)
+		}
+	}
+}
+
+func (this *SafeRecoveryMap) CleanLoop() {
+	t1 := time.NewTicker(time.Duration(600) * time.Second)
+	for {
+		<-t1.C
+		this.CleanStale(time.Now().Unix() - 86400)
+	}
+}
@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+// Snapshot 告警状态的快照，用于judge重启后恢复，以及hash环变化时交接给新的judge
+type Snapshot struct {
+	Ts       int64                           `json:"ts"`
+	Events   map[string]*dataobj.Event       `json:"events"`   // key是event.ID
+	Recovery map[string]int64                `json:"recovery"` // key是event.ID
+	Flaps    map[string]*FlapState           `json:"flaps"`    // key是event.ID
+	History  map[string][]*dataobj.JudgeItem `json:"history"`  // key是JudgeItem.MD5()，新数据在前
+}
+
+// TakeSnapshot filter为nil时导出全部策略的状态，否则只导出filter返回true的策略
+func TakeSnapshot(ts int64, filter func(sid int64) bool) *Snapshot {
+	snap := &Snapshot{
+		Ts:       ts,
+		Events:   make(map[string]*dataobj.Event),
+		Recovery: make(map[string]int64),
+		Flaps:    make(map[string]*FlapState),
+		History:  make(map[string][]*dataobj.JudgeItem),
+	}
+
+	LastEvents.RLock()
+	for id, event := range LastEvents.M {
+		if filter == nil || filter(event.Sid) {
+			snap.Events[id] = event
+		}
+	}
+	LastEvents.RUnlock()
+
+	RecoveryStates.RLock()
+	for id, since := range RecoveryStates.M {
+		if filter == nil || filter(sidOfEventId(id)) {
+			snap.Recovery[id] = since
+		}
+	}
+	RecoveryStates.RUnlock()
+
+	FlapStates.RLock()
+	for id, state := range FlapStates.M {
+		if filter == nil || filter(sidOfEventId(id)) {
+			changes := make([]int64, len(state.Changes))
+			copy(changes, state.Changes)
+			snap.Flaps[id] = &FlapState{Changes: changes, Flapping: state.Flapping}
+		}
+	}
+	FlapStates.RUnlock()
+
+	for _, historyMap := range HistoryBigMap {
+		historyMap.RLock()
+		for key, L := range historyMap.M {
+			items := L.Items()
+			if len(items) == 0 {
+				continue
+			}
+
+			if filter == nil || filter(items[0].Sid) {
+				snap.History[key] = items
+			}
+		}
+		historyMap.RUnlock()
+	}
+
+	return snap
+}
+
+// Restore 把快照合并到内存中，内存中已有更新的状态时以内存为准
+func (snap *Snapshot) Restore() {
+	for id, event := range snap.Events {
+		event.ID = id
+		last, exists := LastEvents.Get(id)
+		if exists && last.Etime >= event.Etime {
+			continue
+		}
+		LastEvents.Set(id, event)
+	}
+
+	for id, since := range snap.Recovery {
+		if _, exists := RecoveryStates.Get(id); exists {
+			continue
+		}
+		RecoveryStates.Set(id, since)
+	}
+
+	FlapStates.Lock()
+	for id, state := range snap.Flaps {
+		if _, exists := FlapStates.M[id]; exists || state == nil {
+			continue
+		}
+		FlapStates.M[id] = state
+	}
+	FlapStates.Unlock()
+
+	for key, items := range snap.History {
+		if len(key) < 2 || len(items) == 0 {
+			continue
+		}
+
+		historyMap, exists := HistoryBigMap[key[0:2]]
+		if !exists {
+			continue
+		}
+
+		L, exists := historyMap.Get(key)
+		if !exists {
+			L = &SafeLinkedList{L: list.New()}
+			historyMap.Set(key, L)
+		}
+		L.PushBackOlder(items)
+	}
+}
+
+// Drop 删除指定策略的状态，状态交接给其他judge之后调用
+func Drop(filter func(sid int64) bool) {
+	LastEvents.Lock()
+	for id, event := range LastEvents.M {
+		if filter(event.Sid) {
+			delete(LastEvents.M, id)
+		}
+	}
+	LastEvents.Unlock()
+
+	RecoveryStates.Lock()
+	for id := range RecoveryStates.M {
+		if filter(sidOfEventId(id)) {
+			delete(RecoveryStates.M, id)
+		}
+	}
+	RecoveryStates.Unlock()
+
+	FlapStates.Lock()
+	for id := range FlapStates.M {
+		if filter(sidOfEventId(id)) {
+			delete(FlapStates.M, id)
+		}
+	}
+	FlapStates.Unlock()
+
+	for _, historyMap := range HistoryBigMap {
+		keys := []string{}
+		historyMap.RLock()
+		for key, L := range historyMap.M {
+			front := L.Front()
+			if front == nil {
+				continue
+			}
+
+			if filter(front.Value.(*dataobj.JudgeItem).Sid) {
+				keys = append(keys, key)
+			}
+		}
+		historyMap.RUnlock()
+
+		historyMap.BatchDelete(keys)
+	}
+}
+
+// event.ID的格式为 s_{sid}_{primaryKey}
+func sidOfEventId(id string) int64 {
+	arr := strings.SplitN(id, "_", 3)
+	if len(arr) < 3 {
+		return 0
+	}
+
+	sid, _ := strconv.ParseInt(arr[1], 10, 64)
+	return sid
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+func resetStates() {
+	LastEvents = &SafeEventMap{M: make(map[string]*dataobj.Event)}
+	RecoveryStates = NewSafeRecoveryMap()
+	FlapStates = NewSafeFlapMap()
+	InitHistoryBigMap()
+}
+
+func pushHistory(item *dataobj.JudgeItem) {
+	key := item.MD5()
+	L, exists := HistoryBigMap[key[0:2]].Get(key)
+	if !exists {
+		L = &SafeLinkedList{L: list.New()}
+		HistoryBigMap[key[0:2]].Set(key, L)
+	}
+	L.PushFrontAndMaintain(item, 10)
+}
+
+func historyOf(item *dataobj.JudgeItem) []*dataobj.JudgeItem {
+	key := item.MD5()
+	L, exists := HistoryBigMap[key[0:2]].Get(key)
+	if !exists {
+		return nil
+	}
+	return L.Items()
+}
+
+// 策略1和策略2各有一个series
+func initStates() (*dataobj.JudgeItem, *dataobj.JudgeItem) {
+	resetStates()
+
+	LastEvents.Set("s_1_a", &dataobj.Event{Sid: 1, EventType: "alert", Etime: 100})
+	LastEvents.Set("s_2_b", &dataobj.Event{Sid: 2, EventType: "alert", Etime: 100})
+	RecoveryStates.Set("s_1_a", 90)
+	RecoveryStates.Set("s_2_b", 90)
+	FlapStates.M["s_1_a"] = &FlapState{Changes: []int64{80, 90}, Flapping: true}
+	FlapStates.M["s_2_b"] = &FlapState{Changes: []int64{80}}
+
+	item1 := &dataobj.JudgeItem{Endpoint: "h1", Metric: "cpu.idle", Sid: 1}
+	item2 := &dataobj.JudgeItem{Endpoint: "h2", Metric: "cpu.idle", Sid: 2}
+	for ts := int64(60); ts <= 100; ts += 20 {
+		i1, i2 := *item1, *item2
+		i1.Timestamp, i2.Timestamp = ts, ts
+		pushHistory(&i1)
+		pushHistory(&i2)
+	}
+	return item1, item2
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	item1, item2 := initStates()
+
+	snap := TakeSnapshot(100, func(sid int64) bool { return sid == 1 })
+	bs, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resetStates()
+	var restored Snapshot
+	if err := json.Unmarshal(bs, &restored); err != nil {
+		t.Fatal(err)
+	}
+	restored.Restore()
+
+	if event, exists := LastEvents.Get("s_1_a"); !exists || event.ID != "s_1_a" || event.Etime != 100 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if since, exists := RecoveryStates.Get("s_1_a"); !exists || since != 90 {
+		t.Fatalf("unexpected recovery %d", since)
+	}
+	if !FlapStates.IsFlapping("s_1_a") || len(FlapStates.M["s_1_a"].Changes) != 2 {
+		t.Fatalf("unexpected flap state %+v", FlapStates.M["s_1_a"])
+	}
+	if items := historyOf(item1); len(items) != 3 || items[0].Timestamp != 100 || items[2].Timestamp != 60 {
+		t.Fatalf("unexpected history %v", items)
+	}
+
+	// 没有被选中的策略不在快照中
+	if _, exists := LastEvents.Get("s_2_b"); exists || FlapStates.Len() != 1 || RecoveryStates.Len() != 1 {
+		t.Fatal("sid 2 should not be restored")
+	}
+	if items := historyOf(item2); len(items) != 0 {
+		t.Fatalf("sid 2 history should not be restored, got %v", items)
+	}
+}
+
+// 内存中已有更新的状态时以内存为准，历史数据只补充更老的点
+func TestSnapshotRestoreMerge(t *testing.T) {
+	item1, _ := initStates()
+	snap := TakeSnapshot(100, nil)
+
+	resetStates()
+	LastEvents.Set("s_1_a", &dataobj.Event{Sid: 1, EventType: "recovery", Etime: 200})
+	FlapStates.M["s_1_a"] = &FlapState{Changes: []int64{150}}
+	latest := *item1
+	latest.Timestamp = 120
+	pushHistory(&latest)
+
+	snap.Restore()
+
+	if event, _ := LastEvents.Get("s_1_a"); event.EventType != "recovery" {
+		t.Fatalf("newer event should be kept, got %+v", event)
+	}
+	if FlapStates.IsFlapping("s_1_a") {
+		t.Fatal("flap state in memory should be kept")
+	}
+	if event, exists := LastEvents.Get("s_2_b"); !exists || event.ID != "s_2_b" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if items := historyOf(item1); len(items) != 4 || items[0].Timestamp != 120 || items[3].Timestamp != 60 {
+		t.Fatalf("unexpected history %v", items)
+	}
+}
+
+func TestSnapshotDrop(t *testing.T) {
+	item1, item2 := initStates()
+
+	Drop(func(sid int64) bool { return sid == 1 })
+
+	if _, exists := LastEvents.Get("s_1_a"); exists {
+		t.Fatal("event of sid 1 should be dropped")
+	}
+	if _, exists := RecoveryStates.Get("s_1_a"); exists || FlapStates.Len() != 1 {
+		t.Fatal("recovery and flap state of sid 1 should be dropped")
+	}
+	if items := historyOf(item1); len(items) != 0 {
+		t.Fatalf("history of sid 1 should be dropped, got %v", items)
+	}
+
+	if _, exists := LastEvents.Get("s_2_b"); !exists || FlapStates.M["s_2_b"] == nil {
+		t.Fatal("states of sid 2 should be kept")
+	}
+	if items := historyOf(item2); len(items) != 3 {
+		t.Fatalf("history of sid 2 should be kept, got %v", items)
+	}
+}
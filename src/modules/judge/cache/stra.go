@@ -9,6 +9,7 @@ import (
 
 var Strategy *StrategyMap
 var NodataStra *StrategyMap
+var AggrStra *StrategyMap
 
 type StrategyMap struct {
 	sync.RWMutex
@@ -39,6 +40,13 @@ func (s *StrategyMap) Get(id int64) (*model.Stra, bool) {
 	return stra, exists
 }
 
+func (s *StrategyMap) Delete(id int64) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.Data, id)
+	delete(s.TS, id)
+}
+
 func (s *StrategyMap) GetAll() []*model.Stra {
 	s.RLock()
 	defer s.RUnlock()
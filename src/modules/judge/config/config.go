@@ -7,6 +7,9 @@ import (
 
 	"github.com/didi/nightingale/src/modules/judge/backend/query"
 	"github.com/didi/nightingale/src/modules/judge/backend/redi"
+	"github.com/didi/nightingale/src/modules/judge/backend/sink"
+	"github.com/didi/nightingale/src/modules/judge/judge"
+	"github.com/didi/nightingale/src/modules/judge/snapshot"
 	"github.com/didi/nightingale/src/modules/judge/stra"
 	"github.com/didi/nightingale/src/toolkits/address"
 	"github.com/didi/nightingale/src/toolkits/identity"
@@ -18,14 +21,18 @@ import (
 )
 
 type ConfYaml struct {
-	Logger            logger.LoggerSection     `yaml:"logger"`
-	Query             query.SeriesQuerySection `yaml:"query"`
-	Redis             redi.RedisSection        `yaml:"redis"`
-	Strategy          stra.StrategySection     `yaml:"strategy"`
-	Identity          identity.IdentitySection `yaml:"identity"`
-	Report            report.ReportSection     `yaml:"report"`
-	NodataConcurrency int                      `yaml:"nodataConcurrency"`
-	PushUrl           string                   `yaml:"pushUrl"`
+	Logger             logger.LoggerSection     `yaml:"logger"`
+	Query              query.SeriesQuerySection `yaml:"query"`
+	Redis              redi.RedisSection        `yaml:"redis"`
+	Sink               sink.SinkSection         `yaml:"sink"`
+	Strategy           stra.StrategySection     `yaml:"strategy"`
+	Snapshot           snapshot.SnapshotSection `yaml:"snapshot"`
+	Flap               judge.FlapSection        `yaml:"flap"`
+	Identity           identity.IdentitySection `yaml:"identity"`
+	Report             report.ReportSection     `yaml:"report"`
+	NodataConcurrency  int                      `yaml:"nodataConcurrency"`
+	NodataSeriesExpire int                      `yaml:"nodataSeriesExpire"`
+	PushUrl            string                   `yaml:"pushUrl"`
 }
 
 var (
@@ -60,8 +67,33 @@ func Parse(conf string) error {
 		"write": 3000,
 	})
 
+	viper.SetDefault("sink", map[string]interface{}{
+		"queueSize": 102400,
+		"spool": map[string]interface{}{
+			"enabled":     false,
+			"dir":         "data/judge/sink",
+			"segmentSize": 64,   //单个segment文件大小，单位MB
+			"maxSize":     1024, //每个sink磁盘占用上限，单位MB
+		},
+		"redis": map[string]interface{}{
+			"enabled": true,
+			"retry":   map[string]int{"times": 0, "interval": 1000},
+		},
+		"webhook": map[string]interface{}{
+			"enabled": false,
+			"timeout": 3000,
+			"retry":   map[string]int{"times": 3, "interval": 1000},
+		},
+		"file": map[string]interface{}{
+			"enabled": false,
+			"dir":     "data/judge/events",
+			"retry":   map[string]int{"times": 3, "interval": 1000},
+		},
+	})
+
 	viper.SetDefault("strategy", map[string]interface{}{
 		"partitionApi":   "/api/portal/stras/effective?instance=%s:%s",
+		"ownerApi":       "/api/portal/stras/effective?all=1",
 		"updateInterval": 9000,
 		"indexInterval":  60000,
 		"timeout":        5000,
@@ -76,7 +108,20 @@ func Parse(conf string) error {
 		"remark":   "",
 	})
 
+	viper.SetDefault("snapshot", map[string]interface{}{
+		"enabled":        true,
+		"dir":            "data/judge",
+		"interval":       60000,
+		"handoffTimeout": 5000,
+	})
+
+	viper.SetDefault("flap", map[string]interface{}{
+		"window":    3600,
+		"threshold": 0,
+	})
+
 	viper.SetDefault("nodataConcurrency", 1000)
+	viper.SetDefault("nodataSeriesExpire", 86400)
 	viper.SetDefault("pushUrl", "http://127.0.0.1:2058/api/collector/push")
 
 	err = viper.Unmarshal(&Config)
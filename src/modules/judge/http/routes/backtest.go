@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/judge/judge"
+	"github.com/didi/nightingale/src/toolkits/http/render"
+)
+
+type backtestReq struct {
+	Stra  *model.Stra `json:"stra"`
+	Start int64       `json:"start"`
+	End   int64       `json:"end"`
+}
+
+func backtest(c *gin.Context) {
+	var req backtestReq
+	errors.Dangerous(c.ShouldBindJSON(&req))
+	if req.Stra == nil {
+		errors.Bomb("stra is null")
+	}
+
+	list, err := judge.Backtest(req.Stra, req.Start, req.End)
+	render.Data(c, list, err)
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/didi/nightingale/src/modules/judge/judge"
+	"github.com/didi/nightingale/src/toolkits/http/render"
+)
+
+func straList(c *gin.Context) {
+	render.Data(c, judge.StraSummaries(), nil)
+}
+
+func straSeries(c *gin.Context) {
+	sid := urlParamInt64(c, "sid")
+	endpoint := queryStr(c, "endpoint", "")
+	metric := mustQueryStr(c, "metric")
+	tags := queryStr(c, "tags", "")
+
+	ret, err := judge.DebugSeries(sid, endpoint, metric, tags, time.Now().Unix())
+	render.Data(c, ret, err)
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+)
+
+func urlParamStr(c *gin.Context, field string) string {
+	val := c.Param(field)
+
+	if val == "" {
+		errors.Bomb("[%s] is blank", field)
+	}
+
+	return val
+}
+
+func urlParamInt64(c *gin.Context, field string) int64 {
+	strval := urlParamStr(c, field)
+	intval, err := strconv.ParseInt(strval, 10, 64)
+	if err != nil {
+		errors.Bomb("cannot convert %s to int64", strval)
+	}
+
+	return intval
+}
+
+func queryStr(c *gin.Context, key string, defaultVal string) string {
+	val := c.Query(key)
+	if val == "" {
+		return defaultVal
+	}
+
+	return val
+}
+
+func mustQueryStr(c *gin.Context, key string) string {
+	val := c.Query(key)
+	if val == "" {
+		errors.Bomb("arg[%s] not found", key)
+	}
+
+	return val
+}
@@ -14,5 +14,12 @@ func Config(r *gin.Engine) {
 		sys.GET("/addr", addr)
 	}
 
+	judge := r.Group("/api/judge")
+	{
+		judge.POST("/backtest", backtest)
+		judge.GET("/stras", straList)
+		judge.GET("/stra/:sid/series", straSeries)
+	}
+
 	pprof.Register(r, "/api/judge/debug/pprof")
 }
@@ -14,11 +14,13 @@ import (
 
 	"github.com/didi/nightingale/src/modules/judge/backend/query"
 	"github.com/didi/nightingale/src/modules/judge/backend/redi"
+	"github.com/didi/nightingale/src/modules/judge/backend/sink"
 	"github.com/didi/nightingale/src/modules/judge/cache"
 	"github.com/didi/nightingale/src/modules/judge/config"
 	"github.com/didi/nightingale/src/modules/judge/http/routes"
 	"github.com/didi/nightingale/src/modules/judge/judge"
 	"github.com/didi/nightingale/src/modules/judge/rpc"
+	"github.com/didi/nightingale/src/modules/judge/snapshot"
 	"github.com/didi/nightingale/src/modules/judge/stra"
 	"github.com/didi/nightingale/src/toolkits/http"
 	"github.com/didi/nightingale/src/toolkits/identity"
@@ -63,17 +65,29 @@ func main() {
 	go stats.Init("n9e.judge")
 
 	query.Init(cfg.Query)
-	redi.Init(cfg.Redis)
+	if cfg.Sink.Redis.Enabled {
+		redi.Init(cfg.Redis)
+	}
+	sink.Init(cfg.Sink)
 
 	cache.InitHistoryBigMap()
 	cache.Strategy = cache.NewStrategyMap()
 	cache.NodataStra = cache.NewStrategyMap()
+	cache.AggrStra = cache.NewStrategyMap()
 	cache.SeriesMap = cache.NewIndexMap()
+	go cache.LastEvents.CleanLoop()
+	go cache.RecoveryStates.CleanLoop()
+	go cache.FlapStates.CleanLoop()
+
+	snapshot.Init(cfg.Snapshot)
+	go snapshot.SaveLoop()
 
 	go rpc.Start()
 
 	go stra.GetStrategy(cfg.Strategy)
-	go judge.NodataJudge(cfg.NodataConcurrency)
+	judge.InitFlap(cfg.Flap)
+	go judge.NodataJudge(cfg.NodataConcurrency, cfg.NodataSeriesExpire)
+	go judge.AggrJudge()
 	go report.Init(cfg.Report, "monapi")
 
 	r := gin.New()
@@ -128,6 +142,10 @@ func ending() {
 
 	logger.Close()
 	http.Shutdown()
+	if err := snapshot.Save(); err != nil {
+		fmt.Println("save snapshot fail:", err)
+	}
+	sink.Close()
 	redi.CloseRedis()
 	fmt.Println("alarm stopped successfully")
 }
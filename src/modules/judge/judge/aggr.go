@@ -0,0 +1,137 @@
+package judge
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/judge/backend/query"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/calc"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// AggrJudge 集群策略没有上报点触发，和nodata一样定时查询所有endpoint的数据做判断
+func AggrJudge() {
+	t1 := time.NewTicker(time.Duration(9000) * time.Millisecond)
+	aggrJudge()
+	for {
+		<-t1.C
+		aggrJudge()
+	}
+}
+
+// 每个集群策略最近一次聚合用到的series数量，调试接口展示
+var aggrSeriesCount = struct {
+	sync.RWMutex
+	m map[int64]int
+}{m: make(map[int64]int)}
+
+func getAggrSeriesCount(sid int64) int {
+	aggrSeriesCount.RLock()
+	defer aggrSeriesCount.RUnlock()
+	return aggrSeriesCount.m[sid]
+}
+
+func aggrJudge() {
+	stras := cache.AggrStra.GetAll()
+	counts := make(map[int64]int, len(stras))
+	for _, stra := range stras {
+		now := time.Now().Unix()
+		series, _, err := getSeries(stra, stra.Exprs[0].Metric, stra.Endpoints, now)
+		if err != nil {
+			logger.Errorf("stra:%v get aggr series err:%v", stra.Id, err)
+			continue
+		}
+		counts[stra.Id] = len(series)
+
+		historyData, item, err := GetAggrData(stra, series, now)
+		if err != nil {
+			logger.Errorf("stra:%v get aggr data err:%v", stra.Id, err)
+			continue
+		}
+
+		stats.Counter.Set("aggr.judge", 1)
+		Judge(stra, stra.Exprs, historyData, item, now, []dataobj.History{}, "", "")
+	}
+
+	aggrSeriesCount.Lock()
+	aggrSeriesCount.m = counts
+	aggrSeriesCount.Unlock()
+}
+
+// GetAggrData 把策略关联的所有series聚合成一条曲线，按照从新到旧返回，和SafeLinkedList.HistoryData的顺序一致
+func GetAggrData(stra *model.Stra, series []cache.Series, now int64) ([]*dataobj.RRDData, *dataobj.JudgeItem, error) {
+	exp := stra.Exprs[0]
+	if len(series) == 0 {
+		return nil, nil, fmt.Errorf("series of %s is null", exp.Metric)
+	}
+
+	step := series[0].Step
+	// 最新一个周期的数据可能还没有全部上报，不参与聚合，否则sum之类的值会偏小
+	end := now - int64(step)
+	start := end - int64(stra.AlertDur) - int64(step) + 1
+
+	respData, err := query.Query(buildReqs(series, start, end))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := aggrCompute(stra.Aggr, respData)
+	historyData := make([]*dataobj.RRDData, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		historyData = append(historyData, values[i])
+	}
+
+	needCount := stra.AlertDur / step
+	if needCount < 1 {
+		needCount = 1
+	}
+	if len(historyData) > needCount {
+		historyData = historyData[:needCount]
+	}
+
+	item := aggrItem(stra, step)
+	return historyData, &item, nil
+}
+
+// 集群策略的event不属于某个endpoint，endpoint为空，由monapi补全为节点
+func aggrItem(stra *model.Stra, step int) dataobj.JudgeItem {
+	return dataobj.JudgeItem{
+		Metric:  stra.Exprs[0].Metric,
+		Tags:    "aggr=" + stra.Aggr.Func,
+		TagsMap: map[string]string{"aggr": stra.Aggr.Func},
+		DsType:  "GAUGE",
+		Step:    step,
+		Sid:     stra.Id,
+	}
+}
+
+// 按时间升序返回聚合之后的曲线
+func aggrCompute(aggr model.StraAggr, datas []*dataobj.TsdbQueryResponse) []*dataobj.RRDData {
+	if aggr.Func != "ratio" {
+		return calc.Compute(aggr.Func, datas)
+	}
+
+	// 和其他聚合函数使用相同的时间戳对齐规则
+	var values dataobj.RRDValues
+	for ts, vs := range calc.Collect(datas) {
+		matched := 0
+		for _, v := range vs {
+			if checkIsTriggered(dataobj.JsonFloat(v), aggr.Eopt, aggr.Threshold) {
+				matched++
+			}
+		}
+		values = append(values, &dataobj.RRDData{
+			Timestamp: ts,
+			Value:     dataobj.JsonFloat(float64(matched) * 100 / float64(len(vs))),
+		})
+	}
+	sort.Sort(values)
+	return values
+}
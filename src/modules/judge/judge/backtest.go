@@ -0,0 +1,209 @@
+package judge
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/str"
+)
+
+// 单次回放的最大时间范围，避免一次查询过多的历史数据
+const maxBacktestRange = 7 * 86400
+
+// nodata的series查不到step时，按照这个间隔判断
+const defaultNodataStep = 60
+
+type BacktestEvent struct {
+	Etime     int64  `json:"etime"`
+	EventType string `json:"event_type"`
+	Value     string `json:"value"`
+	Info      string `json:"info"`
+}
+
+type BacktestSeries struct {
+	Endpoint string            `json:"endpoint"`
+	Tags     map[string]string `json:"tags"`
+	Events   []*BacktestEvent  `json:"events"`
+}
+
+// Backtest 用历史数据回放策略，返回每个series在[start, end]之间会产生的告警和恢复event
+// 回放使用独立的告警状态和series缓存，不会推送event，也不影响线上的判断
+func Backtest(stra *model.Stra, start, end int64) ([]*BacktestSeries, error) {
+	if len(stra.Exprs) == 0 {
+		return nil, fmt.Errorf("stra exprs is null")
+	}
+
+	if start >= end {
+		return nil, fmt.Errorf("illegal time range [%d, %d]", start, end)
+	}
+
+	if end-start > maxBacktestRange {
+		return nil, fmt.Errorf("time range too large, max %ds", maxBacktestRange)
+	}
+
+	if len(stra.Endpoints) == 0 {
+		return nil, fmt.Errorf("stra endpoints is null")
+	}
+
+	exp := stra.Exprs[0]
+	series, lostSeries, err := getSeries(stra, exp.Metric, stra.Endpoints, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多查一个告警周期的数据，start时刻就有足够的点参与计算
+	reqs := buildReqs(append(series, lostSeries...), start-int64(stra.AlertDur), end)
+	if len(reqs) == 0 {
+		return []*BacktestSeries{}, nil
+	}
+
+	result := newBacktestResult()
+	state := NewState(result.record)
+	respData, err := state.Query(reqs)
+	if err != nil {
+		return nil, err
+	}
+	if stra.IsAggr() {
+		if len(series) == 0 {
+			return []*BacktestSeries{}, nil
+		}
+		// 集群策略先聚合成一条曲线再回放
+		backtestSeries(state, stra, aggrItem(stra, series[0].Step), aggrCompute(stra.Aggr, respData), start)
+		return result.list(), nil
+	}
+
+	for _, data := range respData {
+		if data.Endpoint == "" {
+			continue
+		}
+
+		tags := getTags(data.Counter)
+		item := dataobj.JudgeItem{
+			Endpoint: data.Endpoint,
+			Metric:   exp.Metric,
+			Tags:     tags,
+			TagsMap:  str.DictedTagstring(tags),
+			DsType:   "GAUGE", // 查询出来的数据已经是计算过的值
+			Step:     data.Step,
+			Sid:      stra.Id,
+		}
+
+		values := sortedValues(data.Values)
+		if exp.Func == "nodata" {
+			backtestNodata(state, stra, item, values, start, end)
+		} else {
+			backtestSeries(state, stra, item, values, start)
+		}
+	}
+
+	return result.list(), nil
+}
+
+// 按照数据点的时间逐个回放，和线上收到transfer推送的点之后的处理保持一致
+func backtestSeries(state *State, stra *model.Stra, item dataobj.JudgeItem, values []*dataobj.RRDData, start int64) {
+	if item.Step <= 0 {
+		return
+	}
+
+	needCount := stra.AlertDur / item.Step
+	if needCount < 1 {
+		needCount = 1
+	}
+
+	linkedList := &cache.SafeLinkedList{L: list.New()}
+	for _, v := range values {
+		if math.IsNaN(float64(v.Value)) {
+			continue
+		}
+
+		val := item
+		val.Timestamp = v.Timestamp
+		val.Value = float64(v.Value)
+		if !linkedList.PushFrontAndMaintain(&val, needCount) || v.Timestamp < start {
+			continue
+		}
+
+		historyData, isEnough := linkedList.HistoryData(needCount)
+		if !isEnough {
+			continue
+		}
+
+		// Judge在与条件下会修改firstItem，每次传入一份拷贝
+		firstItem := val
+		judgeWithState(state, stra, stra.Exprs, historyData, &firstItem, v.Timestamp, []dataobj.History{}, "", "")
+	}
+}
+
+// nodata按照固定的间隔回放，每次取最近一个告警周期内的数据
+func backtestNodata(state *State, stra *model.Stra, item dataobj.JudgeItem, values []*dataobj.RRDData, start, end int64) {
+	step := int64(item.Step)
+	if step <= 0 {
+		step = defaultNodataStep
+	}
+
+	for now := start; now <= end; now += step {
+		window := []*dataobj.RRDData{}
+		for i := len(values) - 1; i >= 0; i-- {
+			if values[i].Timestamp > now {
+				continue
+			}
+			if values[i].Timestamp <= now-int64(stra.AlertDur) {
+				break
+			}
+			window = append(window, values[i])
+		}
+
+		firstItem := item
+		judgeWithState(state, stra, stra.Exprs, window, &firstItem, now, []dataobj.History{}, "", "")
+	}
+}
+
+// 查询结果按时间升序排列
+func sortedValues(values []*dataobj.RRDData) []*dataobj.RRDData {
+	vs := make([]*dataobj.RRDData, len(values))
+	copy(vs, values)
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].Timestamp < vs[j].Timestamp })
+	return vs
+}
+
+type backtestResult struct {
+	keys   []string
+	series map[string]*BacktestSeries
+}
+
+func newBacktestResult() *backtestResult {
+	return &backtestResult{series: make(map[string]*BacktestSeries)}
+}
+
+func (r *backtestResult) record(event *dataobj.Event) {
+	s, exists := r.series[event.ID]
+	if !exists {
+		s = &BacktestSeries{Endpoint: event.Endpoint, Events: []*BacktestEvent{}}
+		if len(event.History) > 0 {
+			s.Tags = event.History[0].Tags
+		}
+		r.series[event.ID] = s
+		r.keys = append(r.keys, event.ID)
+	}
+
+	s.Events = append(s.Events, &BacktestEvent{
+		Etime:     event.Etime,
+		EventType: event.EventType,
+		Value:     event.Value,
+		Info:      event.Info,
+	})
+}
+
+func (r *backtestResult) list() []*BacktestSeries {
+	sort.Strings(r.keys)
+	list := make([]*BacktestSeries, 0, len(r.keys))
+	for _, key := range r.keys {
+		list = append(list, r.series[key])
+	}
+	return list
+}
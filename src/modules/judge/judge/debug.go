@@ -0,0 +1,138 @@
+package judge
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/str"
+)
+
+const (
+	STRA_NORMAL = "normal"
+	STRA_NODATA = "nodata"
+	STRA_AGGR   = "aggr"
+)
+
+type StraSummary struct {
+	Id        int64       `json:"id"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	AlertDur  int         `json:"alert_dur"`
+	Exprs     []model.Exp `json:"exprs"`
+	Endpoints int         `json:"endpoints"`
+	Series    int         `json:"series"`
+}
+
+type SeriesDebug struct {
+	Key       string             `json:"key"`
+	Type      string             `json:"type"`
+	History   []*dataobj.RRDData `json:"history"` // 从新到旧
+	IsEnough  bool               `json:"is_enough"`
+	LeftValue dataobj.JsonFloat  `json:"left_value"`
+	Triggered bool               `json:"triggered"`
+	LastEvent *dataobj.Event     `json:"last_event"`
+}
+
+// StraSummaries 列出当前judge负责的策略，以及每个策略关联的series数量
+// 普通策略统计HistoryBigMap中的series，nodata策略统计从索引学习到的series，集群策略统计最近一次聚合用到的series
+func StraSummaries() []*StraSummary {
+	counts := cache.HistorySeriesCount()
+
+	list := []*StraSummary{}
+	for _, stra := range cache.Strategy.GetAll() {
+		list = append(list, newStraSummary(stra, STRA_NORMAL, counts[stra.Id]))
+	}
+	for _, stra := range cache.NodataStra.GetAll() {
+		list = append(list, newStraSummary(stra, STRA_NODATA, len(cache.NodataSeriesMap.Get(stra.Id))))
+	}
+	for _, stra := range cache.AggrStra.GetAll() {
+		list = append(list, newStraSummary(stra, STRA_AGGR, getAggrSeriesCount(stra.Id)))
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+
+func newStraSummary(stra *model.Stra, typ string, series int) *StraSummary {
+	return &StraSummary{
+		Id:        stra.Id,
+		Name:      stra.Name,
+		Type:      typ,
+		AlertDur:  stra.AlertDur,
+		Exprs:     stra.Exprs,
+		Endpoints: len(stra.Endpoints),
+		Series:    series,
+	}
+}
+
+// DebugSeries 返回策略下某个series在judge内存中的历史数据和最近一次的event
+// 普通策略用内存中的历史数据重新计算第一个表达式的左值，不会发送event
+// 计算时使用独立的状态和策略的副本，不会修改线上的告警状态、series以及策略
+func DebugSeries(sid int64, endpoint, metric, tags string, now int64) (*SeriesDebug, error) {
+	item := &dataobj.JudgeItem{
+		Endpoint: endpoint,
+		Metric:   metric,
+		Tags:     tags,
+		TagsMap:  str.DictedTagstring(tags),
+		Sid:      sid,
+	}
+	item.Tags = str.SortedTags(item.TagsMap)
+
+	ret := &SeriesDebug{Key: item.MD5(), History: []*dataobj.RRDData{}, LeftValue: dataobj.JsonFloat(math.NaN())}
+
+	stra, exists := cache.Strategy.Get(sid)
+	if exists {
+		ret.Type = STRA_NORMAL
+	} else if stra, exists = cache.NodataStra.Get(sid); exists {
+		ret.Type = STRA_NODATA
+	} else if stra, exists = cache.AggrStra.Get(sid); exists {
+		ret.Type = STRA_AGGR
+	} else {
+		return nil, fmt.Errorf("stra:%d not found in this judge", sid)
+	}
+
+	if ret.Type == STRA_NORMAL && len(stra.Exprs) > 0 {
+		if linkedList, exists := cache.HistoryBigMap[ret.Key[0:2]].Get(ret.Key); exists {
+			debugHistory(ret, stra, item, linkedList, now)
+		}
+	}
+
+	if event, exists := cache.LastEvents.Get(fmt.Sprintf("s_%d_%s", sid, item.PrimaryKey())); exists {
+		ret.LastEvent = event
+	}
+
+	return ret, nil
+}
+
+func debugHistory(ret *SeriesDebug, stra *model.Stra, item *dataobj.JudgeItem, linkedList *cache.SafeLinkedList, now int64) {
+	items := linkedList.Items()
+	if len(items) == 0 {
+		return
+	}
+
+	// 和上报的点保持一致，event的key使用上报时的tags
+	firstItem := *items[0]
+	item.Tags = firstItem.Tags
+
+	for _, i := range items {
+		ret.History = append(ret.History, &dataobj.RRDData{Timestamp: i.Timestamp, Value: dataobj.JsonFloat(i.Value)})
+	}
+
+	if firstItem.Step <= 0 {
+		return
+	}
+	needCount := stra.AlertDur / firstItem.Step
+	if needCount < 1 {
+		needCount = 1
+	}
+
+	var historyData []*dataobj.RRDData
+	historyData, ret.IsEnough = linkedList.HistoryData(needCount)
+	debugStra := *stra
+	state := NewState(func(*dataobj.Event) {})
+	ret.LeftValue, ret.Triggered, _ = judgeItemWithStrategy(state, &debugStra, historyData, debugStra.Exprs[0], &firstItem, now)
+}
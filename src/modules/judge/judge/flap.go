@@ -0,0 +1,75 @@
+package judge
+
+import (
+	"fmt"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+// FlapSection 抖动检测，Window秒内状态变化达到Threshold次认为series在抖动，Threshold为0表示不检测
+type FlapSection struct {
+	Window    int `yaml:"window"`
+	Threshold int `yaml:"threshold"`
+}
+
+var FlapConfig FlapSection
+
+func InitFlap(cfg FlapSection) {
+	FlapConfig = cfg
+}
+
+// flapFilter 在event真正发送之前做抖动检测，返回是否还需要发送原来的event
+// 只有告警和恢复之间的切换才计入变化次数，刚进入抖动时发送一个flapping event代替，抖动期间的event都不再发送
+func flapFilter(state *State, event *dataobj.Event, changed bool) bool {
+	if FlapConfig.Threshold <= 0 {
+		return true
+	}
+
+	if !changed {
+		if state.Flaps.IsFlapping(event.ID) {
+			stats.Counter.Set("event.flapping.suppressed", 1)
+			return false
+		}
+		return true
+	}
+
+	changes, flapping := state.Flaps.Change(event.ID, event.Etime, int64(FlapConfig.Window))
+	if flapping {
+		stats.Counter.Set("event.flapping.suppressed", 1)
+		return false
+	}
+
+	if changes < FlapConfig.Threshold {
+		return true
+	}
+
+	state.Flaps.SetFlapping(event.ID, true)
+
+	flap := *event
+	flap.EventType = EVENT_FLAPPING
+	flap.Info += fmt.Sprintf(" [flapping: %d changes in %ds]", changes, FlapConfig.Window)
+	stats.Counter.Set("event.flapping", 1)
+	state.Send(&flap)
+	return false
+}
+
+// 窗口内的状态变化次数降到阈值的一半以下时认为已经稳定，按照当前的状态补发一个event
+func flapStabilize(state *State, id string, now int64) {
+	if FlapConfig.Threshold <= 0 {
+		return
+	}
+
+	if !state.Flaps.Stabilize(id, now, int64(FlapConfig.Window), FlapConfig.Threshold/2) {
+		return
+	}
+
+	lastEvent, exists := state.LastEvents.Get(id)
+	if !exists {
+		return
+	}
+
+	event := *lastEvent
+	event.Etime = now
+	state.Send(&event)
+}
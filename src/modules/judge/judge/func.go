@@ -3,14 +3,21 @@ package judge
 import (
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
 )
 
 type Function interface {
 	Compute(vs []*dataobj.RRDData) (leftValue dataobj.JsonFloat, isTriggered bool)
 }
 
+// Predictor 预测类的函数额外给出预测曲线，写入event detail的pred_points
+type Predictor interface {
+	PredPoints(vs []*dataobj.RRDData) []*dataobj.RRDData
+}
+
 type MaxFunction struct {
 	Function
 	Limit      int
@@ -319,6 +326,220 @@ func (this CAvgRateFunction) Compute(vs []*dataobj.RRDData) (leftValue dataobj.J
 	return
 }
 
+// stddev(#3) 窗口内数据的标准差
+type StddevFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this StddevFunction) Compute(vs []*dataobj.RRDData) (leftValue dataobj.JsonFloat, isTriggered bool) {
+	if len(vs) < this.Limit || this.Limit < 1 {
+		return
+	}
+
+	_, stddev := meanAndStddev(vs[:this.Limit])
+	leftValue = dataobj.JsonFloat(stddev)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// zscore(#3) 最新的点偏离窗口均值多少个标准差
+type ZScoreFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this ZScoreFunction) Compute(vs []*dataobj.RRDData) (leftValue dataobj.JsonFloat, isTriggered bool) {
+	if len(vs) < this.Limit || this.Limit < 2 {
+		return
+	}
+
+	mean, stddev := meanAndStddev(vs[:this.Limit])
+	if stddev == 0 {
+		// 窗口内数据没有波动，当前点不算偏离
+		leftValue = 0
+	} else {
+		leftValue = dataobj.JsonFloat((float64(vs[0].Value) - mean) / stddev)
+	}
+
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// p90(#3) 窗口内数据的分位值，相邻两个点之间线性插值
+type PercentileFunction struct {
+	Function
+	Limit      int
+	Percentile float64
+	Operator   string
+	RightValue float64
+}
+
+func (this PercentileFunction) Compute(vs []*dataobj.RRDData) (leftValue dataobj.JsonFloat, isTriggered bool) {
+	if len(vs) < this.Limit || this.Limit < 1 {
+		return
+	}
+
+	values := make([]float64, this.Limit)
+	for i := 0; i < this.Limit; i++ {
+		values[i] = float64(vs[i].Value)
+	}
+	sort.Float64s(values)
+
+	rank := this.Percentile / 100.0 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	value := values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+
+	leftValue = dataobj.JsonFloat(value)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// predict_linear(#3, 14400) 对窗口内的数据做线性回归，预测14400秒之后的值
+type PredictLinearFunction struct {
+	Function
+	Limit      int
+	Horizon    int
+	Operator   string
+	RightValue float64
+}
+
+// 预测曲线最多包含的预测点数
+const maxPredPoints = 60
+
+func (this PredictLinearFunction) Compute(vs []*dataobj.RRDData) (leftValue dataobj.JsonFloat, isTriggered bool) {
+	slope, intercept, ok := this.fit(vs)
+	if !ok {
+		return
+	}
+
+	leftValue = dataobj.JsonFloat(intercept + slope*float64(this.Horizon))
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// PredPoints 按时间从旧到新返回窗口内的拟合值以及之后horizon秒内的预测值
+func (this PredictLinearFunction) PredPoints(vs []*dataobj.RRDData) []*dataobj.RRDData {
+	slope, intercept, ok := this.fit(vs)
+	if !ok {
+		return nil
+	}
+
+	latest := vs[0].Timestamp
+	points := make([]*dataobj.RRDData, 0, this.Limit+maxPredPoints)
+	for i := this.Limit - 1; i >= 0; i-- {
+		x := float64(vs[i].Timestamp - latest)
+		points = append(points, dataobj.NewRRDData(vs[i].Timestamp, intercept+slope*x))
+	}
+
+	// 预测点的间隔和上报周期一致，点数过多时加大间隔
+	step := (latest - vs[this.Limit-1].Timestamp) / int64(this.Limit-1)
+	if step < 1 {
+		step = 1
+	}
+	if int64(this.Horizon)/step > maxPredPoints {
+		step = int64(this.Horizon) / maxPredPoints
+	}
+
+	for x := step; x < int64(this.Horizon); x += step {
+		points = append(points, dataobj.NewRRDData(latest+x, intercept+slope*float64(x)))
+	}
+	points = append(points, dataobj.NewRRDData(latest+int64(this.Horizon), intercept+slope*float64(this.Horizon)))
+
+	return points
+}
+
+// 最小二乘法拟合，以最新点的时间作为原点
+func (this PredictLinearFunction) fit(vs []*dataobj.RRDData) (slope, intercept float64, ok bool) {
+	if len(vs) < this.Limit || this.Limit < 2 {
+		return
+	}
+
+	latest := vs[0].Timestamp
+	var sumX, sumY, sumXY, sumXX float64
+	for i := 0; i < this.Limit; i++ {
+		x := float64(vs[i].Timestamp - latest)
+		y := float64(vs[i].Value)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(this.Limit)
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return
+	}
+
+	slope = (n*sumXY - sumX*sumY) / denominator
+	intercept = (sumY - slope*sumX) / n
+	ok = true
+	return
+}
+
+// dod_pdiff(#3) wow_pdiff(#3) 窗口均值相对1天前/7天前同一窗口均值的变化率，单位%
+type SeasonalPDiffFunction struct {
+	Function
+	Limit        int
+	Operator     string
+	RightValue   float64
+	CompareValue float64
+}
+
+func (this SeasonalPDiffFunction) Compute(vs []*dataobj.RRDData) (leftValue dataobj.JsonFloat, isTriggered bool) {
+	if len(vs) < this.Limit || this.CompareValue == 0 {
+		return
+	}
+
+	avg, ok := avgIgnoreNaN(vs[:this.Limit])
+	if !ok {
+		return
+	}
+
+	leftValue = dataobj.JsonFloat((avg - this.CompareValue) / math.Abs(this.CompareValue) * 100.0)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// 历史数据中可能有空点，计算均值时跳过
+func avgIgnoreNaN(vs []*dataobj.RRDData) (float64, bool) {
+	var sum float64
+	var count int
+	for i := range vs {
+		if math.IsNaN(float64(vs[i].Value)) {
+			continue
+		}
+		sum += float64(vs[i].Value)
+		count++
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+func meanAndStddev(vs []*dataobj.RRDData) (mean, stddev float64) {
+	var sum float64
+	for i := range vs {
+		sum += float64(vs[i].Value)
+	}
+	mean = sum / float64(len(vs))
+
+	var variance float64
+	for i := range vs {
+		variance += math.Pow(float64(vs[i].Value)-mean, 2)
+	}
+	stddev = math.Sqrt(variance / float64(len(vs)))
+	return
+}
+
 func ParseFuncFromString(str string, span []interface{}, operator string, rightValue float64) (fn Function, err error) {
 	if str == "" {
 		return nil, fmt.Errorf("func can not be null!")
@@ -352,7 +573,19 @@ func ParseFuncFromString(str string, span []interface{}, operator string, rightV
 		fn = &CAvgRateFunction{Limit: limit, CompareValue: span[1].(float64), Operator: operator, RightValue: rightValue}
 	case "c_avg_rate_abs":
 		fn = &CAvgRateAbsFunction{Limit: limit, CompareValue: span[1].(float64), Operator: operator, RightValue: rightValue}
+	case "stddev":
+		fn = &StddevFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case "zscore":
+		fn = &ZScoreFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case "dod_pdiff", "wow_pdiff":
+		fn = &SeasonalPDiffFunction{Limit: limit, CompareValue: span[1].(float64), Operator: operator, RightValue: rightValue}
+	case "predict_linear":
+		fn = &PredictLinearFunction{Limit: limit, Horizon: span[1].(int), Operator: operator, RightValue: rightValue}
 	default:
+		if percentile, ok := model.ParsePercentileFunc(str); ok {
+			fn = &PercentileFunction{Limit: limit, Percentile: percentile, Operator: operator, RightValue: rightValue}
+			return
+		}
 		err = fmt.Errorf("not_supported_method")
 	}
 
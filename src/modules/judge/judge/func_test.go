@@ -0,0 +1,164 @@
+package judge
+
+import (
+	"math"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+)
+
+// values按从新到旧排列，和SafeLinkedList.HistoryData的顺序一致
+func rrdData(values ...float64) []*dataobj.RRDData {
+	vs := make([]*dataobj.RRDData, len(values))
+	for i, v := range values {
+		vs[i] = &dataobj.RRDData{Timestamp: int64(100 - i*10), Value: dataobj.JsonFloat(v)}
+	}
+	return vs
+}
+
+func TestStatisticalFunctions(t *testing.T) {
+	tests := []struct {
+		fn        string
+		values    []float64
+		eopt      string
+		threshold float64
+		left      float64
+		triggered bool
+	}{
+		{"stddev", []float64{2, 4, 4, 4, 5, 5, 7, 9}, ">", 1.5, 2, true},
+		{"stddev", []float64{5, 5, 5, 5}, ">", 0, 0, false},
+		{"zscore", []float64{9, 2, 4, 4, 4, 5, 5, 7}, ">=", 2, 2, true},
+		{"zscore", []float64{2, 4, 4, 4, 5, 5, 7, 9}, "<", -1, -1.5, true},
+		{"zscore", []float64{5, 5, 5}, ">", 1, 0, false},
+		{"p50", []float64{1, 2, 3, 4, 5}, "=", 3, 3, true},
+		{"p90", []float64{10, 1, 2, 3, 4, 5, 6, 7, 8, 9}, ">", 9, 9.1, true},
+		{"p100", []float64{3, 8, 1}, ">", 8, 8, false},
+		{"p99.9", []float64{3, 8, 1}, "<", 8, 7.99, true},
+	}
+
+	for _, tt := range tests {
+		fn, err := ParseFuncFromString(tt.fn, []interface{}{len(tt.values)}, tt.eopt, tt.threshold)
+		if err != nil {
+			t.Fatalf("%s: parse err:%v", tt.fn, err)
+		}
+
+		left, triggered := fn.Compute(rrdData(tt.values...))
+		if math.Abs(float64(left)-tt.left) > 0.0001 || triggered != tt.triggered {
+			t.Errorf("%s%v %s %v: expect (%v, %v), got (%v, %v)", tt.fn, tt.values, tt.eopt, tt.threshold, tt.left, tt.triggered, left, triggered)
+		}
+	}
+}
+
+func TestParsePercentileFunc(t *testing.T) {
+	for _, fn := range []string{"p0", "p101", "px", "p", "pdiff2"} {
+		if _, err := ParseFuncFromString(fn, []interface{}{3}, ">", 0); err == nil {
+			t.Errorf("%s should not be supported", fn)
+		}
+	}
+
+	// 点数不够时不触发
+	fn, _ := ParseFuncFromString("p90", []interface{}{5}, ">", 0)
+	if _, triggered := fn.Compute(rrdData(1, 2, 3)); triggered {
+		t.Errorf("p90 should not be triggered when points are not enough")
+	}
+}
+
+func TestPredictLinear(t *testing.T) {
+	// 每10秒增长1，最新值是90，预测100秒之后的值是100
+	vs := rrdData(90, 89, 88, 87, 86)
+	fn, err := ParseFuncFromString("predict_linear", []interface{}{5, 100}, ">=", 100)
+	if err != nil {
+		t.Fatalf("parse err:%v", err)
+	}
+
+	left, triggered := fn.Compute(vs)
+	if math.Abs(float64(left)-100) > 0.0001 || !triggered {
+		t.Fatalf("expect (100, true), got (%v, %v)", left, triggered)
+	}
+
+	points := fn.(Predictor).PredPoints(vs)
+	if len(points) != 5+10 {
+		t.Fatalf("expect 15 pred points, got %d", len(points))
+	}
+
+	last := points[len(points)-1]
+	if last.Timestamp != 200 || math.Abs(float64(last.Value)-100) > 0.0001 {
+		t.Fatalf("unexpected last pred point %v", last)
+	}
+
+	// 所有点的时间都相同时无法拟合
+	flat := []*dataobj.RRDData{{Timestamp: 10, Value: 1}, {Timestamp: 10, Value: 2}}
+	fn, _ = ParseFuncFromString("predict_linear", []interface{}{2, 100}, ">", 0)
+	if _, triggered := fn.Compute(flat); triggered {
+		t.Fatalf("should not be triggered when regression is impossible")
+	}
+}
+
+func TestSeasonalPDiff(t *testing.T) {
+	// 当前窗口均值150，1天前的均值100
+	fn, err := ParseFuncFromString("dod_pdiff", []interface{}{3, float64(100)}, ">", 40)
+	if err != nil {
+		t.Fatalf("parse err:%v", err)
+	}
+
+	left, triggered := fn.Compute(rrdData(140, math.NaN(), 160, 150))
+	if math.Abs(float64(left)-50) > 0.0001 || !triggered {
+		t.Fatalf("expect (50, true), got (%v, %v)", left, triggered)
+	}
+
+	// 同比数据为0时无法计算变化率
+	fn, _ = ParseFuncFromString("wow_pdiff", []interface{}{3, float64(0)}, ">", 40)
+	if _, triggered := fn.Compute(rrdData(140, 150, 160)); triggered {
+		t.Fatalf("should not be triggered when compare value is 0")
+	}
+}
+
+func TestAggrCompute(t *testing.T) {
+	datas := []*dataobj.TsdbQueryResponse{
+		{Endpoint: "host01", Values: []*dataobj.RRDData{{Timestamp: 10, Value: 95}, {Timestamp: 20, Value: 50}}},
+		{Endpoint: "host02", Values: []*dataobj.RRDData{{Timestamp: 10, Value: 91}, {Timestamp: 20, Value: dataobj.JsonFloat(math.NaN())}}},
+		{Endpoint: "host03", Values: []*dataobj.RRDData{{Timestamp: 10, Value: 10}, {Timestamp: 20, Value: 92}}},
+		{Endpoint: "host04", Values: []*dataobj.RRDData{{Timestamp: 10, Value: 20}, {Timestamp: 20, Value: 30}}},
+	}
+
+	sum := aggrCompute(model.StraAggr{Func: "sum"}, datas)
+	if len(sum) != 2 || sum[0].Value != 216 || sum[1].Value != 172 {
+		t.Fatalf("unexpected sum %v %v", sum[0], sum[1])
+	}
+
+	// 没有数据的series不参与计算
+	ratio := aggrCompute(model.StraAggr{Func: "ratio", Eopt: ">", Threshold: 90}, datas)
+	if len(ratio) != 2 || ratio[0].Value != 50 || math.Abs(float64(ratio[1].Value)-33.3333) > 0.001 {
+		t.Fatalf("unexpected ratio %v %v", ratio[0], ratio[1])
+	}
+}
+
+// 上报时间不一致的曲线按照step对齐之后再聚合，ratio和其他函数落在相同的时间点上
+func TestAggrComputeAlign(t *testing.T) {
+	datas := []*dataobj.TsdbQueryResponse{
+		{Endpoint: "host01", Step: 10, Values: []*dataobj.RRDData{{Timestamp: 101, Value: 95}, {Timestamp: 111, Value: 50}}},
+		{Endpoint: "host02", Step: 10, Values: []*dataobj.RRDData{{Timestamp: 104, Value: 50}, {Timestamp: 114, Value: 92}}},
+		{Endpoint: "host03", Step: 10, Values: []*dataobj.RRDData{{Timestamp: 100, Value: 30}, {Timestamp: 110, Value: 40}}},
+		{Endpoint: "host04", Step: 10, Values: []*dataobj.RRDData{{Timestamp: 109, Value: 99}, {Timestamp: 119, Value: 98}}},
+	}
+
+	sum := aggrCompute(model.StraAggr{Func: "sum"}, datas)
+	ratio := aggrCompute(model.StraAggr{Func: "ratio", Eopt: ">", Threshold: 90}, datas)
+	if len(sum) != 2 || len(ratio) != 2 {
+		t.Fatalf("expect 2 points, got sum %v ratio %v", sum, ratio)
+	}
+
+	for i, expect := range []struct {
+		ts    int64
+		sum   float64
+		ratio float64
+	}{{100, 274, 50}, {110, 280, 50}} {
+		if sum[i].Timestamp != expect.ts || ratio[i].Timestamp != expect.ts {
+			t.Fatalf("point %d: expect ts %d, got sum %v ratio %v", i, expect.ts, sum[i], ratio[i])
+		}
+		if float64(sum[i].Value) != expect.sum || float64(ratio[i].Value) != expect.ratio {
+			t.Fatalf("point %d: expect sum %v ratio %v, got %v %v", i, expect.sum, expect.ratio, sum[i].Value, ratio[i].Value)
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/didi/nightingale/src/dataobj"
 	"github.com/didi/nightingale/src/model"
 	"github.com/didi/nightingale/src/modules/judge/backend/query"
-	"github.com/didi/nightingale/src/modules/judge/backend/redi"
+	"github.com/didi/nightingale/src/modules/judge/backend/sink"
 	"github.com/didi/nightingale/src/modules/judge/cache"
 	"github.com/didi/nightingale/src/toolkits/stats"
 	"github.com/didi/nightingale/src/toolkits/str"
@@ -24,8 +24,9 @@ import (
 var (
 	bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
 
-	EVENT_ALERT   = "alert"
-	EVENT_RECOVER = "recovery"
+	EVENT_ALERT    = "alert"
+	EVENT_RECOVER  = "recovery"
+	EVENT_FLAPPING = "flapping"
 )
 
 func ToJudge(historyMap *cache.JudgeItemMap, key string, val *dataobj.JudgeItem, now int64) {
@@ -61,8 +62,18 @@ func ToJudge(historyMap *cache.JudgeItemMap, key string, val *dataobj.JudgeItem,
 }
 
 func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, firstItem *dataobj.JudgeItem, now int64, history []dataobj.History, info string, value string) {
+	judgeWithState(liveState(), stra, exps, historyData, firstItem, now, history, info, value)
+}
+
+func judgeWithState(state *State, stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, firstItem *dataobj.JudgeItem, now int64, history []dataobj.History, info string, value string) {
 	stats.Counter.Set("running", 1)
 
+	if stra.ExprsLogic != "" {
+		// 配置了条件之间的布尔组合，不再按照与条件逐个递归
+		judgeWithLogic(state, stra, historyData, firstItem, now)
+		return
+	}
+
 	if len(exps) < 1 {
 		logger.Warningf("stra:%v exp is null", stra)
 		return
@@ -71,11 +82,7 @@ func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, f
 	var leftValue dataobj.JsonFloat
 	var isTriggered bool
 
-	if exp.Func == "nodata" {
-		info += fmt.Sprintf(" %s (%s,%ds)", exp.Metric, exp.Func, stra.AlertDur)
-	} else {
-		info += fmt.Sprintf(" %s(%s,%ds) %s %v", exp.Metric, exp.Func, stra.AlertDur, exp.Eopt, exp.Threshold)
-	}
+	info += expInfo(stra, exp, itemTags(firstItem))
 
 	h := dataobj.History{
 		Metric:      exp.Metric,
@@ -87,27 +94,15 @@ func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, f
 
 	defer func() {
 		if len(exps) == 1 {
-			bytes, err := json.Marshal(history)
-			if err != nil {
-				logger.Error("Marshal history:%v err:%v", history, err)
-			}
-			event := &dataobj.Event{
-				ID:        fmt.Sprintf("s_%d_%s", stra.Id, firstItem.PrimaryKey()),
-				Etime:     now,
-				Endpoint:  firstItem.Endpoint,
-				Info:      info,
-				Detail:    string(bytes),
-				Value:     value,
-				Partition: "/n9e/event/p" + strconv.Itoa(stra.Priority),
-				Sid:       stra.Id,
-				Hashid:    getHashId(stra.Id, firstItem),
-			}
-
-			sendEventIfNeed(historyData, isTriggered, now, event)
+			event := newEvent(stra, firstItem, now, info, value, history)
+			sendEventIfNeed(state, historyData, isTriggered, now, event, stra.RecoveryDur)
 		}
 	}()
 
-	leftValue, isTriggered = judgeItemWithStrategy(stra, historyData, exps[0], firstItem, now)
+	var detail judgeDetail
+	leftValue, isTriggered, detail = judgeItemWithStrategy(state, stra, historyData, exps[0], firstItem, now)
+	history[len(history)-1].PredPoints = detail.PredPoints
+	history = append(history, detail.Compares...)
 	if !isTriggered {
 		return
 	}
@@ -121,7 +116,7 @@ func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, f
 	//与条件情况下执行
 	if len(exps) > 1 {
 		if exps[1].Func == "nodata" { //nodata重新查询索引来进行告警判断
-			respData, err := GetData(stra, exps[1], firstItem, now, false)
+			respData, err := GetData(state, stra, exps[1], firstItem, now, false)
 			if err != nil {
 				logger.Errorf("stra:%v get query data err:%v", stra, err)
 
@@ -131,7 +126,7 @@ func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, f
 					Tags:     "",
 					DsType:   "GAUGE",
 				}
-				Judge(stra, exps[1:], []*dataobj.RRDData{}, judgeItem, now, history, info, value)
+				judgeWithState(state, stra, exps[1:], []*dataobj.RRDData{}, judgeItem, now, history, info, value)
 				return
 			}
 
@@ -139,16 +134,16 @@ func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, f
 				firstItem.Endpoint = respData[i].Endpoint
 				firstItem.Tags = getTags(respData[i].Counter)
 				firstItem.Step = respData[i].Step
-				Judge(stra, exps[1:], respData[i].Values, firstItem, now, history, info, value)
+				judgeWithState(state, stra, exps[1:], respData[i].Values, firstItem, now, history, info, value)
 			}
 
 		} else {
 			var respData []*dataobj.TsdbQueryResponse
 			var err error
 			if firstItem.Step != 0 { //上报点的逻辑会走到这里，使用第一个exp上报点的索引进行告警判断
-				respData, err = GetData(stra, exps[1], firstItem, now, true)
+				respData, err = GetData(state, stra, exps[1], firstItem, now, true)
 			} else { //上一个规则是nodata没有获取到索引数据，重新获取索引做计算
-				respData, err = GetData(stra, exps[1], firstItem, now, false)
+				respData, err = GetData(state, stra, exps[1], firstItem, now, false)
 			}
 			if err != nil {
 				logger.Errorf("stra:%v get query data err:%v", stra, err)
@@ -158,13 +153,60 @@ func Judge(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, f
 				firstItem.Endpoint = respData[i].Endpoint
 				firstItem.Tags = getTags(respData[i].Counter)
 				firstItem.Step = respData[i].Step
-				Judge(stra, exps[1:], respData[i].Values, firstItem, now, history, info, value)
+				judgeWithState(state, stra, exps[1:], respData[i].Values, firstItem, now, history, info, value)
 			}
 		}
 	}
 }
 
-func judgeItemWithStrategy(stra *model.Stra, historyData []*dataobj.RRDData, exp model.Exp, firstItem *dataobj.JudgeItem, now int64) (leftValue dataobj.JsonFloat, isTriggered bool) {
+// 阈值按照series的tag覆盖之后再展示
+func expInfo(stra *model.Stra, exp model.Exp, tags map[string]string) string {
+	exp.Threshold = exp.ThresholdOf(tags)
+
+	if exp.Func == "nodata" {
+		return fmt.Sprintf(" %s (%s,%ds)", exp.Metric, exp.Func, stra.AlertDur)
+	}
+
+	if exp.Func == "predict_linear" && len(exp.Params) > 0 {
+		return fmt.Sprintf(" %s(%s,%ds,%ds) %s %v", exp.Metric, exp.Func, stra.AlertDur, exp.Params[0], exp.Eopt, exp.Threshold)
+	}
+
+	return fmt.Sprintf(" %s(%s,%ds) %s %v", exp.Metric, exp.Func, stra.AlertDur, exp.Eopt, exp.Threshold)
+}
+
+func newEvent(stra *model.Stra, firstItem *dataobj.JudgeItem, now int64, info, value string, history []dataobj.History) *dataobj.Event {
+	bytes, err := json.Marshal(history)
+	if err != nil {
+		logger.Errorf("Marshal history:%v err:%v", history, err)
+	}
+
+	return &dataobj.Event{
+		ID:        fmt.Sprintf("s_%d_%s", stra.Id, firstItem.PrimaryKey()),
+		Etime:     now,
+		Endpoint:  firstItem.Endpoint,
+		Info:      info,
+		Detail:    string(bytes),
+		Value:     value,
+		Partition: "/n9e/event/p" + strconv.Itoa(stra.Priority),
+		Sid:       stra.Id,
+		Hashid:    getHashId(stra.Id, firstItem),
+		History:   history,
+	}
+}
+
+// judgeDetail 除了计算结果之外，告警现场需要额外记录的数据
+type judgeDetail struct {
+	PredPoints []*dataobj.RRDData // 预测值
+	Compares   []dataobj.History  // 同比的历史窗口
+}
+
+// 同比函数对应的时间偏移
+var seasonalOffsets = map[string]int64{
+	"dod_pdiff": 86400,
+	"wow_pdiff": 7 * 86400,
+}
+
+func judgeItemWithStrategy(state *State, stra *model.Stra, historyData []*dataobj.RRDData, exp model.Exp, firstItem *dataobj.JudgeItem, now int64) (leftValue dataobj.JsonFloat, isTriggered bool, detail judgeDetail) {
 	straFunc := exp.Func
 
 	straParam := []interface{}{}
@@ -175,7 +217,7 @@ func judgeItemWithStrategy(stra *model.Stra, historyData []*dataobj.RRDData, exp
 	straParam = append(straParam, stra.AlertDur/int(firstItem.Step))
 
 	switch straFunc {
-	case "happen":
+	case "happen", "predict_linear":
 		if len(exp.Params) < 1 {
 			logger.Errorf("stra:%d exp:%v stra param is null", stra.Id, exp)
 			return
@@ -192,7 +234,7 @@ func judgeItemWithStrategy(stra *model.Stra, historyData []*dataobj.RRDData, exp
 			stra.AlertDur = 7 * firstItem.Step
 		}
 
-		respItems, err := GetData(stra, exp, firstItem, now-int64(exp.Params[0]), true)
+		respItems, err := GetData(state, stra, exp, firstItem, now-int64(exp.Params[0]), true)
 		if err != nil {
 			logger.Errorf("stra:%v %v get compare data err:%v", stra.Id, exp, err)
 			return
@@ -211,18 +253,58 @@ func judgeItemWithStrategy(stra *model.Stra, historyData []*dataobj.RRDData, exp
 
 		//环比数据的平均值
 		straParam = append(straParam, sum/float64(len(data.Values)))
+	case "dod_pdiff", "wow_pdiff":
+		offset := seasonalOffsets[straFunc]
+
+		cmpStra := *stra
+		if cmpStra.AlertDur < 6*firstItem.Step {
+			//查询之前的数据会被归档，保证能查到一个数据点
+			cmpStra.AlertDur = 7 * firstItem.Step
+		}
+
+		respItems, err := GetData(state, &cmpStra, exp, firstItem, now-offset, true)
+		if err != nil {
+			logger.Errorf("stra:%v %v get compare data err:%v", stra.Id, exp, err)
+			return
+		}
+
+		if len(respItems) != 1 || len(respItems[0].Values) < 1 {
+			logger.Errorf("stra:%d %v get compare data err, respItems:%v", stra.Id, exp, respItems)
+			return
+		}
+
+		data := respItems[0]
+		avg, ok := avgIgnoreNaN(data.Values)
+		if !ok {
+			logger.Warningf("stra:%d %v compare data is all NaN", stra.Id, exp)
+			return
+		}
+
+		//同比窗口的平均值
+		straParam = append(straParam, avg)
+		detail.Compares = append(detail.Compares, dataobj.History{
+			Metric:      exp.Metric,
+			Tags:        firstItem.TagsMap,
+			Granularity: data.Step,
+			Points:      data.Values,
+			Comparison:  offset,
+		})
 	}
 
-	fn, err := ParseFuncFromString(straFunc, straParam, exp.Eopt, exp.Threshold)
+	fn, err := ParseFuncFromString(straFunc, straParam, exp.Eopt, exp.ThresholdOf(itemTags(firstItem)))
 	if err != nil {
 		logger.Errorf("stra:%d %v parse func fail: %v", stra.Id, exp, err)
 		return
 	}
 
-	return fn.Compute(historyData)
+	leftValue, isTriggered = fn.Compute(historyData)
+	if predictor, ok := fn.(Predictor); ok {
+		detail.PredPoints = predictor.PredPoints(historyData)
+	}
+	return
 }
 
-func GetData(stra *model.Stra, exp model.Exp, firstItem *dataobj.JudgeItem, now int64, sameTag bool) ([]*dataobj.TsdbQueryResponse, error) {
+func GetData(state *State, stra *model.Stra, exp model.Exp, firstItem *dataobj.JudgeItem, now int64, sameTag bool) ([]*dataobj.TsdbQueryResponse, error) {
 	var reqs []*dataobj.QueryData
 	var respData []*dataobj.TsdbQueryResponse
 	var err error
@@ -241,18 +323,18 @@ func GetData(stra *model.Stra, exp model.Exp, firstItem *dataobj.JudgeItem, now
 
 		reqs = append(reqs, queryParam)
 	} else if firstItem != nil {
-		reqs, err = GetReqs(stra, exp.Metric, []string{firstItem.Endpoint}, now)
+		reqs, err = GetReqs(state, stra, exp.Metric, []string{firstItem.Endpoint}, now)
 		if err != nil {
 			return respData, err
 		}
 	} else {
-		reqs, err = GetReqs(stra, exp.Metric, stra.Endpoints, now)
+		reqs, err = GetReqs(state, stra, exp.Metric, stra.Endpoints, now)
 		if err != nil {
 			return respData, err
 		}
 	}
 
-	respData, err = query.Query(reqs)
+	respData, err = state.Query(reqs)
 	if err != nil {
 		return respData, err
 	}
@@ -263,13 +345,39 @@ func GetData(stra *model.Stra, exp model.Exp, firstItem *dataobj.JudgeItem, now
 	return respData, err
 }
 
-func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]*dataobj.QueryData, error) {
-	var reqs []*dataobj.QueryData
+func GetReqs(state *State, stra *model.Stra, metric string, endpoints []string, now int64) ([]*dataobj.QueryData, error) {
+	series, lostSeries, err := getSeries(stra, metric, endpoints, now)
+	if err != nil {
+		return []*dataobj.QueryData{}, err
+	}
 
-	req := &query.IndexReq{
-		Endpoints: endpoints,
-		Metric:    metric,
+	for _, s := range series {
+		state.Series.Set(stra.Id, str.MD5(s.Endpoint, s.Metric, s.Tag), s)
 	}
+
+	seriess := state.Series.Get(stra.Id)
+	step := 0
+	if len(seriess) > 1 {
+		step = seriess[0].Step
+	}
+
+	//防止由于差不到最新点，导致点数不够
+	start := now - int64(stra.AlertDur) - int64(step) + 1
+	reqs := buildReqs(seriess, start, now)
+	reqs = append(reqs, buildReqs(lostSeries, start, now)...)
+	return reqs, nil
+}
+
+// getSeries 根据索引查询策略关联的series，没有查到索引的 endpoint+metric 放在lostSeries中
+func getSeries(stra *model.Stra, metric string, endpoints []string, now int64) ([]cache.Series, []cache.Series, error) {
+	return getSeriesByReq(stra, &query.IndexReq{Endpoints: endpoints, Metric: metric}, now)
+}
+
+// getSeriesByReq 在req上加上策略的tag过滤条件之后查询索引
+func getSeriesByReq(stra *model.Stra, req *query.IndexReq, now int64) ([]cache.Series, []cache.Series, error) {
+	series := []cache.Series{}
+	lostSeries := []cache.Series{}
+
 	for _, tag := range stra.Tags {
 		if tag.Topt == "=" {
 			req.Include = append(req.Include, query.XCludeStruct{
@@ -286,10 +394,9 @@ func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]
 
 	indexsData, err := query.Xclude(req)
 	if err != nil {
-		return reqs, err
+		return series, lostSeries, err
 	}
 
-	lostSeries := []cache.Series{}
 	for _, index := range indexsData {
 		if index.Step == 0 {
 			//没有查到索引的 endpoint+metric 也要记录，给nodata处理
@@ -304,7 +411,6 @@ func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]
 			lostSeries = append(lostSeries, s)
 		} else {
 			if len(index.Tags) == 0 {
-				hash := str.MD5(index.Endpoint, index.Metric, "")
 				s := cache.Series{
 					Endpoint: index.Endpoint,
 					Metric:   index.Metric,
@@ -313,10 +419,9 @@ func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]
 					Dstype:   index.Dstype,
 					TS:       now,
 				}
-				cache.SeriesMap.Set(stra.Id, hash, s)
+				series = append(series, s)
 			} else {
 				for _, tag := range index.Tags {
-					hash := str.MD5(index.Endpoint, index.Metric, tag)
 					s := cache.Series{
 						Endpoint: index.Endpoint,
 						Metric:   index.Metric,
@@ -325,21 +430,17 @@ func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]
 						Dstype:   index.Dstype,
 						TS:       now,
 					}
-					cache.SeriesMap.Set(stra.Id, hash, s)
+					series = append(series, s)
 				}
-
 			}
 		}
 	}
 
-	seriess := cache.SeriesMap.Get(stra.Id)
-	step := 0
-	if len(seriess) > 1 {
-		step = seriess[0].Step
-	}
+	return series, lostSeries, nil
+}
 
-	//防止由于差不到最新点，导致点数不够
-	start := now - int64(stra.AlertDur) - int64(step) + 1
+func buildReqs(seriess []cache.Series, start, end int64) []*dataobj.QueryData {
+	reqs := make([]*dataobj.QueryData, 0, len(seriess))
 	for _, series := range seriess {
 		counter := series.Metric
 		if series.Tag != "" {
@@ -347,24 +448,7 @@ func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]
 		}
 		queryParam := &dataobj.QueryData{
 			Start:      start,
-			End:        now,
-			ConsolFunc: "AVERAGE", // 硬编码
-			Endpoints:  []string{series.Endpoint},
-			Counters:   []string{counter},
-			Step:       series.Step,
-			DsType:     series.Dstype,
-		}
-		reqs = append(reqs, queryParam)
-	}
-
-	for _, series := range lostSeries {
-		counter := series.Metric
-		if series.Tag != "" {
-			counter += "/" + series.Tag
-		}
-		queryParam := &dataobj.QueryData{
-			Start:      start,
-			End:        now,
+			End:        end,
 			ConsolFunc: "AVERAGE", // 硬编码
 			Endpoints:  []string{series.Endpoint},
 			Counters:   []string{counter},
@@ -373,16 +457,20 @@ func GetReqs(stra *model.Stra, metric string, endpoints []string, now int64) ([]
 		}
 		reqs = append(reqs, queryParam)
 	}
-
-	return reqs, nil
+	return reqs
 }
 
-func sendEventIfNeed(historyData []*dataobj.RRDData, isTriggered bool, now int64, event *dataobj.Event) {
-	lastEvent, exists := cache.LastEvents.Get(event.ID)
+func sendEventIfNeed(state *State, historyData []*dataobj.RRDData, isTriggered bool, now int64, event *dataobj.Event, recoveryDur int) {
+	flapStabilize(state, event.ID, now)
+
+	lastEvent, exists := state.LastEvents.Get(event.ID)
 	if isTriggered {
+		// 再次触发阈值，之前累计的正常时长作废
+		state.Recovery.Delete(event.ID)
+
 		event.EventType = EVENT_ALERT
 		if !exists || lastEvent.EventType[0] == 'r' {
-			sendEvent(event)
+			sendEvent(state, event)
 			return
 		}
 
@@ -392,25 +480,61 @@ func sendEventIfNeed(historyData []*dataobj.RRDData, isTriggered bool, now int64
 			return
 		}
 
-		sendEvent(event)
+		sendEvent(state, event)
 	} else {
-		// 如果LastEvent是Problem，报OK，否则啥都不做
-		if exists && lastEvent.EventType[0] == 'a' {
+		// 如果LastEvent是Problem，并且持续正常了recoveryDur秒，报OK，否则啥都不做
+		// LastEvent被清理之后，已经开始的恢复计时继续有效
+		_, recovering := state.Recovery.Get(event.ID)
+		if (exists && lastEvent.EventType[0] == 'a') || (!exists && recovering) {
+			if !needRecover(state.Recovery, event.ID, recoveryDur, now) {
+				return
+			}
+
 			event.EventType = EVENT_RECOVER
-			sendEvent(event)
+			sendEvent(state, event)
 		}
 	}
 }
 
-func sendEvent(event *dataobj.Event) {
+// recoveryDur为0表示立即产生恢复event
+func needRecover(recovery *cache.SafeRecoveryMap, id string, recoveryDur int, now int64) bool {
+	if recoveryDur <= 0 {
+		recovery.Delete(id)
+		return true
+	}
+
+	since, exists := recovery.Get(id)
+	if !exists {
+		// 第一次恢复正常，记录开始时间
+		recovery.Set(id, now)
+		return false
+	}
+
+	if now-since < int64(recoveryDur) {
+		return false
+	}
+
+	recovery.Delete(id)
+	return true
+}
+
+func sendEvent(state *State, event *dataobj.Event) {
+	// 持续告警时重复发送的alert不算状态变化
+	lastEvent, exists := state.LastEvents.Get(event.ID)
+	changed := !exists || lastEvent.EventType != event.EventType
+
 	// update last event
-	cache.LastEvents.Set(event.ID, event)
+	state.LastEvents.Set(event.ID, event)
+	if !flapFilter(state, event, changed) {
+		return
+	}
+	state.Send(event)
+}
 
+// pushEvent 交给sink异步发送，发送失败由sink重试，不影响judge的处理
+func pushEvent(event *dataobj.Event) {
 	stats.Counter.Set("event", 1)
-	err := redi.Push(event)
-	if err != nil {
-		logger.Errorf("push event:%v err:%v", event, err)
-	}
+	sink.Push(event)
 }
 
 func getHashId(sid int64, item *dataobj.JudgeItem) uint64 {
@@ -434,6 +558,13 @@ func getHashId(sid int64, item *dataobj.JudgeItem) uint64 {
 	return (hashid >> 60) ^ (hashid & 0xFFFFFFFFFFFFFFF)
 }
 
+func itemTags(item *dataobj.JudgeItem) map[string]string {
+	if len(item.TagsMap) == 0 && item.Tags != "" {
+		return str.DictedTagstring(item.Tags)
+	}
+	return item.TagsMap
+}
+
 func getTags(counter string) (tags string) {
 	idx := strings.IndexAny(counter, "/")
 	if idx == -1 {
@@ -0,0 +1,403 @@
+package judge
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/stats"
+	"github.com/didi/nightingale/src/toolkits/str"
+)
+
+func initTestStra(recoveryDur int) *model.Stra {
+	stats.Counter = stats.NewCounter("test")
+	cache.Strategy = cache.NewStrategyMap()
+	cache.LastEvents = &cache.SafeEventMap{M: make(map[string]*dataobj.Event)}
+	cache.RecoveryStates = cache.NewSafeRecoveryMap()
+
+	stra := &model.Stra{
+		Id:          1,
+		AlertDur:    30,
+		RecoveryDur: recoveryDur,
+		Exprs: []model.Exp{
+			{Eopt: ">", Func: "max", Metric: "disk.bytes.used.percent", Threshold: 90},
+		},
+	}
+	cache.Strategy.Set(stra.Id, stra)
+	return stra
+}
+
+// 按照step=10依次上报数据，返回每个点处理完之后的最后一个event类型
+func pushPoints(historyMap *cache.JudgeItemMap, start int64, values []float64) []string {
+	var types []string
+	for i, v := range values {
+		ts := start + int64(i)*10
+		item := &dataobj.JudgeItem{
+			Endpoint:  "host01",
+			Metric:    "disk.bytes.used.percent",
+			Tags:      "mount=/",
+			TagsMap:   map[string]string{"mount": "/"},
+			Value:     v,
+			Timestamp: ts,
+			DsType:    "GAUGE",
+			Step:      10,
+			Sid:       1,
+		}
+		ToJudge(historyMap, item.MD5(), item, ts)
+
+		eventType := ""
+		if event, exists := cache.LastEvents.Get("s_1_" + item.PrimaryKey()); exists {
+			eventType = event.EventType
+		}
+		types = append(types, eventType)
+	}
+	return types
+}
+
+func TestRecoveryDur(t *testing.T) {
+	initTestStra(60)
+	historyMap := cache.NewJudgeItemMap()
+
+	types := pushPoints(historyMap, 10, []float64{95, 95, 95, 50, 50, 50, 50, 50, 50, 50, 50, 50})
+	expect := []string{"", "", EVENT_ALERT,
+		EVENT_ALERT, EVENT_ALERT, // 窗口里还有异常点
+		EVENT_ALERT, // 第一次恢复正常，开始计时
+		EVENT_ALERT, EVENT_ALERT, EVENT_ALERT, EVENT_ALERT, EVENT_ALERT,
+		EVENT_RECOVER, // 持续正常60秒
+	}
+
+	for i := range expect {
+		if types[i] != expect[i] {
+			t.Fatalf("point %d: expect %q, got %q, all:%v", i, expect[i], types[i], types)
+		}
+	}
+
+	if cache.RecoveryStates.Len() != 0 {
+		t.Fatalf("recovery state should be cleaned after recovery")
+	}
+}
+
+func TestRecoveryDurReset(t *testing.T) {
+	initTestStra(60)
+	historyMap := cache.NewJudgeItemMap()
+
+	// 恢复计时过程中再次触发阈值，需要重新计时
+	types := pushPoints(historyMap, 10, []float64{95, 95, 95, 50, 50, 50, 50, 95, 50, 50, 50, 50, 50, 50, 50, 50, 50})
+	for i, eventType := range types {
+		if i < 2 {
+			continue
+		}
+
+		if i < len(types)-1 && eventType != EVENT_ALERT {
+			t.Fatalf("point %d: expect %q, got %q, all:%v", i, EVENT_ALERT, eventType, types)
+		}
+	}
+
+	if types[len(types)-1] != EVENT_RECOVER {
+		t.Fatalf("last point: expect %q, got %q, all:%v", EVENT_RECOVER, types[len(types)-1], types)
+	}
+}
+
+func TestRecoveryDurZero(t *testing.T) {
+	initTestStra(0)
+	historyMap := cache.NewJudgeItemMap()
+
+	types := pushPoints(historyMap, 10, []float64{95, 95, 95, 50, 50, 50})
+	if types[5] != EVENT_RECOVER {
+		t.Fatalf("expect recover immediately, got %v", types)
+	}
+}
+
+func TestRecoveryStateSurviveLastEventsCleanup(t *testing.T) {
+	initTestStra(60)
+	historyMap := cache.NewJudgeItemMap()
+
+	pushPoints(historyMap, 10, []float64{95, 95, 95, 50, 50, 50})
+
+	// 第一个正常的点已经开始恢复计时，然后LastEvents被清理
+	cache.LastEvents.CleanStale(1000)
+	if len(cache.LastEvents.M) != 0 || cache.RecoveryStates.Len() != 1 {
+		t.Fatalf("cleanup should only drop LastEvents, got %d events, %d recovery states", len(cache.LastEvents.M), cache.RecoveryStates.Len())
+	}
+
+	types := pushPoints(historyMap, 70, []float64{50, 50, 50, 50, 50, 50})
+	if types[4] != "" || types[5] != EVENT_RECOVER {
+		t.Fatalf("recovery should keep counting from the first healthy point, got %v", types)
+	}
+}
+
+func TestBacktestSeries(t *testing.T) {
+	stra := initTestStra(0)
+	stra.Exprs[0].Func = "all"
+
+	var values []*dataobj.RRDData
+	for i, v := range []float64{95, 95, 95, 95, 95, 50, 95, 95, 95} {
+		values = append(values, &dataobj.RRDData{Timestamp: int64(10 + i*10), Value: dataobj.JsonFloat(v)})
+	}
+
+	result := newBacktestResult()
+	item := dataobj.JudgeItem{
+		Endpoint: "host01",
+		Metric:   "disk.bytes.used.percent",
+		Tags:     "mount=/",
+		TagsMap:  map[string]string{"mount": "/"},
+		DsType:   "GAUGE",
+		Step:     10,
+		Sid:      1,
+	}
+	// 40之前的点只用来填充窗口，不产生event
+	backtestSeries(NewState(result.record), stra, item, values, 40)
+
+	list := result.list()
+	if len(list) != 1 || list[0].Tags["mount"] != "/" {
+		t.Fatalf("unexpected backtest series %v", list)
+	}
+
+	expect := []BacktestEvent{{Etime: 40, EventType: EVENT_ALERT}, {Etime: 60, EventType: EVENT_RECOVER}, {Etime: 90, EventType: EVENT_ALERT}}
+	events := list[0].Events
+	if len(events) != len(expect) {
+		t.Fatalf("expect %d events, got %d", len(expect), len(events))
+	}
+	for i := range expect {
+		if events[i].Etime != expect[i].Etime || events[i].EventType != expect[i].EventType {
+			t.Fatalf("event %d: expect %v, got %v", i, expect[i], *events[i])
+		}
+	}
+
+	if _, exists := cache.LastEvents.Get("s_1_" + item.PrimaryKey()); exists {
+		t.Fatalf("backtest should not touch the online event state")
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	stra := initTestStra(0)
+	stra.AlertDur = 10
+	stra.Exprs[0].Func = "all"
+
+	FlapConfig = FlapSection{Window: 100, Threshold: 4}
+	defer func() { FlapConfig = FlapSection{} }()
+
+	var values []*dataobj.RRDData
+	for i, v := range []float64{95, 50, 95, 50, 95, 50, 50, 50, 50, 50, 50, 50, 50, 50, 50} {
+		values = append(values, &dataobj.RRDData{Timestamp: int64(10 + i*10), Value: dataobj.JsonFloat(v)})
+	}
+
+	result := newBacktestResult()
+	item := dataobj.JudgeItem{Endpoint: "host01", Metric: "disk.bytes.used.percent", DsType: "GAUGE", Step: 10, Sid: 1}
+	backtestSeries(NewState(result.record), stra, item, values, 0)
+
+	expect := []BacktestEvent{
+		{Etime: 10, EventType: EVENT_ALERT},
+		{Etime: 20, EventType: EVENT_RECOVER},
+		{Etime: 30, EventType: EVENT_ALERT},
+		{Etime: 40, EventType: EVENT_FLAPPING}, // 第4次变化，之后的变化不再发送
+		{Etime: 140, EventType: EVENT_RECOVER}, // 窗口内只剩2次变化，按当前状态补发
+	}
+
+	list := result.list()
+	if len(list) != 1 || len(list[0].Events) != len(expect) {
+		t.Fatalf("unexpected backtest result %v", list)
+	}
+	for i := range expect {
+		event := list[0].Events[i]
+		if event.Etime != expect[i].Etime || event.EventType != expect[i].EventType {
+			t.Fatalf("event %d: expect %v, got %v", i, expect[i], *event)
+		}
+	}
+}
+
+// 持续告警时每个点都会重复发送alert，不能算作抖动
+func TestFlappingSustainedAlert(t *testing.T) {
+	stra := initTestStra(0)
+	stra.AlertDur = 10
+	stra.Exprs[0].Func = "all"
+
+	FlapConfig = FlapSection{Window: 100, Threshold: 4}
+	defer func() { FlapConfig = FlapSection{} }()
+
+	var values []*dataobj.RRDData
+	for i := 0; i < 8; i++ {
+		values = append(values, &dataobj.RRDData{Timestamp: int64(10 + i*10), Value: 95})
+	}
+
+	result := newBacktestResult()
+	item := dataobj.JudgeItem{Endpoint: "host01", Metric: "disk.bytes.used.percent", DsType: "GAUGE", Step: 10, Sid: 1}
+	state := NewState(result.record)
+	backtestSeries(state, stra, item, values, 0)
+
+	list := result.list()
+	if len(list) != 1 || len(list[0].Events) != len(values) {
+		t.Fatalf("expect %d alerts, got %v", len(values), list)
+	}
+	for i, event := range list[0].Events {
+		if event.EventType != EVENT_ALERT {
+			t.Fatalf("event %d: expect alert, got %v", i, *event)
+		}
+	}
+	if state.Flaps.IsFlapping("s_1_" + item.PrimaryKey()) {
+		t.Fatalf("sustained alert should not be flapping")
+	}
+}
+
+func TestThresholdOverrides(t *testing.T) {
+	stra := initTestStra(0)
+	// 和从monapi获取策略一样经过json解析
+	overrides := `[{"tags":"mount=/data","threshold":80},{"tags":"mount=/","threshold":98}]`
+	if err := json.Unmarshal([]byte(overrides), &stra.Exprs[0].Overrides); err != nil {
+		t.Fatal(err)
+	}
+
+	// mount=/ 使用覆盖之后的阈值98
+	types := pushPoints(cache.NewJudgeItemMap(), 10, []float64{95, 95, 95, 99, 99, 99})
+	if types[2] != "" || types[5] != EVENT_ALERT {
+		t.Fatalf("unexpected event types %v", types)
+	}
+
+	event, _ := cache.LastEvents.Get("s_1_" + str.PK("host01", "disk.bytes.used.percent", "mount=/"))
+	if !strings.Contains(event.Info, "> 98") {
+		t.Fatalf("info should show the overridden threshold, got %s", event.Info)
+	}
+}
+
+func TestNodataPerSeries(t *testing.T) {
+	stra := initTestStra(0)
+	stra.Exprs[0] = model.Exp{Func: "nodata", Metric: "proc.port.listen"}
+	cache.NodataSeriesMap = cache.NewSafeNodataMap()
+
+	for _, tag := range []string{"port=8080", "port=8081"} {
+		s := cache.Series{Endpoint: "host01", Metric: "proc.port.listen", Tag: tag, Step: 10, Dstype: "GAUGE", TS: 100}
+		cache.NodataSeriesMap.Learn(stra.Id, str.MD5(s.Endpoint, s.Metric, s.Tag), s)
+	}
+
+	// port=8080 没有数据，host02 索引中没有这个指标
+	respData := []*dataobj.TsdbQueryResponse{
+		{Endpoint: "host01", Counter: "proc.port.listen/port=8081", Step: 10, Values: []*dataobj.RRDData{{Timestamp: 120, Value: 1}}},
+	}
+	lostSeries := []cache.Series{{Endpoint: "host02", Metric: "proc.port.listen"}}
+	targets := collectNodata(stra, cache.NodataSeriesMap.Get(stra.Id), lostSeries, respData)
+	if len(targets) != 3 {
+		t.Fatalf("expect 3 targets, got %d", len(targets))
+	}
+
+	result := newBacktestResult()
+	state := NewState(result.record)
+	for _, target := range targets {
+		judgeWithState(state, stra, stra.Exprs, target.values, target.item, 130, []dataobj.History{}, "", "")
+	}
+
+	alerts := map[string]bool{}
+	for _, s := range result.list() {
+		alerts[s.Endpoint+"/"+s.Tags["port"]] = s.Events[0].EventType == EVENT_ALERT
+	}
+	if len(alerts) != 2 || !alerts["host01/8080"] || !alerts["host02/"] {
+		t.Fatalf("unexpected nodata alerts %v", alerts)
+	}
+
+	seen := cache.NodataSeriesMap.Get(stra.Id)[str.MD5("host01", "proc.port.listen", "port=8081")]
+	if seen.LastSeen != 120 {
+		t.Fatalf("last seen should be updated to 120, got %d", seen.LastSeen)
+	}
+
+	// 索引中已经删除，并且超过过期时间没有数据的series不再跟踪
+	cache.NodataSeriesMap.Expire(stra.Id, 110, map[string]struct{}{})
+	if len(cache.NodataSeriesMap.Get(stra.Id)) != 1 {
+		t.Fatalf("silent series should be expired")
+	}
+}
+
+func TestNodataSeriesRelearn(t *testing.T) {
+	stra := initTestStra(0)
+	cache.NodataSeriesMap = cache.NewSafeNodataMap()
+
+	keys := map[string]string{}
+	for _, tag := range []string{"port=8080", "port=8081"} {
+		s := cache.Series{Endpoint: "host01", Metric: "proc.port.listen", Tag: tag, Step: 10, TS: 100}
+		keys[tag] = str.MD5(s.Endpoint, s.Metric, s.Tag)
+		cache.NodataSeriesMap.Learn(stra.Id, keys[tag], s)
+	}
+
+	// 都已经很久没有数据，还在索引中的series继续跟踪
+	cache.NodataSeriesMap.Expire(stra.Id, 1000, map[string]struct{}{keys["port=8080"]: {}})
+	tracked := cache.NodataSeriesMap.Get(stra.Id)
+	if _, exists := tracked[keys["port=8080"]]; !exists || len(tracked) != 1 {
+		t.Fatalf("only the series still in index should be tracked, got %v", tracked)
+	}
+
+	// 重新出现在索引中，从新的时间开始计算
+	s := cache.Series{Endpoint: "host01", Metric: "proc.port.listen", Tag: "port=8081", Step: 10, TS: 2000}
+	cache.NodataSeriesMap.Learn(stra.Id, keys["port=8081"], s)
+	relearned, exists := cache.NodataSeriesMap.Get(stra.Id)[keys["port=8081"]]
+	if !exists || relearned.LastSeen != 2000 {
+		t.Fatalf("dropped series should be relearned from 2000, got %v", relearned)
+	}
+
+	cache.NodataSeriesMap.Expire(stra.Id, 1500, map[string]struct{}{})
+	if tracked := cache.NodataSeriesMap.Get(stra.Id); len(tracked) != 1 {
+		t.Fatalf("relearned series should not expire before its own timeout, got %v", tracked)
+	}
+}
+
+// 非机器策略不限制endpoint，由索引查找所有上报过metric的endpoint
+func TestNodataIndexReq(t *testing.T) {
+	stra := initTestStra(0)
+	stra.Endpoints = []string{"host01"}
+
+	req := nodataIndexReq(stra)
+	if req.AllEndpoints || len(req.Endpoints) != 1 || req.Metric != stra.Exprs[0].Metric {
+		t.Fatalf("machine stra should query its own endpoints, got %+v", req)
+	}
+
+	stra.Category = straCategoryNonMachine
+	req = nodataIndexReq(stra)
+	if !req.AllEndpoints || len(req.Endpoints) != 0 || req.Metric != stra.Exprs[0].Metric {
+		t.Fatalf("non-machine stra should query all endpoints, got %+v", req)
+	}
+}
+
+func TestDebugSeries(t *testing.T) {
+	stra := initTestStra(0)
+	cache.NodataStra = cache.NewStrategyMap()
+	cache.AggrStra = cache.NewStrategyMap()
+	cache.InitHistoryBigMap()
+
+	item := &dataobj.JudgeItem{Endpoint: "host01", Metric: stra.Exprs[0].Metric, TagsMap: map[string]string{"mount": "/"}, Sid: stra.Id}
+	key := item.MD5()
+	pushPoints(cache.HistoryBigMap[key[0:2]], 10, []float64{91, 97, 93})
+
+	list := StraSummaries()
+	if len(list) != 1 || list[0].Type != STRA_NORMAL || list[0].Series != 1 {
+		t.Fatalf("unexpected stra summaries %v", list)
+	}
+
+	ret, err := DebugSeries(stra.Id, "host01", stra.Exprs[0].Metric, "mount=/", 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Key != key || len(ret.History) != 3 || !ret.IsEnough {
+		t.Fatalf("unexpected history %v", ret)
+	}
+	if ret.LeftValue != 97 || !ret.Triggered {
+		t.Fatalf("expect left value 97 triggered, got %v %v", ret.LeftValue, ret.Triggered)
+	}
+	if ret.LastEvent == nil || ret.LastEvent.EventType != EVENT_ALERT {
+		t.Fatalf("last event should be alert, got %v", ret.LastEvent)
+	}
+
+	if _, err := DebugSeries(2, "host01", stra.Exprs[0].Metric, "", 40); err == nil {
+		t.Fatalf("unknown stra should return error")
+	}
+
+	// 集群策略展示最近一次聚合用到的series数量
+	aggrStra := &model.Stra{Id: 3, Exprs: stra.Exprs, Aggr: model.StraAggr{Func: "avg"}}
+	cache.AggrStra.Set(aggrStra.Id, aggrStra)
+	aggrSeriesCount.m = map[int64]int{aggrStra.Id: 5}
+	defer func() { aggrSeriesCount.m = make(map[int64]int) }()
+
+	list = StraSummaries()
+	if len(list) != 2 || list[1].Type != STRA_AGGR || list[1].Series != 5 {
+		t.Fatalf("unexpected aggr summary %v", list[1])
+	}
+}
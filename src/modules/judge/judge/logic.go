@@ -0,0 +1,148 @@
+package judge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/toolkits/str"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+type logicSeries struct {
+	item *dataobj.JudgeItem
+	data []*dataobj.RRDData
+}
+
+// 解析之后的exprs_logic按照策略id缓存，exprs_logic或者条件个数变化之后重新解析
+var exprsLogics = struct {
+	sync.RWMutex
+	m map[int64]*parsedLogic
+}{m: make(map[int64]*parsedLogic)}
+
+type parsedLogic struct {
+	str   string
+	count int
+	logic *model.ExprsLogic
+	err   error
+}
+
+func getExprsLogic(stra *model.Stra) (*model.ExprsLogic, error) {
+	exprsLogics.RLock()
+	p, exists := exprsLogics.m[stra.Id]
+	exprsLogics.RUnlock()
+	if exists && p.str == stra.ExprsLogic && p.count == len(stra.Exprs) {
+		return p.logic, p.err
+	}
+
+	p = &parsedLogic{str: stra.ExprsLogic, count: len(stra.Exprs)}
+	p.logic, p.err = model.ParseExprsLogic(stra.ExprsLogic, len(stra.Exprs))
+
+	exprsLogics.Lock()
+	exprsLogics.m[stra.Id] = p
+	exprsLogics.Unlock()
+	return p.logic, p.err
+}
+
+// judgeWithLogic 每个条件都在和第一个条件相同的series上计算，再按照stra.ExprsLogic组合结果
+func judgeWithLogic(state *State, stra *model.Stra, historyData []*dataobj.RRDData, firstItem *dataobj.JudgeItem, now int64) {
+	logic, err := getExprsLogic(stra)
+	if err != nil {
+		logger.Errorf("stra:%d parse exprs_logic err:%v", stra.Id, err)
+		return
+	}
+
+	triggered := make([]bool, len(stra.Exprs))
+	values := make([]string, len(stra.Exprs))
+	history := make([]dataobj.History, 0, len(stra.Exprs))
+
+	for i, exp := range stra.Exprs {
+		var series []logicSeries
+		if i == 0 {
+			series = []logicSeries{{item: firstItem, data: historyData}}
+		} else {
+			series = getLogicSeries(state, stra, exp, firstItem, now)
+		}
+
+		var h []dataobj.History
+		for j, s := range series {
+			leftValue, isTriggered, detail := judgeItemWithStrategy(state, stra, s.data, exp, s.item, now)
+			if j == 0 || isTriggered {
+				h = append([]dataobj.History{{
+					Metric:      exp.Metric,
+					Tags:        s.item.TagsMap,
+					Granularity: s.item.Step,
+					Points:      s.data,
+					PredPoints:  detail.PredPoints,
+				}}, detail.Compares...)
+			}
+
+			if isTriggered {
+				triggered[i] = true
+				values[i] = fmt.Sprintf("%s: %v", exp.Metric, leftValue)
+				break
+			}
+		}
+		history = append(history, h...)
+	}
+
+	isTriggered := logic.Eval(triggered)
+
+	info := fmt.Sprintf(" [%s]", stra.ExprsLogic)
+	var value []string
+	if isTriggered {
+		// 只展示使表达式成立的分支
+		for _, i := range uniqIndexes(logic.Fired(triggered)) {
+			info += fmt.Sprintf(" %s:%s", model.ExprsLogicName(i), expInfo(stra, stra.Exprs[i], itemTags(firstItem)))
+			value = append(value, values[i])
+		}
+	} else {
+		for i, exp := range stra.Exprs {
+			info += fmt.Sprintf(" %s:%s", model.ExprsLogicName(i), expInfo(stra, exp, itemTags(firstItem)))
+		}
+	}
+
+	event := newEvent(stra, firstItem, now, info, strings.Join(value, "; "), history)
+	sendEventIfNeed(state, historyData, isTriggered, now, event, stra.RecoveryDur)
+}
+
+// 和与条件的逻辑保持一致：有上报点时查询相同endpoint和tags的数据，nodata或者没有上报点时重新查询索引
+func getLogicSeries(state *State, stra *model.Stra, exp model.Exp, firstItem *dataobj.JudgeItem, now int64) []logicSeries {
+	sameTag := firstItem.Step != 0 && exp.Func != "nodata"
+	respData, err := GetData(state, stra, exp, firstItem, now, sameTag)
+	if err != nil {
+		logger.Errorf("stra:%v get query data err:%v", stra.Id, err)
+		return []logicSeries{{item: firstItem, data: []*dataobj.RRDData{}}}
+	}
+
+	series := make([]logicSeries, 0, len(respData))
+	for i := range respData {
+		item := *firstItem
+		item.Endpoint = respData[i].Endpoint
+		item.Tags = getTags(respData[i].Counter)
+		item.TagsMap = str.DictedTagstring(item.Tags)
+		if respData[i].Step != 0 {
+			item.Step = respData[i].Step
+		}
+		series = append(series, logicSeries{item: &item, data: respData[i].Values})
+	}
+	return series
+}
+
+func uniqIndexes(indexes []int) []int {
+	m := make(map[int]struct{}, len(indexes))
+	uniq := make([]int, 0, len(indexes))
+	for _, i := range indexes {
+		if _, exists := m[i]; exists {
+			continue
+		}
+		m[i] = struct{}{}
+		uniq = append(uniq, i)
+	}
+	sort.Ints(uniq)
+	return uniq
+}
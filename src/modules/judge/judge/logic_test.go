@@ -0,0 +1,173 @@
+package judge
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/model"
+)
+
+func logicPoints(start int64, values ...float64) []*dataobj.RRDData {
+	var points []*dataobj.RRDData
+	for i, v := range values {
+		points = append(points, &dataobj.RRDData{Timestamp: start + int64(i)*10, Value: dataobj.JsonFloat(v)})
+	}
+	return points
+}
+
+// 第一个条件使用上报的点，其他条件按照返回的series计算
+func judgeLogic(stra *model.Stra, first []float64, series map[string][]*dataobj.TsdbQueryResponse) ([]*BacktestSeries, []*dataobj.QueryData) {
+	result := newBacktestResult()
+	state := NewState(result.record)
+
+	var reqs []*dataobj.QueryData
+	state.Query = func(rs []*dataobj.QueryData) ([]*dataobj.TsdbQueryResponse, error) {
+		reqs = append(reqs, rs...)
+		var metric string
+		if len(rs) > 0 && len(rs[0].Counters) > 0 {
+			metric = strings.SplitN(rs[0].Counters[0], "/", 2)[0]
+		}
+		return series[metric], nil
+	}
+
+	item := &dataobj.JudgeItem{
+		Endpoint: "host01",
+		Metric:   stra.Exprs[0].Metric,
+		Tags:     "mount=/",
+		TagsMap:  map[string]string{"mount": "/"},
+		DsType:   "GAUGE",
+		Step:     10,
+		Sid:      stra.Id,
+	}
+	judgeWithState(state, stra, stra.Exprs, logicPoints(1000, first...), item, 1020, []dataobj.History{}, "", "")
+	return result.list(), reqs
+}
+
+func logicStra(logic string, exprs ...model.Exp) *model.Stra {
+	stra := initTestStra(0)
+	stra.ExprsLogic = logic
+	stra.Exprs = exprs
+	return stra
+}
+
+var (
+	diskExp = model.Exp{Eopt: ">", Func: "all", Metric: "disk.bytes.used.percent", Threshold: 90}
+	cpuExp  = model.Exp{Eopt: "<", Func: "all", Metric: "cpu.idle", Threshold: 10}
+	memExp  = model.Exp{Eopt: ">", Func: "all", Metric: "mem.bytes.used.percent", Threshold: 95}
+)
+
+func TestJudgeWithLogicOr(t *testing.T) {
+	stra := logicStra("A OR B", diskExp, cpuExp)
+	series := map[string][]*dataobj.TsdbQueryResponse{
+		"cpu.idle": {{Endpoint: "host01", Counter: "cpu.idle/mount=/", Step: 10, Values: logicPoints(1000, 5, 5, 5)}},
+	}
+
+	// A没有触发，B触发
+	list, reqs := judgeLogic(stra, []float64{50, 50, 50}, series)
+	if len(list) != 1 || len(list[0].Events) != 1 || list[0].Events[0].EventType != EVENT_ALERT {
+		t.Fatalf("expect one alert, got %v", list)
+	}
+
+	// 只展示触发的分支
+	event := list[0].Events[0]
+	if event.Info != " [A OR B] B: cpu.idle(all,30s) < 10" || event.Value != "cpu.idle: 5" {
+		t.Fatalf("unexpected info %q value %q", event.Info, event.Value)
+	}
+
+	// B使用和A相同的endpoint和tags查询
+	if len(reqs) != 1 || reqs[0].Endpoints[0] != "host01" || reqs[0].Counters[0] != "cpu.idle/mount=/" {
+		t.Fatalf("unexpected query %v", reqs)
+	}
+
+	// 都没有触发，不产生event
+	series["cpu.idle"][0].Values = logicPoints(1000, 50, 50, 50)
+	if list, _ := judgeLogic(stra, []float64{50, 50, 50}, series); len(list) != 0 {
+		t.Fatalf("expect no event, got %v", list)
+	}
+}
+
+func TestJudgeWithLogicNested(t *testing.T) {
+	stra := logicStra("(A AND B) OR C", diskExp, cpuExp, memExp)
+
+	cases := []struct {
+		disk  float64
+		cpu   float64
+		mem   float64
+		alert bool
+		info  string
+	}{
+		{95, 5, 50, true, " [(A AND B) OR C] A: disk.bytes.used.percent(all,30s) > 90 B: cpu.idle(all,30s) < 10"},
+		{95, 50, 99, true, " [(A AND B) OR C] C: mem.bytes.used.percent(all,30s) > 95"},
+		{95, 50, 50, false, ""},
+		{50, 5, 50, false, ""},
+	}
+
+	for i, c := range cases {
+		series := map[string][]*dataobj.TsdbQueryResponse{
+			"cpu.idle":               {{Endpoint: "host01", Counter: "cpu.idle/mount=/", Step: 10, Values: logicPoints(1000, c.cpu, c.cpu, c.cpu)}},
+			"mem.bytes.used.percent": {{Endpoint: "host01", Counter: "mem.bytes.used.percent/mount=/", Step: 10, Values: logicPoints(1000, c.mem, c.mem, c.mem)}},
+		}
+		list, _ := judgeLogic(stra, []float64{c.disk, c.disk, c.disk}, series)
+
+		if !c.alert {
+			if len(list) != 0 {
+				t.Fatalf("case %d: expect no event, got %v", i, list)
+			}
+			continue
+		}
+		if len(list) != 1 || list[0].Events[0].Info != c.info {
+			t.Fatalf("case %d: expect info %q, got %v", i, c.info, list)
+		}
+	}
+}
+
+// 其他条件查询到多条series时，任意一条触发即认为条件成立，告警仍然属于第一个条件的series
+func TestJudgeWithLogicSeries(t *testing.T) {
+	stra := logicStra("A AND B", diskExp, cpuExp)
+	series := map[string][]*dataobj.TsdbQueryResponse{
+		"cpu.idle": {
+			{Endpoint: "host01", Counter: "cpu.idle/core=0", Step: 10, Values: logicPoints(1000, 50, 50, 50)},
+			{Endpoint: "host01", Counter: "cpu.idle/core=1", Step: 10, Values: logicPoints(1000, 5, 5, 5)},
+		},
+	}
+
+	list, _ := judgeLogic(stra, []float64{95, 95, 95}, series)
+	if len(list) != 1 || list[0].Endpoint != "host01" || list[0].Tags["mount"] != "/" {
+		t.Fatalf("unexpected series %v", list)
+	}
+	if event := list[0].Events[0]; event.Value != "disk.bytes.used.percent: 95; cpu.idle: 5" {
+		t.Fatalf("unexpected value %q", event.Value)
+	}
+
+	// 没有任何一条series触发
+	series["cpu.idle"][1].Values = logicPoints(1000, 50, 50, 50)
+	if list, _ := judgeLogic(stra, []float64{95, 95, 95}, series); len(list) != 0 {
+		t.Fatalf("expect no event, got %v", list)
+	}
+}
+
+// exprs_logic只在第一次判断或者变化之后解析
+func TestExprsLogicCache(t *testing.T) {
+	stra := logicStra("A OR B", diskExp, cpuExp)
+	stra.Id = 1001
+
+	first, err := getExprsLogic(stra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logic, _ := getExprsLogic(stra); logic != first {
+		t.Fatal("expect cached exprs_logic")
+	}
+
+	stra.ExprsLogic = "A AND B"
+	logic, err := getExprsLogic(stra)
+	if err != nil || logic == first || logic.Eval([]bool{true, false}) {
+		t.Fatalf("expect exprs_logic parsed again, got %+v %v", logic, err)
+	}
+
+	stra.ExprsLogic = "A AND C"
+	if _, err := getExprsLogic(stra); err == nil {
+		t.Fatal("expect error for unknown expr")
+	}
+}
@@ -1,12 +1,15 @@
 package judge
 
 import (
-	"strings"
+	"math"
+	"sort"
 	"time"
 
 	"github.com/didi/nightingale/src/dataobj"
 	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/judge/backend/query"
 	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/str"
 
 	"github.com/toolkits/pkg/concurrent/semaphore"
 	"github.com/toolkits/pkg/logger"
@@ -14,12 +17,27 @@ import (
 
 var nodataJob *semaphore.Semaphore
 
-func NodataJudge(concurrency int) {
+// 策略类型，2表示非机器
+const straCategoryNonMachine = 2
+
+// 学习到的series从索引中删除，并且超过这个时间没有数据，就不再跟踪
+var nodataSeriesExpire int64 = 86400
+
+type nodataTarget struct {
+	item   *dataobj.JudgeItem
+	values []*dataobj.RRDData
+}
+
+func NodataJudge(concurrency int, seriesExpire int) {
 	if concurrency < 1 {
 		concurrency = 1000
 	}
 	nodataJob = semaphore.NewSemaphore(1000)
 
+	if seriesExpire > 0 {
+		nodataSeriesExpire = int64(seriesExpire)
+	}
+
 	t1 := time.NewTicker(time.Duration(9000) * time.Millisecond)
 	nodataJudge()
 	for {
@@ -30,59 +48,155 @@ func NodataJudge(concurrency int) {
 
 func nodataJudge() {
 	stras := cache.NodataStra.GetAll()
+	ids := make(map[int64]struct{}, len(stras))
 	for _, stra := range stras {
+		ids[stra.Id] = struct{}{}
+
 		//nodata处理
 		now := time.Now().Unix()
-		respData, err := GetData(stra, stra.Exprs[0], nil, now, false)
-		if err != nil {
-			logger.Errorf("stra:%v get query data err:%v", stra, err)
-			//获取数据报错，直接出发nodata
-			for _, endpoint := range stra.Endpoints {
-				if endpoint == "" {
-					continue
-				}
-				judgeItem := &dataobj.JudgeItem{
-					Endpoint: endpoint,
-					Metric:   stra.Exprs[0].Metric,
-					Tags:     "",
-					DsType:   "GAUGE",
-				}
-
-				nodataJob.Acquire()
-				go func(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, firstItem *dataobj.JudgeItem, now int64, history []dataobj.History, info string, value string) {
-					defer nodataJob.Release()
-					Judge(stra, exps, historyData, firstItem, now, history, info, value)
-				}(stra, stra.Exprs, []*dataobj.RRDData{}, judgeItem, now, []dataobj.History{}, "", "")
-			}
-			return
+		for _, target := range nodataTargets(stra, now) {
+			nodataJob.Acquire()
+			go func(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, firstItem *dataobj.JudgeItem, now int64, history []dataobj.History, info string, value string) {
+				defer nodataJob.Release()
+				Judge(stra, exps, historyData, firstItem, now, history, info, value)
+			}(stra, stra.Exprs, target.values, target.item, now, []dataobj.History{}, "", "")
 		}
+	}
+	cache.NodataSeriesMap.Retain(ids)
+}
 
-		for _, data := range respData {
-			var metric, tag string
-			arr := strings.Split(data.Counter, "/")
-			if len(arr) == 2 {
-				metric = arr[0]
-				tag = arr[1]
-			} else {
-				metric = data.Counter
-			}
+// nodataTargets 从索引学习策略关联的series，查询每个series最近一个告警周期的数据
+// 机器策略只学习策略节点下的endpoint(stra.Endpoints)，非机器策略学习索引中所有上报过metric的endpoint
+// 索引中消失的series在过期之前依然参与判断，这样单个tag组合断掉也能告警
+func nodataTargets(stra *model.Stra, now int64) []nodataTarget {
+	series, lostSeries, err := getSeriesByReq(stra, nodataIndexReq(stra), now)
+	if err != nil {
+		// 索引查询失败时沿用已经学习到的series，也不做过期
+		logger.Errorf("stra:%d get index err:%v", stra.Id, err)
+	} else {
+		indexed := make(map[string]struct{}, len(series))
+		for _, s := range series {
+			indexed[str.MD5(s.Endpoint, s.Metric, s.Tag)] = struct{}{}
+		}
+		cache.NodataSeriesMap.Expire(stra.Id, now-nodataSeriesExpire, indexed)
+	}
 
-			if data.Endpoint == "" {
-				continue
+	for _, s := range series {
+		cache.NodataSeriesMap.Learn(stra.Id, str.MD5(s.Endpoint, s.Metric, s.Tag), s)
+	}
+	tracked := cache.NodataSeriesMap.Get(stra.Id)
+
+	var respData []*dataobj.TsdbQueryResponse
+	if len(tracked) > 0 {
+		seriess := make([]cache.Series, 0, len(tracked))
+		step := 0
+		for _, s := range tracked {
+			seriess = append(seriess, s.Series)
+			if s.Step > step {
+				step = s.Step
 			}
-			judgeItem := &dataobj.JudgeItem{
-				Endpoint: data.Endpoint,
+		}
+
+		//防止由于差不到最新点，导致点数不够
+		start := now - int64(stra.AlertDur) - int64(step) + 1
+		respData, err = query.Query(buildReqs(seriess, start, now))
+		if err != nil {
+			// 查询数据报错时不知道哪些series没有数据，跳过这一轮判断，避免误报
+			logger.Errorf("stra:%d get query data err:%v", stra.Id, err)
+			return nil
+		}
+	}
+
+	return collectNodata(stra, tracked, lostSeries, respData)
+}
+
+// nodataIndexReq 非机器的endpoint没有挂到服务树节点上，不限制endpoint，由索引按照metric查找
+func nodataIndexReq(stra *model.Stra) *query.IndexReq {
+	req := &query.IndexReq{Metric: stra.Exprs[0].Metric}
+	if stra.Category == straCategoryNonMachine {
+		req.AllEndpoints = true
+	} else {
+		req.Endpoints = stra.Endpoints
+	}
+	return req
+}
+
+// collectNodata 把查询结果对应到每个series上，并更新series最近一次有数据的时间
+func collectNodata(stra *model.Stra, tracked map[string]cache.NodataSeries, lostSeries []cache.Series, respData []*dataobj.TsdbQueryResponse) []nodataTarget {
+	metric := stra.Exprs[0].Metric
+	values := make(map[string][]*dataobj.RRDData, len(respData))
+	for _, data := range respData {
+		if data.Endpoint == "" {
+			continue
+		}
+		values[str.MD5(data.Endpoint, metric, getTags(data.Counter))] = data.Values
+	}
+
+	keys := make([]string, 0, len(tracked))
+	for key := range tracked {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	targets := []nodataTarget{}
+	known := make(map[string]struct{})
+	step := defaultNodataStep
+	for _, key := range keys {
+		s := tracked[key]
+		known[s.Endpoint] = struct{}{}
+		if s.Step > 0 {
+			step = s.Step
+		}
+
+		vs := values[key]
+		if ts := lastTimestamp(vs); ts > 0 {
+			cache.NodataSeriesMap.Seen(stra.Id, key, ts)
+		}
+
+		targets = append(targets, nodataTarget{
+			item: &dataobj.JudgeItem{
+				Endpoint: s.Endpoint,
 				Metric:   metric,
-				Tags:     tag,
-				DsType:   data.DsType,
-				Step:     data.Step,
-			}
+				Tags:     s.Tag,
+				TagsMap:  str.DictedTagstring(s.Tag),
+				DsType:   s.Dstype,
+				Step:     s.Step,
+				Sid:      stra.Id,
+			},
+			values: vs,
+		})
+	}
 
-			nodataJob.Acquire()
-			go func(stra *model.Stra, exps []model.Exp, historyData []*dataobj.RRDData, firstItem *dataobj.JudgeItem, now int64, history []dataobj.History, info string, value string) {
-				defer nodataJob.Release()
-				Judge(stra, exps, historyData, firstItem, now, history, info, value)
-			}(stra, stra.Exprs, data.Values, judgeItem, now, []dataobj.History{}, "", "")
+	// 一个series都没有学习到的endpoint，只能按照endpoint判断，step和其他series保持一致
+	for _, s := range lostSeries {
+		if s.Endpoint == "" {
+			continue
+		}
+		if _, exists := known[s.Endpoint]; exists {
+			continue
+		}
+		targets = append(targets, nodataTarget{
+			item: &dataobj.JudgeItem{
+				Endpoint: s.Endpoint,
+				Metric:   metric,
+				Tags:     "",
+				DsType:   "GAUGE",
+				Step:     step,
+				Sid:      stra.Id,
+			},
+			values: []*dataobj.RRDData{},
+		})
+	}
+
+	return targets
+}
+
+func lastTimestamp(vs []*dataobj.RRDData) int64 {
+	var ts int64
+	for _, v := range vs {
+		if !math.IsNaN(float64(v.Value)) && v.Timestamp > ts {
+			ts = v.Timestamp
 		}
 	}
+	return ts
 }
@@ -0,0 +1,40 @@
+package judge
+
+import (
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/judge/backend/query"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+)
+
+// State 告警状态、查询数据的入口以及event的出口
+// 线上judge使用全局的cache并把event推送到redis，策略回放时每次请求使用独立的状态
+type State struct {
+	LastEvents *cache.SafeEventMap
+	Recovery   *cache.SafeRecoveryMap
+	Flaps      *cache.SafeFlapMap
+	Series     *cache.IndexMap // 多条件、环比等需要重新查询索引时记录的series
+	Query      func(reqs []*dataobj.QueryData) ([]*dataobj.TsdbQueryResponse, error)
+	Send       func(event *dataobj.Event)
+}
+
+func NewState(send func(event *dataobj.Event)) *State {
+	return &State{
+		LastEvents: &cache.SafeEventMap{M: make(map[string]*dataobj.Event)},
+		Recovery:   cache.NewSafeRecoveryMap(),
+		Flaps:      cache.NewSafeFlapMap(),
+		Series:     &cache.IndexMap{Data: make(map[int64]map[string]cache.Series)},
+		Query:      query.Query,
+		Send:       send,
+	}
+}
+
+func liveState() *State {
+	return &State{
+		LastEvents: cache.LastEvents,
+		Recovery:   cache.RecoveryStates,
+		Flaps:      cache.FlapStates,
+		Series:     cache.SeriesMap,
+		Query:      query.Query,
+		Send:       pushEvent,
+	}
+}
@@ -0,0 +1,22 @@
+package rpc
+
+import (
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// Handoff hash环变化时，原来负责策略的judge把告警状态交接过来
+func (j *Judge) Handoff(snap *cache.Snapshot, resp *dataobj.SimpleRpcResponse) error {
+	if snap == nil {
+		resp.Code = 1
+		return nil
+	}
+
+	stats.Counter.Set("handoff.in", 1)
+	logger.Infof("recv handoff events:%d history:%d", len(snap.Events), len(snap.History))
+	snap.Restore()
+	return nil
+}
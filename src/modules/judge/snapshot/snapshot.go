@@ -0,0 +1,178 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/toolkits/pkg/file"
+	"github.com/toolkits/pkg/logger"
+	"github.com/ugorji/go/codec"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+type SnapshotSection struct {
+	Enabled        bool   `yaml:"enabled"`
+	Dir            string `yaml:"dir"`
+	Interval       int    `yaml:"interval"`       // 落盘周期，单位毫秒
+	HandoffTimeout int    `yaml:"handoffTimeout"` // 交接状态的rpc超时，单位毫秒
+}
+
+const fileName = "snapshot.json"
+
+var Config SnapshotSection
+
+// Init 从本地磁盘恢复上次退出前的告警状态
+func Init(cfg SnapshotSection) {
+	Config = cfg
+	if !Config.Enabled {
+		return
+	}
+
+	if err := file.EnsureDir(Config.Dir); err != nil {
+		logger.Errorf("snapshot: ensure dir %s err:%v", Config.Dir, err)
+		return
+	}
+
+	if err := load(); err != nil {
+		logger.Warningf("snapshot: load err:%v", err)
+	}
+}
+
+func SaveLoop() {
+	if !Config.Enabled {
+		return
+	}
+
+	t1 := time.NewTicker(time.Duration(Config.Interval) * time.Millisecond)
+	for {
+		<-t1.C
+		if err := Save(); err != nil {
+			logger.Errorf("snapshot: save err:%v", err)
+		}
+	}
+}
+
+// Save 先写临时文件再rename，防止写到一半退出导致快照损坏
+func Save() error {
+	if !Config.Enabled {
+		return nil
+	}
+
+	snap := cache.TakeSnapshot(time.Now().Unix(), nil)
+	bs, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	filePath := path.Join(Config.Dir, fileName)
+	tmpPath := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, bs, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+
+	stats.Counter.Set("snapshot.save", 1)
+	logger.Debugf("snapshot: save events:%d history:%d", len(snap.Events), len(snap.History))
+	return nil
+}
+
+func load() error {
+	filePath := path.Join(Config.Dir, fileName)
+	if !file.IsExist(filePath) {
+		return nil
+	}
+
+	bs, err := file.ReadBytes(filePath)
+	if err != nil {
+		return err
+	}
+
+	var snap cache.Snapshot
+	if err := json.Unmarshal(bs, &snap); err != nil {
+		return err
+	}
+
+	snap.Restore()
+	logger.Infof("snapshot: load events:%d history:%d ts:%d", len(snap.Events), len(snap.History), snap.Ts)
+	return nil
+}
+
+// Handoff 把sids对应的告警状态交给新的judge实例，成功后删除本地的状态
+func Handoff(instance string, sids []int64) error {
+	if len(sids) == 0 {
+		return nil
+	}
+
+	sidMap := make(map[int64]struct{}, len(sids))
+	for _, sid := range sids {
+		sidMap[sid] = struct{}{}
+	}
+	filter := func(sid int64) bool {
+		_, exists := sidMap[sid]
+		return exists
+	}
+
+	snap := cache.TakeSnapshot(time.Now().Unix(), filter)
+	if len(snap.Events) == 0 && len(snap.Recovery) == 0 && len(snap.Flaps) == 0 && len(snap.History) == 0 {
+		return nil
+	}
+
+	if err := callJudge(instance, "Judge.Handoff", snap); err != nil {
+		return err
+	}
+
+	cache.Drop(filter)
+	stats.Counter.Set("snapshot.handoff", 1)
+	logger.Infof("snapshot: handoff sids:%v to %s, events:%d history:%d", sids, instance, len(snap.Events), len(snap.History))
+	return nil
+}
+
+// callJudge 调用其他judge实例的rpc接口，测试时替换
+var callJudge = call
+
+func call(addr, method string, args interface{}) error {
+	timeout := time.Duration(Config.HandoffTimeout) * time.Millisecond
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var mh codec.MsgpackHandle
+	mh.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	var bufconn = struct {
+		io.Closer
+		*bufio.Reader
+		*bufio.Writer
+	}{conn, bufio.NewReader(conn), bufio.NewWriter(conn)}
+
+	client := rpc.NewClientWithCodec(codec.MsgpackSpecRpc.ClientCodec(bufconn, &mh))
+	defer client.Close()
+
+	var resp dataobj.SimpleRpcResponse
+	if err := client.Call(method, args, &resp); err != nil {
+		return err
+	}
+
+	if resp.Code != 0 {
+		return fmt.Errorf("%s %s resp code:%d", addr, method, resp.Code)
+	}
+	return nil
+}
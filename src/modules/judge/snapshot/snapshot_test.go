@@ -0,0 +1,109 @@
+package snapshot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+func resetStates() {
+	cache.LastEvents = &cache.SafeEventMap{M: make(map[string]*dataobj.Event)}
+	cache.RecoveryStates = cache.NewSafeRecoveryMap()
+	cache.FlapStates = cache.NewSafeFlapMap()
+	cache.InitHistoryBigMap()
+}
+
+func initStates() {
+	resetStates()
+	cache.LastEvents.Set("s_1_a", &dataobj.Event{Sid: 1, EventType: "alert", Etime: 100})
+	cache.LastEvents.Set("s_2_b", &dataobj.Event{Sid: 2, EventType: "alert", Etime: 100})
+	cache.RecoveryStates.Set("s_1_a", 90)
+	cache.FlapStates.M["s_1_a"] = &cache.FlapState{Changes: []int64{80, 90}, Flapping: true}
+}
+
+// 落盘之后重新加载，告警状态和抖动状态都能恢复
+func TestSaveLoad(t *testing.T) {
+	stats.Counter = stats.NewCounter("test")
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Config = SnapshotSection{Enabled: true, Dir: dir}
+	defer func() { Config = SnapshotSection{} }()
+
+	initStates()
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	resetStates()
+	if err := load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if event, exists := cache.LastEvents.Get("s_1_a"); !exists || event.ID != "s_1_a" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if _, exists := cache.LastEvents.Get("s_2_b"); !exists {
+		t.Fatal("event of sid 2 should be restored")
+	}
+	if since, _ := cache.RecoveryStates.Get("s_1_a"); since != 90 {
+		t.Fatalf("unexpected recovery %d", since)
+	}
+	if !cache.FlapStates.IsFlapping("s_1_a") {
+		t.Fatal("flap state should be restored")
+	}
+}
+
+// 交接成功之后新的judge收到对应策略的状态，本地只删除交接出去的策略
+func TestHandoff(t *testing.T) {
+	stats.Counter = stats.NewCounter("test")
+	defer func() { callJudge = call }()
+
+	var sent *cache.Snapshot
+	callJudge = func(addr, method string, args interface{}) error {
+		if addr != "10.0.0.2:6081" || method != "Judge.Handoff" {
+			t.Fatalf("unexpected call %s %s", addr, method)
+		}
+		sent = args.(*cache.Snapshot)
+		return nil
+	}
+
+	initStates()
+	if err := Handoff("10.0.0.2:6081", []int64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent.Events) != 1 || sent.Events["s_1_a"] == nil || sent.Recovery["s_1_a"] != 90 {
+		t.Fatalf("unexpected snapshot %+v", sent)
+	}
+	if flap := sent.Flaps["s_1_a"]; flap == nil || !flap.Flapping || len(flap.Changes) != 2 {
+		t.Fatalf("unexpected flap state %+v", flap)
+	}
+
+	if _, exists := cache.LastEvents.Get("s_1_a"); exists || cache.FlapStates.Len() != 0 {
+		t.Fatal("states of sid 1 should be dropped after handoff")
+	}
+	if _, exists := cache.LastEvents.Get("s_2_b"); !exists {
+		t.Fatal("event of sid 2 should be kept")
+	}
+
+	// 交接失败时保留本地的状态
+	initStates()
+	callJudge = func(addr, method string, args interface{}) error {
+		return fmt.Errorf("connection refused")
+	}
+	if err := Handoff("10.0.0.2:6081", []int64{1}); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, exists := cache.LastEvents.Get("s_1_a"); !exists || !cache.FlapStates.IsFlapping("s_1_a") {
+		t.Fatal("states of sid 1 should be kept when handoff fails")
+	}
+}
@@ -1,6 +1,7 @@
 package stra
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/didi/nightingale/src/model"
 	"github.com/didi/nightingale/src/modules/judge/cache"
+	"github.com/didi/nightingale/src/modules/judge/snapshot"
 	"github.com/didi/nightingale/src/toolkits/address"
 	"github.com/didi/nightingale/src/toolkits/identity"
 	"github.com/didi/nightingale/src/toolkits/report"
@@ -18,6 +20,7 @@ import (
 
 type StrategySection struct {
 	PartitionApi   string `yaml:"partitionApi"`
+	OwnerApi       string `yaml:"ownerApi"`
 	Timeout        int    `yaml:"timeout"`
 	Token          string `yaml:"token"`
 	UpdateInterval int    `yaml:"updateInterval"`
@@ -47,6 +50,8 @@ func getStrategy(opts StrategySection) {
 	}
 
 	var resp StrasResp
+	// 至少有一个monapi返回成功时，才能确定本实例负责的策略，返回空列表表示策略都已经迁走
+	fetched := false
 	perm := rand.Perm(len(addrs))
 	for i := range perm {
 		//PartitionApi = "/api/portal/stras/effective?instance=%s:%s"
@@ -63,24 +68,122 @@ func getStrategy(opts StrategySection) {
 			continue
 		}
 
+		fetched = true
 		if len(resp.Data) > 0 {
 			break
 		}
 	}
+	if fetched {
+		handoffRemoved(opts, resp.Data)
+	}
+
 	for _, stra := range resp.Data {
 		if len(stra.Exprs) < 1 {
 			logger.Warningf("strategy:%v exprs < 1", stra)
 			continue
 		}
 
-		if stra.Exprs[0].Func == "nodata" {
+		// 策略类型变化之后，从原来的map中删除，避免同一个策略被判断两次
+		straMap := cache.Strategy
+		if stra.IsAggr() {
+			stats.Counter.Set("stra.aggr", 1)
+			straMap = cache.AggrStra
+		} else if stra.Exprs[0].Func == "nodata" {
 			stats.Counter.Set("stra.nodata", 1)
-			cache.NodataStra.Set(stra.Id, stra)
+			straMap = cache.NodataStra
 		} else {
 			stats.Counter.Set("stra.common", 1)
-			cache.Strategy.Set(stra.Id, stra)
 		}
+
+		for _, m := range []*cache.StrategyMap{cache.Strategy, cache.NodataStra, cache.AggrStra} {
+			if m != straMap {
+				m.Delete(stra.Id)
+			}
+		}
+		straMap.Set(stra.Id, stra)
 	}
 
 	cache.Strategy.Clean()
+	cache.NodataStra.Clean()
+	cache.AggrStra.Clean()
+}
+
+// hash环变化之后不再由本实例负责的策略，把告警状态交给新的judge
+func handoffRemoved(opts StrategySection, stras []*model.Stra) {
+	current := make(map[int64]struct{}, len(stras))
+	for _, stra := range stras {
+		current[stra.Id] = struct{}{}
+	}
+
+	removed := []int64{}
+	for _, straMap := range []*cache.StrategyMap{cache.Strategy, cache.NodataStra, cache.AggrStra} {
+		for _, stra := range straMap.GetAll() {
+			if _, exists := current[stra.Id]; exists {
+				continue
+			}
+			straMap.Delete(stra.Id)
+			removed = append(removed, stra.Id)
+		}
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	owners, err := getOwners(opts)
+	if err != nil {
+		logger.Warningf("get strategy owners failed, removed:%v error:%v", removed, err)
+		return
+	}
+
+	self := identity.Identity + ":" + report.Config.RPCPort
+	sidsByOwner := make(map[string][]int64)
+	for _, sid := range removed {
+		owner, exists := owners[sid]
+		if !exists || owner == "" || owner == self {
+			continue
+		}
+		sidsByOwner[owner] = append(sidsByOwner[owner], sid)
+	}
+
+	for owner, sids := range sidsByOwner {
+		if err := snapshot.Handoff(owner, sids); err != nil {
+			logger.Warningf("handoff sids:%v to %s failed, error:%v", sids, owner, err)
+		}
+	}
+}
+
+// 获取所有策略当前所在的judge实例
+func getOwners(opts StrategySection) (map[int64]string, error) {
+	addrs := address.GetHTTPAddresses("monapi")
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("empty config addr")
+	}
+
+	var resp StrasResp
+	var err error
+	perm := rand.Perm(len(addrs))
+	for i := range perm {
+		url := fmt.Sprintf("http://%s%s", addrs[perm[i]], opts.OwnerApi)
+		err = httplib.Get(url).SetTimeout(time.Duration(opts.Timeout) * time.Millisecond).ToJSON(&resp)
+		if err != nil {
+			continue
+		}
+
+		if resp.Err != "" {
+			err = errors.New(resp.Err)
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[int64]string, len(resp.Data))
+	for _, stra := range resp.Data {
+		owners[stra.Id] = stra.JudgeInstance
+	}
+	return owners, nil
 }
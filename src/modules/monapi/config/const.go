@@ -4,5 +4,6 @@ const (
 	Version        = 1
 	RECOVERY       = "recovery"
 	ALERT          = "alert"
+	FLAPPING       = "flapping"
 	JudgesReplicas = 500
 )
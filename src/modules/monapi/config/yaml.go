@@ -29,10 +29,10 @@ type linkSection struct {
 }
 
 type queueSection struct {
-	EventPrefix  string        `yaml:"eventPrefix"`
-	EventQueues  []interface{} `yaml:"-"`
-	Callback     string        `yaml:"callback"`
-	SenderPrefix string        `yaml:"senderPrefix"`
+	EventPrefix  string   `yaml:"eventPrefix"`
+	EventQueues  []string `yaml:"-"`
+	Callback     string   `yaml:"callback"`
+	SenderPrefix string   `yaml:"senderPrefix"`
 }
 
 type cleanerSection struct {
@@ -40,11 +40,16 @@ type cleanerSection struct {
 	Batch int `yaml:"batch"`
 }
 
+// mode: standalone(默认)、sentinel、cluster
+// standalone兼容原来的addr，sentinel和cluster使用addrs
 type redisSection struct {
-	Addr    string         `yaml:"addr"`
-	Pass    string         `yaml:"pass"`
-	Idle    int            `yaml:"idle"`
-	Timeout timeoutSection `yaml:"timeout"`
+	Mode       string         `yaml:"mode"`
+	Addr       string         `yaml:"addr"`
+	Addrs      []string       `yaml:"addrs"`
+	MasterName string         `yaml:"masterName"`
+	Pass       string         `yaml:"pass"`
+	Idle       int            `yaml:"idle"`
+	Timeout    timeoutSection `yaml:"timeout"`
 }
 
 type timeoutSection struct {
@@ -123,6 +128,10 @@ func Parse(ymlfile string) error {
 		return fmt.Errorf("cannot read yml[%s]: %v", ymlfile, err)
 	}
 
+	if len(c.Redis.Addrs) == 0 && c.Redis.Addr != "" {
+		c.Redis.Addrs = []string{c.Redis.Addr}
+	}
+
 	size := len(c.Notify)
 	if size == 0 {
 		return fmt.Errorf("config.notify invalid")
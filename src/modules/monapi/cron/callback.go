@@ -71,10 +71,7 @@ func PushCallbackEvent(event *model.Event) error {
 		return err
 	}
 
-	rc := redisc.RedisConnPool.Get()
-	defer rc.Close()
-
-	if _, err := rc.Do("LPUSH", callbackQueue, string(es)); err != nil {
+	if err := redisc.LPUSH(callbackQueue, string(es)); err != nil {
 		logger.Errorf("lpush %+v error: %v", string(es), err)
 		return err
 	}
@@ -83,10 +80,7 @@ func PushCallbackEvent(event *model.Event) error {
 }
 
 func PopCallbackEvent(queue string) *model.Event {
-	rc := redisc.RedisConnPool.Get()
-	defer rc.Close()
-
-	ret, err := redis.String(rc.Do("RPOP", queue))
+	ret, err := redisc.RPOP(queue)
 	if err != nil {
 		if err != redis.ErrNil {
 			logger.Errorf("rpop queue:%s failed, err: %v", queue, err)
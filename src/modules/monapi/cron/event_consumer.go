@@ -32,6 +32,26 @@ func consume(event *model.Event) {
 		return
 	}
 
+	// 依赖的策略正在告警，设置状态为"已抑制"，不再通知
+	if isInhibited(event) {
+		SetEventStatus(event, model.STATUS_INHIBIT)
+		return
+	}
+
+	// 抖动的event在judge那里每个抖动周期只会产生一个，不参与升级和收敛，直接通知
+	if event.EventType == config.FLAPPING {
+		SetEventStatus(event, model.STATUS_FLAPPING)
+
+		if strings.TrimSpace(event.Users) == "[]" && strings.TrimSpace(event.Groups) == "[]" {
+			SetEventStatus(event, model.STATUS_NONEUSER)
+			return
+		}
+
+		go notify.DoNotify(false, event)
+		SetEventStatus(event, model.STATUS_SEND)
+		return
+	}
+
 	if event.NeedUpgrade == 1 {
 		needUpgrade, needNotify := isAlertUpgrade(event)
 		if needUpgrade {
@@ -270,7 +290,7 @@ func SetEventStatus(event *model.Event, status string) {
 		logger.Infof("set event status succ, event hashid: %v, status: %v", event.HashId, status)
 	}
 
-	if event.EventType == config.ALERT {
+	if event.EventType == config.ALERT || event.EventType == config.FLAPPING {
 		if err := model.SaveEventCurStatus(event.HashId, status); err != nil {
 			logger.Errorf("set event_cur status fail, event: %+v, status: %v, err:%v", event, status, err)
 		} else {
@@ -34,18 +34,13 @@ func EventConsumer() {
 // 什么情况需要让上层for循环sleep呢？
 // 1. 读取redis i/o超时，表示redis有问题，或者此时queue中压根就没有event
 // 2. 访问数据库报错，此时继续玩命搞也没啥意义，sleep一下等数据库恢复
-func popEvent(queues []interface{}) (*model.Event, bool) {
+func popEvent(queues []string) (*model.Event, bool) {
 	// 1 是BRPOP的超时时间，1秒超时，理论上可以设置为0，但是每个redis连接
 	// 有个read timeout在创建redis连接池的时候统一指定，所以，如果这里
 	// 设置为0，并且queue里迟迟没有数据，因为read timeout的缘故，必然每次
 	// 都会报出read timeout的超时，看着挺烦的，最佳实践这里设置为1s，read
 	// timeout设置为3s
-	queues = append(queues, 1)
-
-	rc := redisc.RedisConnPool.Get()
-	defer rc.Close()
-
-	reply, err := redis.Strings(rc.Do("BRPOP", queues...))
+	_, reply, err := redisc.BRPOP(queues, 1)
 	if err != nil {
 		if err != redis.ErrNil {
 			logger.Warningf("get alarm event from redis failed, queues: %v, err: %v", queues, err)
@@ -53,13 +48,8 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 		return nil, true
 	}
 
-	if reply == nil {
-		logger.Errorf("get alarm event from redis timeout")
-		return nil, true
-	}
-
 	event := new(model.Event)
-	if err = json.Unmarshal([]byte(reply[1]), event); err != nil {
+	if err = json.Unmarshal([]byte(reply), event); err != nil {
 		logger.Errorf("unmarshal redis reply failed, err: %v", err)
 		return nil, false
 	}
@@ -71,21 +61,6 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 		return nil, false
 	}
 
-	// 如果nid和endpoint的对应关系不正确，直接丢弃该event
-	// 可能endpoint挪了节点
-	endpoint, err := model.EndpointGet("ident", event.Endpoint)
-	if err != nil {
-		logger.Errorf("get host_id failed, event: %+v, err: %v", event, err)
-		return nil, true
-	}
-
-	if endpoint == nil {
-		logger.Errorf("endpoint[%s] not found, event: %+v", event.Endpoint, event)
-		return nil, false
-	}
-
-	nodePath := ""
-
 	node, err := model.NodeGet("id", stra.Nid)
 	if err != nil {
 		logger.Errorf("get node failed, node id: %v, event: %+v, err: %v", stra.Nid, event, err)
@@ -97,38 +72,18 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 		return nil, false
 	}
 
-	nodePath = node.Path
-
-	leafIds, err := node.LeafIds()
-	if err != nil {
-		logger.Errorf("get node leaf ids failed, node id: %v, event: %+v, err: %v", stra.Nid, event, err)
-		return nil, true
-	}
+	nodePath := node.Path
 
-	nodeIds, err := model.NodeIdsGetByEndpointId(endpoint.Id)
-	if err != nil {
-		logger.Errorf("get node_endpoint by endpoint_id fail: %v, event: %+v", err, event)
-		return nil, true
-	}
-
-	if nodeIds == nil || len(nodeIds) == 0 {
-		logger.Errorf("endpoint[%s] not bind any node, event: %+v", event.Endpoint, event)
-		return nil, false
-	}
-
-	has = false
-	for i := 0; i < len(nodeIds); i++ {
-		for j := 0; j < len(leafIds); j++ {
-			if nodeIds[i] == leafIds[j] {
-				has = true
-				break
-			}
+	endpointAlias := ""
+	if stra.IsAggr() {
+		// 集群策略的event产生在节点上，没有对应的endpoint
+		event.Endpoint = nodePath
+	} else {
+		endpoint, sleep := checkEventEndpoint(event, stra, node)
+		if endpoint == nil {
+			return nil, sleep
 		}
-	}
-
-	if !has {
-		logger.Errorf("endpoint(%s) not match nid(%v), event: %+v", event.Endpoint, stra.Nid, event)
-		return nil, false
+		endpointAlias = endpoint.Alias
 	}
 
 	users, err := json.Marshal(stra.NotifyUser)
@@ -151,7 +106,7 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 
 	// 补齐event中的字段
 	event.Sname = stra.Name
-	event.EndpointAlias = endpoint.Alias
+	event.EndpointAlias = endpointAlias
 	event.Category = stra.Category
 	event.Priority = stra.Priority
 	event.Nid = stra.Nid
@@ -166,9 +121,10 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 		return event, true
 	}
 
-	if event.EventType == config.ALERT {
+	// 抖动期间不再有告警和恢复，当前告警按照抖动展示
+	if event.EventType == config.ALERT || event.EventType == config.FLAPPING {
 		eventCur := new(model.EventCur)
-		if err = json.Unmarshal([]byte(reply[1]), eventCur); err != nil {
+		if err = json.Unmarshal([]byte(reply), eventCur); err != nil {
 			logger.Errorf("unmarshal redis reply failed, err: %v, event: %+v", err, event)
 		}
 
@@ -181,7 +137,8 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 		eventCur.NodePath = nodePath
 		eventCur.NeedUpgrade = stra.NeedUpgrade
 		eventCur.AlertUpgrade = alertUpgrade
-		eventCur.EndpointAlias = endpoint.Alias
+		eventCur.Endpoint = event.Endpoint
+		eventCur.EndpointAlias = endpointAlias
 		eventCur.Status = 0
 		eventCur.Claimants = "[]"
 		err = model.SaveEventCur(eventCur)
@@ -199,3 +156,52 @@ func popEvent(queues []interface{}) (*model.Event, bool) {
 
 	return event, false
 }
+
+// 如果nid和endpoint的对应关系不正确，直接丢弃该event
+// 可能endpoint挪了节点，返回nil时第二个返回值表示上层是否需要sleep
+func checkEventEndpoint(event *model.Event, stra *model.Stra, node *model.Node) (*model.Endpoint, bool) {
+	endpoint, err := model.EndpointGet("ident", event.Endpoint)
+	if err != nil {
+		logger.Errorf("get host_id failed, event: %+v, err: %v", event, err)
+		return nil, true
+	}
+
+	if endpoint == nil {
+		logger.Errorf("endpoint[%s] not found, event: %+v", event.Endpoint, event)
+		return nil, false
+	}
+
+	leafIds, err := node.LeafIds()
+	if err != nil {
+		logger.Errorf("get node leaf ids failed, node id: %v, event: %+v, err: %v", stra.Nid, event, err)
+		return nil, true
+	}
+
+	nodeIds, err := model.NodeIdsGetByEndpointId(endpoint.Id)
+	if err != nil {
+		logger.Errorf("get node_endpoint by endpoint_id fail: %v, event: %+v", err, event)
+		return nil, true
+	}
+
+	if nodeIds == nil || len(nodeIds) == 0 {
+		logger.Errorf("endpoint[%s] not bind any node, event: %+v", event.Endpoint, event)
+		return nil, false
+	}
+
+	has := false
+	for i := 0; i < len(nodeIds); i++ {
+		for j := 0; j < len(leafIds); j++ {
+			if nodeIds[i] == leafIds[j] {
+				has = true
+				break
+			}
+		}
+	}
+
+	if !has {
+		logger.Errorf("endpoint(%s) not match nid(%v), event: %+v", event.Endpoint, stra.Nid, event)
+		return nil, false
+	}
+
+	return endpoint, false
+}
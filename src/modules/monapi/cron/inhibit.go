@@ -0,0 +1,119 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/monapi/config"
+	"github.com/didi/nightingale/src/modules/monapi/mcache"
+	"github.com/didi/nightingale/src/modules/monapi/redisc"
+)
+
+const PrefixInhibit = "/n9e/inhibit/"
+
+// 抑制判断用到的db和redis操作，测试时替换
+var (
+	eventCurGetsBySid          = model.EventCurGetsBySid
+	nodeIdsGetByEndpointIdents = model.NodeIdsGetByEndpointIdents
+	hasInhibitKey              = redisc.HasKey
+	delInhibitKey              = redisc.DelKey
+	setInhibitKey              = redisc.SetWithTTL
+)
+
+// isInhibited 判断event是否被依赖的策略抑制
+// 被抑制的告警会在redis中留下记录，对应的恢复event也一起抑制，不再单独通知
+func isInhibited(event *model.Event) bool {
+	inhibitKey := PrefixInhibit + fmt.Sprint(event.HashId)
+
+	if event.EventType == config.RECOVERY {
+		if !hasInhibitKey(inhibitKey) {
+			return false
+		}
+
+		if err := delInhibitKey(inhibitKey); err != nil {
+			logger.Errorf("redis del inhibitKey failed, key: %v, err: %v", inhibitKey, err)
+		}
+		return true
+	}
+
+	if !inhibitedByStra(event) {
+		// 依赖的策略已经恢复，之后的恢复event需要正常通知
+		if hasInhibitKey(inhibitKey) {
+			if err := delInhibitKey(inhibitKey); err != nil {
+				logger.Errorf("redis del inhibitKey failed, key: %v, err: %v", inhibitKey, err)
+			}
+		}
+		return false
+	}
+
+	if err := setInhibitKey(inhibitKey, time.Now().Unix(), 30*24*3600); err != nil {
+		logger.Errorf("set inhibitKey failed, key: %v, err: %v", inhibitKey, err)
+	}
+	return true
+}
+
+func inhibitedByStra(event *model.Event) bool {
+	stra, exists := mcache.StraCache.GetById(event.Sid)
+	if !exists || len(stra.Inhibit) == 0 {
+		return false
+	}
+
+	// 按节点抑制时，涉及到的endpoint一次查出挂载的节点，避免每个event_cur都查一次db
+	var nodeCurs []*model.EventCur
+	for _, inhibit := range stra.Inhibit {
+		curs, err := eventCurGetsBySid(inhibit.Sid)
+		if err != nil {
+			logger.Errorf("get event_cur by sid failed, sid: %v, err: %v", inhibit.Sid, err)
+			continue
+		}
+
+		for i := range curs {
+			if curs[i].Endpoint == event.Endpoint {
+				logger.Infof("event hashid: %v inhibited by sid: %v endpoint: %v", event.HashId, inhibit.Sid, curs[i].Endpoint)
+				return true
+			}
+
+			if inhibit.Scope == "node" {
+				nodeCurs = append(nodeCurs, &curs[i])
+			}
+		}
+	}
+
+	if len(nodeCurs) == 0 {
+		return false
+	}
+
+	idents := []string{event.Endpoint}
+	for _, cur := range nodeCurs {
+		idents = append(idents, cur.Endpoint)
+	}
+
+	nodeIds, err := nodeIdsGetByEndpointIdents(idents)
+	if err != nil {
+		logger.Errorf("get node ids failed, endpoints: %v, err: %v", idents, err)
+		return false
+	}
+
+	for _, cur := range nodeCurs {
+		if hasSameNode(nodeIds[event.Endpoint], nodeIds[cur.Endpoint]) {
+			logger.Infof("event hashid: %v inhibited by sid: %v endpoint: %v", event.HashId, cur.Sid, cur.Endpoint)
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasSameNode(a, b []int64) bool {
+	for i := 0; i < len(a); i++ {
+		for j := 0; j < len(b); j++ {
+			if a[i] == b[j] {
+				return true
+			}
+		}
+	}
+	return false
+}
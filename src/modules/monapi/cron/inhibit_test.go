@@ -0,0 +1,132 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/didi/nightingale/src/model"
+	"github.com/didi/nightingale/src/modules/monapi/config"
+	"github.com/didi/nightingale/src/modules/monapi/mcache"
+)
+
+// 策略2按节点依赖策略1，策略3按endpoint依赖策略1
+// 策略1在db01上告警，web01和db01挂载在同一个节点下，web02在其他节点
+func mockInhibit() (curs map[int64][]model.EventCur, keys map[string]bool, lookups *int) {
+	mcache.StraCache = mcache.NewStraCache()
+	mcache.StraCache.SetAll(map[int64]*model.Stra{
+		1: {Id: 1},
+		2: {Id: 2, Inhibit: []model.Inhibit{{Sid: 1, Scope: "node"}}},
+		3: {Id: 3, Inhibit: []model.Inhibit{{Sid: 1, Scope: "endpoint"}}},
+	})
+
+	curs = map[int64][]model.EventCur{
+		1: {{Sid: 1, Endpoint: "db01"}},
+	}
+	nodes := map[string][]int64{
+		"web01": {10},
+		"db01":  {10, 11},
+		"web02": {12},
+	}
+	keys = make(map[string]bool)
+	lookups = new(int)
+
+	eventCurGetsBySid = func(sid int64) ([]model.EventCur, error) {
+		return curs[sid], nil
+	}
+	nodeIdsGetByEndpointIdents = func(idents []string) (map[string][]int64, error) {
+		*lookups++
+		ret := make(map[string][]int64)
+		for _, ident := range idents {
+			ret[ident] = nodes[ident]
+		}
+		return ret, nil
+	}
+	hasInhibitKey = func(key string) bool {
+		return keys[key]
+	}
+	delInhibitKey = func(key string) error {
+		delete(keys, key)
+		return nil
+	}
+	setInhibitKey = func(key string, value interface{}, ttl int) error {
+		keys[key] = true
+		return nil
+	}
+	return curs, keys, lookups
+}
+
+func TestInhibitedByStra(t *testing.T) {
+	_, _, lookups := mockInhibit()
+
+	cases := []struct {
+		sid       int64
+		endpoint  string
+		inhibited bool
+		lookups   int
+	}{
+		{2, "db01", true, 0},  // 相同endpoint不需要查节点
+		{2, "web01", true, 1}, // 挂载在相同节点下
+		{2, "web02", false, 1},
+		{3, "web01", false, 0}, // 按endpoint抑制时不看节点
+		{1, "db01", false, 0},  // 没有依赖的策略
+		{4, "db01", false, 0},  // 策略不存在
+	}
+
+	for _, c := range cases {
+		*lookups = 0
+		event := &model.Event{Sid: c.sid, Endpoint: c.endpoint, EventType: config.ALERT}
+		if inhibited := inhibitedByStra(event); inhibited != c.inhibited || *lookups != c.lookups {
+			t.Errorf("sid %d endpoint %s: got inhibited %v lookups %d, want %v %d",
+				c.sid, c.endpoint, inhibited, *lookups, c.inhibited, c.lookups)
+		}
+	}
+}
+
+func TestIsInhibited(t *testing.T) {
+	curs, keys, _ := mockInhibit()
+
+	alert := &model.Event{Sid: 2, Endpoint: "web01", HashId: 100, EventType: config.ALERT}
+	recovery := &model.Event{Sid: 2, Endpoint: "web01", HashId: 100, EventType: config.RECOVERY}
+	key := PrefixInhibit + "100"
+
+	// 被抑制的告警留下记录，对应的恢复也一起抑制，之后删除记录
+	if !isInhibited(alert) || !keys[key] {
+		t.Fatal("alert should be inhibited and recorded")
+	}
+	if !isInhibited(recovery) || keys[key] {
+		t.Fatal("recovery should be inhibited and the record deleted")
+	}
+
+	// 没有被抑制的恢复正常通知
+	if isInhibited(recovery) {
+		t.Fatal("recovery without record should not be inhibited")
+	}
+
+	// 依赖的策略恢复之后再次告警，删除记录，之后的恢复正常通知
+	if !isInhibited(alert) || !keys[key] {
+		t.Fatal("alert should be inhibited and recorded")
+	}
+	delete(curs, 1)
+	if isInhibited(alert) || keys[key] {
+		t.Fatal("alert should not be inhibited after dependency recovered")
+	}
+	if isInhibited(recovery) {
+		t.Fatal("recovery should be notified after dependency recovered")
+	}
+}
+
+func TestHasSameNode(t *testing.T) {
+	cases := []struct {
+		a, b []int64
+		same bool
+	}{
+		{[]int64{1, 2}, []int64{3, 2}, true},
+		{[]int64{1}, []int64{2}, false},
+		{nil, []int64{1}, false},
+		{[]int64{1}, nil, false},
+	}
+	for _, c := range cases {
+		if same := hasSameNode(c.a, c.b); same != c.same {
+			t.Errorf("hasSameNode(%v, %v) = %v, want %v", c.a, c.b, same, c.same)
+		}
+	}
+}
@@ -21,7 +21,7 @@ type eventData struct {
 	Nid          int64               `json:"nid"`
 	Endpoint     string              `json:"endpoint"`
 	Priority     int                 `json:"priority"`
-	EventType    string              `json:"event_type"` // alert|recovery
+	EventType    string              `json:"event_type"` // alert|recovery|flapping
 	Category     int                 `json:"category"`
 	HashId       uint64              `json:"hashid"  xorm:"hashid"`
 	Etime        int64               `json:"etime"`
@@ -122,6 +122,7 @@ func Config(r *gin.Engine) {
 		login.DELETE("/stra", strasDel)
 		login.GET("/stra", strasGet)
 		login.GET("/stra/:sid", straGet)
+		login.POST("/stra/backtest", straBacktest)
 	}
 
 	v1 := r.Group("/v1/portal").Use(middleware.CheckHeaderToken())
@@ -1,11 +1,18 @@
 package routes
 
 import (
+	"fmt"
+	"math/rand"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/toolkits/pkg/errors"
+	"github.com/toolkits/pkg/logger"
+	"github.com/toolkits/pkg/net/httplib"
 
 	"github.com/didi/nightingale/src/model"
 	"github.com/didi/nightingale/src/modules/monapi/scache"
+	"github.com/didi/nightingale/src/toolkits/address"
 )
 
 func straPost(c *gin.Context) {
@@ -17,6 +24,7 @@ func straPost(c *gin.Context) {
 	stra.LastUpdator = me.Username
 
 	errors.Dangerous(stra.Encode())
+	errors.Dangerous(stra.CheckInhibit())
 
 	oldStra, _ := model.StraGet("name", stra.Name)
 	if oldStra != nil && oldStra.Nid == stra.Nid {
@@ -41,6 +49,7 @@ func straPut(c *gin.Context) {
 
 	stra.LastUpdator = me.Username
 	errors.Dangerous(stra.Encode())
+	errors.Dangerous(stra.CheckInhibit())
 
 	oldStra, _ := model.StraGet("name", stra.Name)
 	if oldStra != nil && oldStra.Id != stra.Id && oldStra.Nid == stra.Nid {
@@ -113,3 +122,62 @@ func effectiveStrasGet(c *gin.Context) {
 	}
 	renderData(c, stras, nil)
 }
+
+type straBacktestForm struct {
+	Stra  *model.Stra `json:"stra"`
+	Start int64       `json:"start"`
+	End   int64       `json:"end"`
+}
+
+// straBacktest 补全策略关联的endpoint之后交给judge回放，不会产生真实的event
+func straBacktest(c *gin.Context) {
+	var f straBacktestForm
+	errors.Dangerous(c.ShouldBind(&f))
+	if f.Stra == nil {
+		errors.Bomb("stra is blank")
+	}
+
+	stra := f.Stra
+	errors.Dangerous(stra.Encode())
+
+	leafNids, err := scache.GetLeafNids(stra.Nid, stra.ExclNid)
+	errors.Dangerous(err)
+
+	endpoints, err := model.EndpointUnderLeafs(leafNids)
+	errors.Dangerous(err)
+
+	stra.LeafNids = leafNids
+	stra.Endpoints = []string{}
+	for _, e := range endpoints {
+		stra.Endpoints = append(stra.Endpoints, e.Ident)
+	}
+
+	f.Stra = stra
+
+	addrs := address.GetHTTPAddresses("judge")
+	if len(addrs) == 0 {
+		errors.Bomb("empty judge addr")
+	}
+
+	var resp struct {
+		Dat interface{} `json:"dat"`
+		Err string      `json:"err"`
+	}
+	// 回放不依赖judge上的状态，任意一个judge实例都可以处理
+	perm := rand.Perm(len(addrs))
+	for i := range perm {
+		url := fmt.Sprintf("http://%s/api/judge/backtest", addrs[perm[i]])
+		err = httplib.Post(url).JSONBodyQuiet(f).SetTimeout(60 * time.Second).ToJSON(&resp)
+		if err == nil {
+			break
+		}
+		logger.Warningf("backtest on judge %s failed, error:%v", addrs[perm[i]], err)
+	}
+	errors.Dangerous(err)
+
+	if resp.Err != "" {
+		errors.Bomb(resp.Err)
+	}
+
+	renderData(c, resp.Dat, nil)
+}
@@ -238,10 +238,7 @@ func send(message Message) {
 
 	queue := config.Get().Queue.SenderPrefix + message.NotifyType
 
-	rc := redisc.RedisConnPool.Get()
-	defer rc.Close()
-
-	if _, err := rc.Do("LPUSH", queue, payload); err != nil {
+	if err := redisc.LPUSH(queue, payload); err != nil {
 		logger.Errorf("LPUSH %s error: %v", queue, err)
 	}
 }
@@ -6,19 +6,13 @@ import (
 )
 
 func HasKey(key string) bool {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	ret, _ := redis.Bool(rc.Do("EXISTS", key))
+	ret, _ := redis.Bool(RedisClient.Do("EXISTS", key))
 
 	return ret
 }
 
 func INCR(key string) int {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	ret, err := redis.Int(rc.Do("INCR", key))
+	ret, err := redis.Int(RedisClient.Do("INCR", key))
 	if err != nil {
 		logger.Errorf("incr %s error: %v", key, err)
 	}
@@ -27,10 +21,7 @@ func INCR(key string) int {
 }
 
 func GET(key string) int64 {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	ret, err := redis.Int64(rc.Do("GET", key))
+	ret, err := redis.Int64(RedisClient.Do("GET", key))
 	if err != nil {
 		logger.Debugf("get %+v error: %v", key, err)
 	}
@@ -39,46 +30,42 @@ func GET(key string) int64 {
 }
 
 func SetWithTTL(key string, value interface{}, ttl int) error {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	_, err := rc.Do("SET", key, value, "EX", ttl)
+	_, err := RedisClient.Do("SET", key, value, "EX", ttl)
 	return err
 }
 
 func Set(key string, value interface{}) error {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	_, err := rc.Do("SET", key, value)
+	_, err := RedisClient.Do("SET", key, value)
 	return err
 }
 
 func DelKey(key string) error {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	_, err := rc.Do("DEL", key)
+	_, err := RedisClient.Do("DEL", key)
 	return err
 }
 
 func HSET(key string, field interface{}, value interface{}) (int64, error) {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	return redis.Int64(rc.Do("HSET", key, field, value))
+	return redis.Int64(RedisClient.Do("HSET", key, field, value))
 }
 
 func HKEYS(key string) ([]string, error) {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
-
-	return redis.Strings(rc.Do("HKEYS", key))
+	return redis.Strings(RedisClient.Do("HKEYS", key))
 }
 
 func HDEL(keys []interface{}) (int64, error) {
-	rc := RedisConnPool.Get()
-	defer rc.Close()
+	return redis.Int64(RedisClient.Do("HDEL", keys...))
+}
+
+func LPUSH(queue string, value string) error {
+	_, err := RedisClient.Do("LPUSH", queue, value)
+	return err
+}
+
+func RPOP(queue string) (string, error) {
+	return redis.String(RedisClient.Do("RPOP", queue))
+}
 
-	return redis.Int64(rc.Do("HDEL", keys...))
+// BRPOP 按照queues的顺序取数据，超时返回redis.ErrNil
+func BRPOP(queues []string, timeout int) (string, string, error) {
+	return RedisClient.BRPop(timeout, queues...)
 }
@@ -1,60 +1,38 @@
 package redisc
 
 import (
+	"log"
 	"time"
 
-	"github.com/garyburd/redigo/redis"
 	"github.com/toolkits/pkg/logger"
 
 	"github.com/didi/nightingale/src/modules/monapi/config"
+	"github.com/didi/nightingale/src/toolkits/redispool"
 )
 
-var RedisConnPool *redis.Pool
+var RedisClient redispool.Client
 
 func InitRedis() {
 	cfg := config.Get()
 
-	addr := cfg.Redis.Addr
-	pass := cfg.Redis.Pass
-	maxIdle := cfg.Redis.Idle
-	idleTimeout := 240 * time.Second
-
-	connTimeout := time.Duration(cfg.Redis.Timeout.Conn) * time.Millisecond
-	readTimeout := time.Duration(cfg.Redis.Timeout.Read) * time.Millisecond
-	writeTimeout := time.Duration(cfg.Redis.Timeout.Write) * time.Millisecond
-
-	RedisConnPool = &redis.Pool{
-		MaxIdle:     maxIdle,
-		IdleTimeout: idleTimeout,
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", addr, redis.DialConnectTimeout(connTimeout), redis.DialReadTimeout(readTimeout), redis.DialWriteTimeout(writeTimeout))
-			if err != nil {
-				return nil, err
-			}
-
-			if pass != "" {
-				if _, err := c.Do("AUTH", pass); err != nil {
-					c.Close()
-					logger.Error("redis auth fail, pass: ", pass)
-					return nil, err
-				}
-			}
-
-			return c, err
-		},
-		TestOnBorrow: PingRedis,
-	}
-}
-
-func PingRedis(c redis.Conn, t time.Time) error {
-	_, err := c.Do("ping")
+	var err error
+	RedisClient, err = redispool.New(redispool.Options{
+		Mode:         cfg.Redis.Mode,
+		Addrs:        cfg.Redis.Addrs,
+		MasterName:   cfg.Redis.MasterName,
+		Pass:         cfg.Redis.Pass,
+		Idle:         cfg.Redis.Idle,
+		ConnTimeout:  time.Duration(cfg.Redis.Timeout.Conn) * time.Millisecond,
+		ReadTimeout:  time.Duration(cfg.Redis.Timeout.Read) * time.Millisecond,
+		WriteTimeout: time.Duration(cfg.Redis.Timeout.Write) * time.Millisecond,
+	})
 	if err != nil {
-		logger.Error("ping redis fail: ", err)
+		// 告警event从redis读取，redis不可用时monapi无法工作，直接退出
+		log.Fatalf("init redis err: %v", err)
 	}
-	return err
 }
 
 func CloseRedis() {
 	logger.Info("closing redis...")
-	RedisConnPool.Close()
+	RedisClient.Close()
 }
@@ -1,13 +1,13 @@
 package backend
 
 import (
-	"github.com/toolkits/pkg/container/list"
 	"github.com/toolkits/pkg/container/set"
 	"github.com/toolkits/pkg/pool"
 	"github.com/toolkits/pkg/str"
 
 	"github.com/didi/nightingale/src/modules/transfer/cache"
 	"github.com/didi/nightingale/src/toolkits/report"
+	"github.com/didi/nightingale/src/toolkits/spool"
 )
 
 type BackendSection struct {
@@ -19,6 +19,10 @@ type BackendSection struct {
 	MaxConns    int  `yaml:"maxConns"`
 	MaxIdle     int  `yaml:"maxIdle"`
 
+	Spool       SpoolSection            `yaml:"spool"`
+	QueryCache  QueryCacheSection       `yaml:"queryCache"`
+	QueryLimit  QueryLimitSection       `yaml:"queryLimit"`
+	RemoteWrite []RemoteWriteSection    `yaml:"remoteWrite"`
 	Replicas    int                     `yaml:"replicas"`
 	Cluster     map[string]string       `yaml:"cluster"`
 	ClusterList map[string]*ClusterNode `json:"clusterList"`
@@ -36,7 +40,7 @@ var (
 	TsdbNodeRing *ConsistentHashRing
 
 	// 发送缓存队列 node -> queue_of_data
-	TsdbQueues  = make(map[string]*list.SafeListLimited)
+	TsdbQueues  = make(map[string]*spool.Queue)
 	JudgeQueues = cache.SafeJudgeQueue{}
 
 	// 连接池 node_address -> connection_pool
@@ -58,6 +62,12 @@ func Init(cfg BackendSection) {
 	initSendQueues()
 
 	startSendTasks()
+	initRemoteWriters()
+	initQueryCache()
+
+	if Config.Spool.Enabled {
+		go reportSpool()
+	}
 }
 
 func initHashRing() {
@@ -82,14 +92,15 @@ func initConnPools() {
 func initSendQueues() {
 	for node, item := range Config.ClusterList {
 		for _, addr := range item.Addrs {
-			TsdbQueues[node+addr] = list.NewSafeListLimited(DefaultSendQueueMaxSize)
+			TsdbQueues[node+addr] = newTsdbQueue(node + addr)
 		}
 	}
 
 	JudgeQueues = cache.NewJudgeQueue()
 	judges := GetJudges()
 	for _, judge := range judges {
-		JudgeQueues.Set(judge, list.NewSafeListLimited(DefaultSendQueueMaxSize))
+		q, _ := NewJudgeQueue(judge)
+		JudgeQueues.Set(judge, q)
 	}
 }
 
@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// QueryLimitSection 单个请求的查询限制，0表示不限制
+// 超过限制时停止查询，返回已经查到的数据并标记为不完整
+type QueryLimitSection struct {
+	MaxSeries int `yaml:"maxSeries"` // 最多查询的曲线条数
+	MaxPoints int `yaml:"maxPoints"` // 最多返回的点数
+	Timeout   int `yaml:"timeout"`   // 整个请求的查询时间，单位毫秒
+}
+
+const (
+	LimitSeries  = "maxSeries"
+	LimitPoints  = "maxPoints"
+	LimitTimeout = "timeout"
+)
+
+// 同时查询tsdb的goroutine个数
+const fetchWorkerNum = 100
+
+// QueryStat 一个请求的查询统计，Partial为true时Limits中是触发的限制
+type QueryStat struct {
+	Partial bool     `json:"partial"`
+	Limits  []string `json:"limits"`
+	Series  int      `json:"series"`
+	Points  int      `json:"points"`
+}
+
+func (s *QueryStat) hit(limit string) {
+	s.Partial = true
+	for _, l := range s.Limits {
+		if l == limit {
+			return
+		}
+	}
+	s.Limits = append(s.Limits, limit)
+	stats.Counter.Set("query.limit."+limit, 1)
+}
+
+// QueryLimiter 同一个请求中的多次查询共用一份限制，不能并发使用
+type QueryLimiter struct {
+	Stat     QueryStat
+	limit    QueryLimitSection
+	deadline time.Time
+}
+
+// NewQueryLimiter 使用配置中的限制，超时从创建时开始计算
+func NewQueryLimiter() *QueryLimiter {
+	return newQueryLimiter(Config.QueryLimit)
+}
+
+// NewRPCQueryLimiter judge等内部模块通过rpc查询时使用，不做限制，保证结果完整
+func NewRPCQueryLimiter() *QueryLimiter {
+	return newQueryLimiter(QueryLimitSection{})
+}
+
+func newQueryLimiter(limit QueryLimitSection) *QueryLimiter {
+	l := &QueryLimiter{limit: limit}
+	if limit.Timeout > 0 {
+		l.deadline = time.Now().Add(time.Duration(limit.Timeout) * time.Millisecond)
+	}
+	return l
+}
+
+type fetchTask struct {
+	start      int64
+	end        int64
+	consolFunc string
+	endpoint   string
+	counter    string
+	step       int
+}
+
+type fetchFunc func(t fetchTask) (*dataobj.TsdbQueryResponse, error)
+
+var queryTask fetchFunc = func(t fetchTask) (*dataobj.TsdbQueryResponse, error) {
+	return fetchData(t.start, t.end, t.consolFunc, t.endpoint, t.counter, t.step)
+}
+
+// fetch 并发查询，超过限制之后不再发起新的查询，已经发出的查询结果直接丢弃
+func (l *QueryLimiter) fetch(tasks []fetchTask, fn fetchFunc) []*dataobj.TsdbQueryResponse {
+	resp := []*dataobj.TsdbQueryResponse{}
+	if len(tasks) == 0 {
+		return resp
+	}
+
+	if l.limit.MaxSeries > 0 {
+		remain := l.limit.MaxSeries - l.Stat.Series
+		if remain < 0 {
+			remain = 0
+		}
+		if len(tasks) > remain {
+			tasks = tasks[:remain]
+			l.Stat.hit(LimitSeries)
+		}
+		if len(tasks) == 0 {
+			return resp
+		}
+	}
+
+	var deadline <-chan time.Time
+	if !l.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(l.deadline))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// 按照任务数分配缓冲，提前返回之后还在执行的goroutine也不会阻塞
+	dataChan := make(chan *dataobj.TsdbQueryResponse, len(tasks))
+	worker := make(chan struct{}, fetchWorkerNum) //控制goroutine并发数
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for _, t := range tasks {
+			select {
+			case worker <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			go func(t fetchTask) {
+				defer func() { <-worker }()
+				data, err := fn(t)
+				if err != nil {
+					logger.Warning(err)
+				}
+				dataChan <- data
+			}(t)
+		}
+	}()
+
+	for i := 0; i < len(tasks); i++ {
+		select {
+		case d := <-dataChan:
+			if d == nil {
+				continue
+			}
+			if l.limit.MaxPoints > 0 && l.Stat.Points+len(d.Values) > l.limit.MaxPoints {
+				l.Stat.hit(LimitPoints)
+				return resp
+			}
+			l.Stat.Series++
+			l.Stat.Points += len(d.Values)
+			resp = append(resp, d)
+		case <-deadline:
+			l.Stat.hit(LimitTimeout)
+			return resp
+		}
+	}
+	return resp
+}
+
+// FetchData 按照endpoint和counter拆分成单条曲线查询，超过限制时记录在Stat中
+func (l *QueryLimiter) FetchData(inputs []dataobj.QueryData) []*dataobj.TsdbQueryResponse {
+	tasks := []fetchTask{}
+	for _, input := range inputs {
+		for _, endpoint := range input.Endpoints {
+			for _, counter := range input.Counters {
+				tasks = append(tasks, fetchTask{input.Start, input.End, input.ConsolFunc, endpoint, counter, input.Step})
+			}
+		}
+	}
+	return l.fetch(tasks, queryTask)
+}
+
+// FetchDataForUI 按照endpoint和tag查询，有AggrFunc时再聚合计算，超过限制时记录在Stat中
+func (l *QueryLimiter) FetchDataForUI(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
+	tasks := []fetchTask{}
+	for _, endpoint := range input.Endpoints {
+		tags := input.Tags
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+		for _, tag := range tags {
+			counter, err := getCounter(input.Metric, tag, nil)
+			if err != nil {
+				logger.Warning(err)
+				continue
+			}
+			tasks = append(tasks, fetchTask{input.Start, input.End, input.ConsolFunc, endpoint, counter, input.Step})
+		}
+	}
+
+	resp := l.fetch(tasks, queryTask)
+
+	//进行数据计算，只有一条曲线时也要计算，count、stddev等的结果和原始值不同
+	if input.AggrFunc != "" {
+		return aggrDataForUI(input, resp)
+	}
+	return resp
+}
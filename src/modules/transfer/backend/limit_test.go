@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+func TestQueryLimiter(t *testing.T) {
+	stats.Counter = stats.NewCounter("test")
+
+	tasks := make([]fetchTask, 300)
+	for i := range tasks {
+		tasks[i] = fetchTask{endpoint: "h", counter: "cpu.idle", start: 100, end: 190}
+	}
+
+	// 每条曲线10个点
+	fast := func(t fetchTask) (*dataobj.TsdbQueryResponse, error) {
+		d := &dataobj.TsdbQueryResponse{Endpoint: t.endpoint, Counter: t.counter}
+		for ts := t.start; ts <= t.end; ts += 10 {
+			d.Values = append(d.Values, dataobj.NewRRDData(ts, 1))
+		}
+		return d, nil
+	}
+	slow := func(t fetchTask) (*dataobj.TsdbQueryResponse, error) {
+		time.Sleep(time.Second)
+		return fast(t)
+	}
+
+	cases := []struct {
+		name   string
+		limit  QueryLimitSection
+		fn     fetchFunc
+		series int
+		limits []string
+	}{
+		{"unlimited", QueryLimitSection{}, fast, 300, nil},
+		{"series", QueryLimitSection{MaxSeries: 120}, fast, 120, []string{LimitSeries}},
+		{"points", QueryLimitSection{MaxPoints: 1005}, fast, 100, []string{LimitPoints}},
+		{"timeout", QueryLimitSection{Timeout: 50}, slow, 0, []string{LimitTimeout}},
+	}
+
+	for _, c := range cases {
+		l := newQueryLimiter(c.limit)
+		resp := l.fetch(tasks, c.fn)
+		if len(resp) != c.series || l.Stat.Series != c.series || l.Stat.Points != c.series*10 {
+			t.Errorf("%s: got %d series, stat %+v, want %d series", c.name, len(resp), l.Stat, c.series)
+		}
+		if l.Stat.Partial != (c.limits != nil) || !reflect.DeepEqual(l.Stat.Limits, c.limits) {
+			t.Errorf("%s: got partial=%v limits=%v, want %v", c.name, l.Stat.Partial, l.Stat.Limits, c.limits)
+		}
+	}
+}
+
+// 同一个请求中的多次查询共用限制
+func TestQueryLimiterShared(t *testing.T) {
+	stats.Counter = stats.NewCounter("test")
+
+	fn := func(t fetchTask) (*dataobj.TsdbQueryResponse, error) {
+		return &dataobj.TsdbQueryResponse{Endpoint: t.endpoint}, nil
+	}
+	tasks := []fetchTask{{endpoint: "a"}, {endpoint: "b"}, {endpoint: "c"}}
+
+	l := newQueryLimiter(QueryLimitSection{MaxSeries: 4})
+	if resp := l.fetch(tasks, fn); len(resp) != 3 || l.Stat.Partial {
+		t.Fatalf("first fetch got %d series, partial=%v", len(resp), l.Stat.Partial)
+	}
+	if resp := l.fetch(tasks, fn); len(resp) != 1 || !l.Stat.Partial {
+		t.Errorf("second fetch got %d series, partial=%v", len(resp), l.Stat.Partial)
+	}
+	if resp := l.fetch(tasks, fn); len(resp) != 0 || l.Stat.Series != 4 {
+		t.Errorf("third fetch got %d series, stat %+v", len(resp), l.Stat)
+	}
+}
@@ -5,139 +5,80 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/didi/nightingale/src/dataobj"
-	"github.com/didi/nightingale/src/modules/transfer/calc"
+	"github.com/didi/nightingale/src/toolkits/calc"
+	"github.com/didi/nightingale/src/toolkits/stats"
 
 	"github.com/toolkits/pkg/logger"
 	"github.com/toolkits/pkg/pool"
 )
 
-func FetchData(inputs []dataobj.QueryData) []*dataobj.TsdbQueryResponse {
-	resp := []*dataobj.TsdbQueryResponse{}
-	workerNum := 100
-	worker := make(chan struct{}, workerNum) //控制goroutine并发数
-	dataChan := make(chan *dataobj.TsdbQueryResponse, 20000)
-
-	for _, input := range inputs {
-		for _, endpoint := range input.Endpoints {
-			for _, counter := range input.Counters {
-				worker <- struct{}{}
-				go fetchDataSync(input.Start, input.End, input.ConsolFunc, endpoint, counter, input.Step, worker, dataChan)
-			}
+// aggrDataForUI 按照GroupKey分组之后，每组计算出一条曲线
+func aggrDataForUI(input dataobj.QueryDataForUI, resp []*dataobj.TsdbQueryResponse) []*dataobj.TsdbQueryResponse {
+	datas := make([]*dataobj.TsdbQueryResponse, 0, len(resp))
+	for _, data := range resp {
+		//查询失败的曲线为nil
+		if data != nil {
+			datas = append(datas, data)
 		}
 	}
-
-	//等待所有goroutine执行完成
-	for i := 0; i < workerNum; i++ {
-		worker <- struct{}{}
+	if len(datas) == 0 {
+		return datas
 	}
 
-	close(dataChan)
-	for {
-		d, ok := <-dataChan
-		if !ok {
-			break
+	aggrDatas := []*dataobj.TsdbQueryResponse{}
+	if len(input.GroupKey) == 0 || getTags(datas[0].Counter) == "" {
+		//没有聚合 tag, 或者曲线没有其他 tags, 直接所有曲线进行计算
+		aggrData := &dataobj.TsdbQueryResponse{
+			Start:  input.Start,
+			End:    input.End,
+			Step:   datas[0].Step,
+			DsType: "GAUGE",
+			Values: calc.Compute(input.AggrFunc, datas),
 		}
-		resp = append(resp, d)
+		return append(aggrDatas, aggrData)
 	}
 
-	return resp
-}
+	aggrCounter := make(map[string][]*dataobj.TsdbQueryResponse)
+	for _, data := range datas {
+		counterMap := make(map[string]string)
 
-func FetchDataForUI(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
-	resp := []*dataobj.TsdbQueryResponse{}
-	workerNum := 100
-	worker := make(chan struct{}, workerNum) //控制goroutine并发数
-	dataChan := make(chan *dataobj.TsdbQueryResponse, 20000)
-
-	for _, endpoint := range input.Endpoints {
-		if len(input.Tags) == 0 {
-			counter, err := getCounter(input.Metric, "", nil)
-			if err != nil {
-				logger.Warning(err)
-				continue
-			}
-			worker <- struct{}{}
-			go fetchDataSync(input.Start, input.End, input.ConsolFunc, endpoint, counter, input.Step, worker, dataChan)
-		} else {
-			for _, tag := range input.Tags {
-				counter, err := getCounter(input.Metric, tag, nil)
-				if err != nil {
-					logger.Warning(err)
-					continue
-				}
-				worker <- struct{}{}
-				go fetchDataSync(input.Start, input.End, input.ConsolFunc, endpoint, counter, input.Step, worker, dataChan)
-			}
+		tagsMap, err := dataobj.SplitTagsString(getTags(data.Counter))
+		if err != nil {
+			logger.Warning(err)
+			continue
 		}
-	}
-
-	//等待所有goroutine执行完成
-	for i := 0; i < workerNum; i++ {
-		worker <- struct{}{}
-	}
+		tagsMap["endpoint"] = data.Endpoint
 
-	close(dataChan)
-	for {
-		d, ok := <-dataChan
-		if !ok {
-			break
+		for _, key := range input.GroupKey {
+			value, exists := tagsMap[key]
+			if exists {
+				counterMap[key] = value
+			}
 		}
-		resp = append(resp, d)
+
+		counter := dataobj.SortedTags(counterMap)
+		aggrCounter[counter] = append(aggrCounter[counter], data)
 	}
 
-	//进行数据计算
-	aggrDatas := []*dataobj.TsdbQueryResponse{}
-	if input.AggrFunc != "" && len(resp) > 1 {
+	//每个分组单独一条曲线，不能共用同一个对象
+	for counter, group := range aggrCounter {
 		aggrData := &dataobj.TsdbQueryResponse{
-			Start: input.Start,
-			End:   input.End,
-		}
-
-		aggrCounter := make(map[string][]*dataobj.TsdbQueryResponse)
-		if len(input.GroupKey) == 0 || getTags(resp[0].Counter) == "" {
-			//没有聚合 tag, 或者曲线没有其他 tags, 直接所有曲线进行计算
-			aggrData.Values = calc.Compute(input.AggrFunc, resp)
-			aggrDatas = append(aggrDatas, aggrData)
-		} else {
-			for _, data := range resp {
-				counterMap := make(map[string]string)
-
-				tagsMap, err := dataobj.SplitTagsString(getTags(data.Counter))
-				if err != nil {
-					logger.Warning(err)
-					continue
-				}
-				tagsMap["endpoint"] = data.Endpoint
-
-				for _, key := range input.GroupKey {
-					value, exists := tagsMap[key]
-					if exists {
-						counterMap[key] = value
-					}
-				}
-
-				counter := dataobj.SortedTags(counterMap)
-				if _, exists := aggrCounter[counter]; exists {
-					aggrCounter[counter] = append(aggrCounter[counter], data)
-				} else {
-					aggrCounter[counter] = []*dataobj.TsdbQueryResponse{data}
-				}
-			}
-
-			for counter, datas := range aggrCounter {
-				aggrData.Counter = counter
-				aggrData.Values = calc.Compute(input.AggrFunc, datas)
-
-				aggrDatas = append(aggrDatas, aggrData)
-			}
+			Start:   input.Start,
+			End:     input.End,
+			Counter: counter,
+			Step:    group[0].Step,
+			DsType:  "GAUGE",
+			Values:  calc.Compute(input.AggrFunc, group),
 		}
-		return aggrDatas
+		aggrDatas = append(aggrDatas, aggrData)
 	}
-	return resp
+	sort.Slice(aggrDatas, func(i, j int) bool { return aggrDatas[i].Counter < aggrDatas[j].Counter })
+	return aggrDatas
 }
 
 func getCounter(metric, tag string, tagMap map[string]string) (counter string, err error) {
@@ -154,24 +95,11 @@ func getCounter(metric, tag string, tagMap map[string]string) (counter string, e
 	return
 }
 
-func fetchDataSync(start, end int64, consolFun, endpoint, counter string, step int, worker chan struct{}, dataChan chan *dataobj.TsdbQueryResponse) {
-	defer func() {
-		<-worker
-	}()
-
-	data, err := fetchData(start, end, consolFun, endpoint, counter, step)
-	if err != nil {
-		logger.Warning(err)
-	}
-	dataChan <- data
-	return
-}
-
 func fetchData(start, end int64, consolFun, endpoint, counter string, step int) (*dataobj.TsdbQueryResponse, error) {
 	var resp *dataobj.TsdbQueryResponse
 
 	qparm := GenQParam(start, end, consolFun, endpoint, counter, step)
-	resp, err := QueryOne(qparm)
+	resp, err := queryCached(qparm)
 	if err != nil {
 		return resp, err
 	}
@@ -215,7 +143,25 @@ func GenQParam(start, end int64, consolFunc, endpoint, counter string, step int)
 	}
 }
 
-func QueryOne(para dataobj.TsdbQueryParam) (resp *dataobj.TsdbQueryResponse, err error) {
+// QueryOne 相同参数的并发查询合并为一次tsdb请求，每个调用方拿到单独的一份结果
+func QueryOne(para dataobj.TsdbQueryParam) (*dataobj.TsdbQueryResponse, error) {
+	resp, err, shared := queryFlight.Do(queryKey(para), func() (*dataobj.TsdbQueryResponse, error) {
+		return queryOne(para)
+	})
+	if shared {
+		stats.Counter.Set("query.coalesced", 1)
+	}
+	if resp == nil {
+		return resp, err
+	}
+
+	r := *resp
+	r.Values = make([]*dataobj.RRDData, len(resp.Values))
+	copy(r.Values, resp.Values)
+	return &r, err
+}
+
+func queryOne(para dataobj.TsdbQueryParam) (resp *dataobj.TsdbQueryResponse, err error) {
 	start, end := para.Start, para.End
 	resp = &dataobj.TsdbQueryResponse{}
 
@@ -0,0 +1,239 @@
+package backend
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+// QueryCacheSection 查询结果缓存，start和end按照bucket对齐之后作为key，不同页面相近时间的查询可以命中同一份结果
+// 查询范围和tsdb内存缓存重叠时数据还在变化，使用较短的recentTTL
+type QueryCacheSection struct {
+	Enabled      bool `yaml:"enabled"`
+	MaxSize      int  `yaml:"maxSize"`      // 占用内存上限，单位MB，按照点数估算
+	Bucket       int  `yaml:"bucket"`       // 时间对齐的粒度，单位秒
+	TTL          int  `yaml:"ttl"`          // 历史数据的缓存时间，单位秒
+	RecentTTL    int  `yaml:"recentTTL"`    // 最近数据的缓存时间，单位秒
+	RecentWindow int  `yaml:"recentWindow"` // tsdb内存缓存保留的时间，对应tsdb的cache.keepMinutes，单位秒
+}
+
+// 估算内存占用：每个点包括指针和RRDData，每条结果还有key和map、list的开销
+const (
+	cachePointSize = 40
+	cacheEntrySize = 256
+)
+
+type cacheEntry struct {
+	key      string
+	resp     *dataobj.TsdbQueryResponse
+	size     int64
+	expireAt int64
+}
+
+// queryCache 按照LRU淘汰，总大小不超过maxSize
+type queryCache struct {
+	sync.Mutex
+	maxSize int64
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+
+	hits   int64
+	misses int64
+}
+
+var resultCache *queryCache
+
+func newQueryCache(maxSize int64) *queryCache {
+	return &queryCache{
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (this *queryCache) Get(key string, now int64) (*dataobj.TsdbQueryResponse, bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	elem, exists := this.items[key]
+	if !exists {
+		this.misses++
+		return nil, false
+	}
+
+	e := elem.Value.(*cacheEntry)
+	if e.expireAt <= now {
+		this.remove(elem)
+		this.misses++
+		return nil, false
+	}
+
+	this.ll.MoveToFront(elem)
+	this.hits++
+	return e.resp, true
+}
+
+func (this *queryCache) Set(key string, resp *dataobj.TsdbQueryResponse, expireAt int64) {
+	size := int64(cacheEntrySize + len(key) + len(resp.Endpoint) + len(resp.Counter) + len(resp.Values)*cachePointSize)
+	if size > this.maxSize {
+		return
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
+	if elem, exists := this.items[key]; exists {
+		this.remove(elem)
+	}
+
+	e := &cacheEntry{key: key, resp: resp, size: size, expireAt: expireAt}
+	this.items[key] = this.ll.PushFront(e)
+	this.size += size
+
+	for this.size > this.maxSize {
+		this.remove(this.ll.Back())
+	}
+}
+
+func (this *queryCache) remove(elem *list.Element) {
+	e := this.ll.Remove(elem).(*cacheEntry)
+	delete(this.items, e.key)
+	this.size -= e.size
+}
+
+// Stat 返回当前占用的内存、条数，以及上次调用之后的命中次数和未命中次数
+func (this *queryCache) Stat() (size int64, entries int, hits, misses int64) {
+	this.Lock()
+	defer this.Unlock()
+
+	size, entries, hits, misses = this.size, this.ll.Len(), this.hits, this.misses
+	this.hits, this.misses = 0, 0
+	return
+}
+
+func initQueryCache() {
+	cfg := Config.QueryCache
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.Bucket <= 0 {
+		Config.QueryCache.Bucket = 60
+	}
+	if cfg.MaxSize <= 0 {
+		Config.QueryCache.MaxSize = 256
+	}
+
+	resultCache = newQueryCache(int64(Config.QueryCache.MaxSize) * 1024 * 1024)
+	go reportQueryCache()
+}
+
+func reportQueryCache() {
+	t := time.NewTicker(time.Duration(10) * time.Second)
+	for {
+		<-t.C
+		size, entries, hits, misses := resultCache.Stat()
+		ratio := 0
+		if hits+misses > 0 {
+			ratio = int(hits * 100 / (hits + misses))
+		}
+
+		stats.Gauge.Set("query.cache.size", int(size))
+		stats.Gauge.Set("query.cache.maxSize", int(resultCache.maxSize))
+		stats.Gauge.Set("query.cache.entries", entries)
+		stats.Gauge.Set("query.cache.hitRatio", ratio)
+		stats.Counter.Set("query.cache.hit", int(hits))
+		stats.Counter.Set("query.cache.miss", int(misses))
+	}
+}
+
+// queryCached 先查缓存，没有命中时按照对齐之后的时间范围查询tsdb，返回的点按照请求的范围截取
+func queryCached(para dataobj.TsdbQueryParam) (*dataobj.TsdbQueryResponse, error) {
+	if resultCache == nil {
+		return QueryOne(para)
+	}
+
+	cfg := Config.QueryCache
+	bucket := int64(cfg.Bucket)
+	aligned := para
+	aligned.Start = para.Start - para.Start%bucket
+	if para.End%bucket != 0 {
+		aligned.End = para.End - para.End%bucket + bucket
+	}
+
+	now := time.Now().Unix()
+	key := queryKey(aligned)
+	if resp, exists := resultCache.Get(key, now); exists {
+		return sliceResp(resp, para.Start, para.End), nil
+	}
+
+	resp, err := QueryOne(aligned)
+	if err != nil {
+		return resp, err
+	}
+
+	ttl := cfg.TTL
+	if aligned.End > now-int64(cfg.RecentWindow) {
+		ttl = cfg.RecentTTL
+	}
+	if ttl > 0 {
+		resultCache.Set(key, resp, now+int64(ttl))
+	}
+	return sliceResp(resp, para.Start, para.End), nil
+}
+
+func queryKey(para dataobj.TsdbQueryParam) string {
+	return fmt.Sprintf("%s/%s/%s/%d/%d/%d", para.Endpoint, para.Counter, para.ConsolFunc, para.Step, para.Start, para.End)
+}
+
+// sliceResp 缓存中的结果会被多个请求使用，返回一份新的Values
+func sliceResp(resp *dataobj.TsdbQueryResponse, start, end int64) *dataobj.TsdbQueryResponse {
+	r := *resp
+	r.Values = make([]*dataobj.RRDData, 0, len(resp.Values))
+	for _, v := range resp.Values {
+		if v.Timestamp >= start && v.Timestamp <= end {
+			r.Values = append(r.Values, v)
+		}
+	}
+	return &r
+}
+
+type flightCall struct {
+	wg   sync.WaitGroup
+	resp *dataobj.TsdbQueryResponse
+	err  error
+}
+
+// flightGroup 相同key的并发调用只执行一次，其他调用等待并共享结果
+type flightGroup struct {
+	sync.Mutex
+	calls map[string]*flightCall
+}
+
+var queryFlight = &flightGroup{calls: make(map[string]*flightCall)}
+
+func (this *flightGroup) Do(key string, fn func() (*dataobj.TsdbQueryResponse, error)) (*dataobj.TsdbQueryResponse, error, bool) {
+	this.Lock()
+	if c, exists := this.calls[key]; exists {
+		this.Unlock()
+		c.wg.Wait()
+		return c.resp, c.err, true
+	}
+
+	c := &flightCall{}
+	c.wg.Add(1)
+	this.calls[key] = c
+	this.Unlock()
+
+	c.resp, c.err = fn()
+	c.wg.Done()
+
+	this.Lock()
+	delete(this.calls, key)
+	this.Unlock()
+	return c.resp, c.err, false
+}
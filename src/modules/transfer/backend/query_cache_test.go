@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+func TestQueryCache(t *testing.T) {
+	resp := &dataobj.TsdbQueryResponse{Values: []*dataobj.RRDData{dataobj.NewRRDData(100, 1)}}
+	entrySize := int64(cacheEntrySize + 1 + cachePointSize)
+
+	// 只能放下两条
+	c := newQueryCache(entrySize * 2)
+	c.Set("a", resp, 200)
+	c.Set("b", resp, 200)
+	if _, ok := c.Get("a", 100); !ok {
+		t.Fatal("a should be cached")
+	}
+
+	// a刚被访问过，淘汰b
+	c.Set("c", resp, 200)
+	if _, ok := c.Get("b", 100); ok {
+		t.Error("b should be evicted")
+	}
+	if _, ok := c.Get("c", 100); !ok {
+		t.Error("c should be cached")
+	}
+
+	// 过期
+	if _, ok := c.Get("a", 200); ok {
+		t.Error("a should be expired")
+	}
+
+	size, entries, hits, misses := c.Stat()
+	if size != entrySize || entries != 1 || hits != 2 || misses != 2 {
+		t.Errorf("got size=%d entries=%d hits=%d misses=%d", size, entries, hits, misses)
+	}
+	if _, _, hits, misses = c.Stat(); hits != 0 || misses != 0 {
+		t.Error("Stat should reset hits and misses")
+	}
+}
+
+func TestFlightGroup(t *testing.T) {
+	g := &flightGroup{calls: make(map[string]*flightCall)}
+	var calls int32
+	release := make(chan struct{})
+
+	fn := func() (*dataobj.TsdbQueryResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &dataobj.TsdbQueryResponse{Counter: "cpu.idle"}, nil
+	}
+
+	var wg sync.WaitGroup
+	var shared int32
+	started := make(chan struct{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started <- struct{}{}
+			resp, err, s := g.Do("key", fn)
+			if err != nil || resp.Counter != "cpu.idle" {
+				t.Errorf("got %v %v", resp, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+
+	// 等待所有调用都进入Do
+	for i := 0; i < 10; i++ {
+		<-started
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 || shared != 9 {
+		t.Errorf("got calls=%d shared=%d, want 1 and 9", calls, shared)
+	}
+}
@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+func newResp(endpoint, counter string, vals ...float64) *dataobj.TsdbQueryResponse {
+	d := &dataobj.TsdbQueryResponse{Endpoint: endpoint, Counter: counter, Step: 10}
+	for i, v := range vals {
+		d.Values = append(d.Values, dataobj.NewRRDData(int64(100+i*10), v))
+	}
+	return d
+}
+
+func TestAggrDataForUIGroup(t *testing.T) {
+	resp := []*dataobj.TsdbQueryResponse{
+		newResp("h1", "disk.used/mount=/", 1, 2),
+		newResp("h2", "disk.used/mount=/", 3, 4),
+		newResp("h1", "disk.used/mount=/home", 10, 20),
+		nil,
+	}
+
+	input := dataobj.QueryDataForUI{Start: 100, End: 110, GroupKey: []string{"mount"}, AggrFunc: "count"}
+	got := aggrDataForUI(input, resp)
+	if len(got) != 2 {
+		t.Fatalf("got %d series, want 2", len(got))
+	}
+
+	// 每个分组的结果是独立的对象
+	want := map[string]float64{"mount=/": 2, "mount=/home": 1}
+	for _, d := range got {
+		if len(d.Values) != 2 || float64(d.Values[0].Value) != want[d.Counter] {
+			t.Errorf("%s: got %v, want count %v", d.Counter, d.Values, want[d.Counter])
+		}
+	}
+	if got[0].Counter == got[1].Counter {
+		t.Errorf("groups share the same counter %s", got[0].Counter)
+	}
+}
+
+// 只查到一条曲线时也要进行聚合计算
+func TestFetchDataForUISingleSeries(t *testing.T) {
+	defer func(fn fetchFunc) { queryTask = fn }(queryTask)
+	queryTask = func(task fetchTask) (*dataobj.TsdbQueryResponse, error) {
+		return newResp(task.endpoint, task.counter, 5, 7), nil
+	}
+
+	cases := []struct {
+		aggrFunc string
+		groupKey []string
+		counter  string
+		value    float64
+	}{
+		{"count", nil, "", 1},
+		{"stddev", nil, "", 0},
+		{"spread", nil, "", 0},
+		{"sum", []string{"mount"}, "mount=/", 5},
+	}
+
+	for _, c := range cases {
+		input := dataobj.QueryDataForUI{
+			Start:     100,
+			End:       110,
+			Metric:    "disk.used",
+			Endpoints: []string{"h1"},
+			Tags:      []string{"mount=/"},
+			AggrFunc:  c.aggrFunc,
+			GroupKey:  c.groupKey,
+		}
+		got := newQueryLimiter(QueryLimitSection{}).FetchDataForUI(input)
+		if len(got) != 1 || got[0].Counter != c.counter || len(got[0].Values) != 2 {
+			t.Fatalf("%s: unexpected result %+v", c.aggrFunc, got)
+		}
+		if v := float64(got[0].Values[0].Value); v != c.value {
+			t.Errorf("%s: got %v, want %v", c.aggrFunc, v, c.value)
+		}
+	}
+}
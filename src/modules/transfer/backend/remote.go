@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/prompb"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/toolkits/pkg/container/list"
+	"github.com/toolkits/pkg/logger"
+)
+
+// RemoteWriteSection 把数据同时转发给支持prometheus remote_write协议的存储
+// metric作为__name__，endpoint作为endpointLabel，tags作为其他label
+type RemoteWriteSection struct {
+	Name          string            `yaml:"name"`
+	Url           string            `yaml:"url"`
+	Timeout       int               `yaml:"timeout"` // 单位毫秒
+	Batch         int               `yaml:"batch"`
+	Headers       map[string]string `yaml:"headers"`
+	EndpointLabel string            `yaml:"endpointLabel"`
+	Retry         int               `yaml:"retry"`      // 失败之后的重试次数
+	MinBackoff    int               `yaml:"minBackoff"` // 重试间隔从minBackoff开始翻倍，最大maxBackoff，单位毫秒
+	MaxBackoff    int               `yaml:"maxBackoff"`
+}
+
+type remoteWriter struct {
+	cfg    RemoteWriteSection
+	queue  *list.SafeListLimited
+	client *http.Client
+}
+
+var remoteWriters []*remoteWriter
+
+// 4xx的错误重试也不会成功，直接丢弃
+type unrecoverableError struct {
+	error
+}
+
+func initRemoteWriters() {
+	for i, cfg := range Config.RemoteWrite {
+		if cfg.Url == "" {
+			continue
+		}
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("remote%d", i)
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = 5000
+		}
+		if cfg.Batch <= 0 {
+			cfg.Batch = 500
+		}
+		if cfg.EndpointLabel == "" {
+			cfg.EndpointLabel = "instance"
+		}
+		if cfg.MinBackoff <= 0 {
+			cfg.MinBackoff = 100
+		}
+		if cfg.MaxBackoff < cfg.MinBackoff {
+			cfg.MaxBackoff = cfg.MinBackoff
+		}
+
+		w := &remoteWriter{
+			cfg:    cfg,
+			queue:  list.NewSafeListLimited(DefaultSendQueueMaxSize),
+			client: &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Millisecond},
+		}
+		remoteWriters = append(remoteWriters, w)
+		go w.loop()
+	}
+}
+
+// Push2RemoteWriteQueue 已经通过CheckValidity的数据放入每个remote_write地址的发送队列
+func Push2RemoteWriteQueue(items []*dataobj.MetricValue) {
+	for _, w := range remoteWriters {
+		for _, item := range items {
+			if !w.queue.PushFront(item) {
+				stats.Counter.Set("remote."+w.cfg.Name+".drop", 1)
+			}
+		}
+	}
+}
+
+func (w *remoteWriter) loop() {
+	for {
+		items := w.queue.PopBackBy(w.cfg.Batch)
+		if len(items) == 0 {
+			time.Sleep(DefaultSendTaskSleepInterval)
+			continue
+		}
+
+		values := make([]*dataobj.MetricValue, len(items))
+		for i := range items {
+			values[i] = items[i].(*dataobj.MetricValue)
+		}
+
+		if err := w.send(ToWriteRequest(values, w.cfg.EndpointLabel)); err != nil {
+			stats.Counter.Set("remote."+w.cfg.Name+".fail", len(values))
+			logger.Errorf("remote write %d items to %s fail: %v", len(values), w.cfg.Url, err)
+			continue
+		}
+		stats.Counter.Set("remote."+w.cfg.Name+".succ", len(values))
+	}
+}
+
+// send 失败之后按照指数退避重试
+func (w *remoteWriter) send(req *prompb.WriteRequest) error {
+	bs, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, bs)
+
+	backoff := time.Duration(w.cfg.MinBackoff) * time.Millisecond
+	maxBackoff := time.Duration(w.cfg.MaxBackoff) * time.Millisecond
+	for i := 0; ; i++ {
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(unrecoverableError); ok || i >= w.cfg.Retry {
+			return err
+		}
+
+		logger.Warningf("remote write to %s fail: %v, retry after %v", w.cfg.Url, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (w *remoteWriter) post(body []byte) error {
+	req, err := http.NewRequest("POST", w.cfg.Url, bytes.NewReader(body))
+	if err != nil {
+		return unrecoverableError{err}
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 {
+		return unrecoverableError{err}
+	}
+	return err
+}
+
+// ToWriteRequest 相同series的点合并到一个TimeSeries中，label按照名字排序
+func ToWriteRequest(items []*dataobj.MetricValue, endpointLabel string) *prompb.WriteRequest {
+	req := &prompb.WriteRequest{}
+	series := make(map[string]*prompb.TimeSeries)
+	for _, item := range items {
+		if math.IsNaN(item.Value) || math.IsInf(item.Value, 0) {
+			continue
+		}
+
+		pk := item.PK()
+		ts, exists := series[pk]
+		if !exists {
+			ts = &prompb.TimeSeries{Labels: PromLabels(item, endpointLabel)}
+			series[pk] = ts
+			req.Timeseries = append(req.Timeseries, ts)
+		}
+		ts.Samples = append(ts.Samples, &prompb.Sample{Value: item.Value, Timestamp: item.Timestamp * 1000})
+	}
+	return req
+}
+
+// PromLabels metric和tag名转换成prometheus合法的名字
+func PromLabels(item *dataobj.MetricValue, endpointLabel string) []*prompb.Label {
+	labels := make([]*prompb.Label, 0, len(item.TagsMap)+2)
+	labels = append(labels,
+		&prompb.Label{Name: "__name__", Value: prompb.MetricName(item.Metric)},
+		&prompb.Label{Name: endpointLabel, Value: item.Endpoint},
+	)
+	for k, v := range item.TagsMap {
+		name := prompb.LabelName(k)
+		if name == endpointLabel || name == "__name__" {
+			continue
+		}
+		labels = append(labels, &prompb.Label{Name: name, Value: v})
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
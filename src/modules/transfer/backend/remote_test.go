@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/prompb"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+func TestRemoteWriteRetry(t *testing.T) {
+	var calls int
+	var got prompb.WriteRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		compressed, _ := ioutil.ReadAll(r.Body)
+		bs, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := proto.Unmarshal(bs, &got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := &remoteWriter{
+		cfg:    RemoteWriteSection{Url: srv.URL, Retry: 2, MinBackoff: 1, MaxBackoff: 1},
+		client: http.DefaultClient,
+	}
+
+	items := []*dataobj.MetricValue{
+		{Metric: "disk.bytes.used", Endpoint: "host01", Timestamp: 1600000000, Value: 1, TagsMap: map[string]string{"mount": "/"}},
+		{Metric: "disk.bytes.used", Endpoint: "host01", Timestamp: 1600000010, Value: 2, TagsMap: map[string]string{"mount": "/"}},
+		{Metric: "cpu.idle", Endpoint: "host01", Timestamp: 1600000000, Value: 98},
+	}
+
+	if err := w.send(ToWriteRequest(items, "instance")); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expect 2 calls, got %d", calls)
+	}
+
+	if len(got.Timeseries) != 2 {
+		t.Fatalf("expect 2 series, got %d", len(got.Timeseries))
+	}
+	ts := got.Timeseries[0]
+	labels := []string{}
+	for _, l := range ts.Labels {
+		labels = append(labels, l.Name+"="+l.Value)
+	}
+	if len(labels) != 3 || labels[0] != "__name__=disk_bytes_used" || labels[1] != "instance=host01" || labels[2] != "mount=/" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	if len(ts.Samples) != 2 || ts.Samples[1].Timestamp != 1600000010000 || ts.Samples[1].Value != 2 {
+		t.Fatalf("unexpected samples %v", ts.Samples)
+	}
+
+	// 4xx不重试
+	calls = 0
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	if err := w.send(ToWriteRequest(items, "instance")); err == nil || calls != 1 {
+		t.Fatalf("expect error without retry, calls %d err %v", calls, err)
+	}
+}
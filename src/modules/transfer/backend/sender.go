@@ -1,16 +1,17 @@
 package backend
 
 import (
+	"sync"
 	"time"
 
 	"github.com/didi/nightingale/src/dataobj"
 	"github.com/didi/nightingale/src/model"
 	"github.com/didi/nightingale/src/modules/transfer/cache"
+	"github.com/didi/nightingale/src/toolkits/spool"
 	"github.com/didi/nightingale/src/toolkits/stats"
 	"github.com/didi/nightingale/src/toolkits/str"
 
 	"github.com/toolkits/pkg/concurrent/semaphore"
-	"github.com/toolkits/pkg/container/list"
 	"github.com/toolkits/pkg/logger"
 )
 
@@ -24,6 +25,47 @@ var (
 	MinStep int //最小上报周期,单位sec
 )
 
+// 进程退出时先停止所有发送任务，再把内存队列写入spool
+var sendTasks = struct {
+	sync.Mutex
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	stopped bool
+}{stop: make(chan struct{})}
+
+// startSendTask 登记一个发送任务，已经停止时返回false
+func startSendTask() bool {
+	sendTasks.Lock()
+	defer sendTasks.Unlock()
+
+	if sendTasks.stopped {
+		return false
+	}
+	sendTasks.wg.Add(1)
+	return true
+}
+
+func sendTaskStopped() bool {
+	select {
+	case <-sendTasks.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopSendTasks 通知所有发送任务退出，等待已经发出的请求结束
+func StopSendTasks() {
+	sendTasks.Lock()
+	if !sendTasks.stopped {
+		sendTasks.stopped = true
+		close(sendTasks.stop)
+	}
+	sendTasks.Unlock()
+
+	sendTasks.wg.Wait()
+}
+
 func startSendTasks() {
 
 	tsdbConcurrent := Config.WorkerNum
@@ -53,49 +95,53 @@ func startSendTasks() {
 	}
 }
 
-func Send2TsdbTask(Q *list.SafeListLimited, node string, addr string, concurrent int) {
+func Send2TsdbTask(Q *spool.Queue, node string, addr string, concurrent int) {
 	batch := Config.Batch // 一次发送,最多batch条数据
 	Q = TsdbQueues[node+addr]
 
+	if !startSendTask() {
+		return
+	}
+	defer sendTasks.wg.Done()
+
 	sema := semaphore.NewSemaphore(concurrent)
+	var sending sync.WaitGroup
+	defer sending.Wait()
 
-	for {
+	for !sendTaskStopped() {
 		items := Q.PopBackBy(batch)
 		count := len(items)
 
 		if count == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
+			// 内存队列为空时回放spool中的数据
+			if !replaySpool(Q, batch, "tsdb", func(items []interface{}) error {
+				return sendTsdb(addr, toTsdbItems(items))
+			}) {
+				time.Sleep(DefaultSendTaskSleepInterval)
+			}
 			continue
 		}
 
-		tsdbItems := make([]*dataobj.TsdbItem, count)
+		tsdbItems := toTsdbItems(items)
 		for i := 0; i < count; i++ {
-			tsdbItems[i] = items[i].(*dataobj.TsdbItem)
 			stats.Counter.Set("push.tsdb", 1)
 			logger.Debug("send to tsdb->: ", tsdbItems[i])
 		}
 
 		//控制并发
 		sema.Acquire()
+		sending.Add(1)
 		go func(addr string, tsdbItems []*dataobj.TsdbItem, count int) {
+			defer sending.Done()
 			defer sema.Release()
 
-			resp := &dataobj.SimpleRpcResponse{}
-			var err error
-			sendOk := false
-			for i := 0; i < 3; i++ { //最多重试3次
-				err = TsdbConnPools.Call(addr, "Tsdb.Send", tsdbItems, resp)
-				if err == nil {
-					sendOk = true
-					break
-				}
-				time.Sleep(time.Millisecond * 10)
-			}
+			err := sendTsdb(addr, tsdbItems)
 
 			// statistics
 			//atomic.AddInt64(&PointOut2Tsdb, int64(count))
-			if !sendOk {
-				logger.Errorf("send %v to tsdb %s:%s fail: %v", tsdbItems, node, addr, err)
+			if err != nil {
+				logger.Errorf("send %d items to tsdb %s:%s fail: %v", count, node, addr, err)
+				spill(Q, items, "tsdb")
 			} else {
 				logger.Debugf("send to tsdb %s:%s ok", node, addr)
 			}
@@ -103,6 +149,68 @@ func Send2TsdbTask(Q *list.SafeListLimited, node string, addr string, concurrent
 	}
 }
 
+func sendTsdb(addr string, tsdbItems []*dataobj.TsdbItem) error {
+	resp := &dataobj.SimpleRpcResponse{}
+	var err error
+	for i := 0; i < 3; i++ { //最多重试3次
+		err = TsdbConnPools.Call(addr, "Tsdb.Send", tsdbItems, resp)
+		if err == nil {
+			return nil
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return err
+}
+
+func toTsdbItems(items []interface{}) []*dataobj.TsdbItem {
+	tsdbItems := make([]*dataobj.TsdbItem, len(items))
+	for i := range items {
+		tsdbItems[i] = items[i].(*dataobj.TsdbItem)
+	}
+	return tsdbItems
+}
+
+// spill 发送失败的数据写入spool，没有开启spool时直接丢弃
+func spill(Q *spool.Queue, items []interface{}, kind string) {
+	if !Config.Spool.Enabled {
+		return
+	}
+
+	dropped := Q.Spill(items)
+	stats.Counter.Set("spool."+kind+".spill", len(items)-dropped)
+	if dropped > 0 {
+		stats.Counter.Set("spool."+kind+".drop", dropped)
+		logger.Errorf("spool %s full, drop %d items", kind, dropped)
+	}
+}
+
+// replaySpool 按顺序发送spool中的一批数据，发送失败时等待之后重试同一批数据
+// 返回false表示spool中没有数据
+func replaySpool(Q *spool.Queue, batch int, kind string, send func([]interface{}) error) bool {
+	if Q.SpoolLen() == 0 {
+		return false
+	}
+
+	items, err := Q.Peek(batch)
+	if err != nil {
+		logger.Errorf("read spool %s err:%v", kind, err)
+	}
+
+	if len(items) > 0 {
+		if err := send(items); err != nil {
+			logger.Warningf("replay spool %s fail: %v", kind, err)
+			time.Sleep(spoolRetryInterval)
+			return true
+		}
+		stats.Counter.Set("spool."+kind+".replay", len(items))
+	}
+
+	if err := Q.Ack(); err != nil {
+		logger.Errorf("ack spool %s err:%v", kind, err)
+	}
+	return true
+}
+
 // 将数据 打入 某个Tsdb的发送缓存队列, 具体是哪一个Tsdb 由一致性哈希 决定
 func Push2TsdbSendQueue(items []*dataobj.MetricValue) {
 	for _, item := range items {
@@ -134,50 +242,73 @@ func Push2TsdbSendQueue(items []*dataobj.MetricValue) {
 	}
 }
 
-func Send2JudgeTask(Q *list.SafeListLimited, addr string, concurrent int) {
+func Send2JudgeTask(Q *spool.Queue, addr string, concurrent int) {
 	batch := Config.Batch
+	if !startSendTask() {
+		return
+	}
+	defer sendTasks.wg.Done()
+
 	sema := semaphore.NewSemaphore(concurrent)
+	var sending sync.WaitGroup
+	defer sending.Wait()
 
-	for {
+	for !sendTaskStopped() {
 		items := Q.PopBackBy(batch)
 		count := len(items)
 		if count == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
+			if !replaySpool(Q, batch, "judge", func(items []interface{}) error {
+				return sendJudge(addr, toJudgeItems(items))
+			}) {
+				time.Sleep(DefaultSendTaskSleepInterval)
+			}
 			continue
 		}
 
-		judgeItems := make([]*dataobj.JudgeItem, count)
+		judgeItems := toJudgeItems(items)
 		for i := 0; i < count; i++ {
-			judgeItems[i] = items[i].(*dataobj.JudgeItem)
 			stats.Counter.Set("push.judge", 1)
 			logger.Debug("send to judge: ", judgeItems[i])
 		}
 
 		sema.Acquire()
+		sending.Add(1)
 		go func(addr string, judgeItems []*dataobj.JudgeItem, count int) {
+			defer sending.Done()
 			defer sema.Release()
 
-			resp := &dataobj.SimpleRpcResponse{}
-			var err error
-			sendOk := false
-			for i := 0; i < MAX_SEND_RETRY; i++ {
-				err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
-				if err == nil {
-					sendOk = true
-					break
-				}
-				logger.Warningf("send judge %s fail: %v", addr, err)
-				time.Sleep(time.Millisecond * 10)
-			}
-
-			if !sendOk {
+			err := sendJudge(addr, judgeItems)
+			if err != nil {
 				logger.Errorf("send judge %s fail: %v", addr, err)
+				spill(Q, items, "judge")
 			}
 
 		}(addr, judgeItems, count)
 	}
 }
 
+func sendJudge(addr string, judgeItems []*dataobj.JudgeItem) error {
+	resp := &dataobj.SimpleRpcResponse{}
+	var err error
+	for i := 0; i < MAX_SEND_RETRY; i++ {
+		err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
+		if err == nil {
+			return nil
+		}
+		logger.Warningf("send judge %s fail: %v", addr, err)
+		time.Sleep(time.Millisecond * 10)
+	}
+	return err
+}
+
+func toJudgeItems(items []interface{}) []*dataobj.JudgeItem {
+	judgeItems := make([]*dataobj.JudgeItem, len(items))
+	for i := range items {
+		judgeItems[i] = items[i].(*dataobj.JudgeItem)
+	}
+	return judgeItems
+}
+
 func Push2JudgeSendQueue(items []*dataobj.MetricValue) {
 	for _, item := range items {
 		key := str.PK(item.Metric, item.Endpoint)
@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/spool"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// SpoolSection 内存队列满了或者发送失败时，数据写入磁盘，后端恢复之后按顺序重新发送
+// 每个tsdb实例和judge实例使用单独的目录
+type SpoolSection struct {
+	Enabled     bool   `yaml:"enabled"`
+	Dir         string `yaml:"dir"`
+	SegmentSize int    `yaml:"segmentSize"` // 单个segment文件的大小，单位MB
+	MaxSize     int    `yaml:"maxSize"`     // 每个队列占用磁盘的上限，单位MB，超过之后丢弃
+}
+
+// spool回放失败之后的等待时间
+const spoolRetryInterval = time.Second
+
+type SpoolStat struct {
+	Name   string `json:"name"`
+	Memory int    `json:"memory"`
+	Depth  int64  `json:"depth"`
+	Size   int64  `json:"size"`
+	Age    int64  `json:"age"`
+}
+
+// 同一个目录只能打开一次，judge实例下线之后再上线继续使用原来的队列
+var spoolQueues = struct {
+	sync.RWMutex
+	tsdb  map[string]*spool.Queue
+	judge map[string]*spool.Queue
+}{
+	tsdb:  make(map[string]*spool.Queue),
+	judge: make(map[string]*spool.Queue),
+}
+
+var unsafePathChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+func newSendQueue(kind, name string, decode func([]byte) (interface{}, error)) *spool.Queue {
+	if !Config.Spool.Enabled {
+		return spool.NewQueue(DefaultSendQueueMaxSize, nil, decode)
+	}
+
+	dir := filepath.Join(Config.Spool.Dir, kind, unsafePathChars.ReplaceAllString(name, "_"))
+	sp, err := spool.Open(dir, spool.Options{
+		SegmentSize: int64(Config.Spool.SegmentSize) * 1024 * 1024,
+		MaxSize:     int64(Config.Spool.MaxSize) * 1024 * 1024,
+	})
+	if err != nil {
+		// 打不开spool时退化为只使用内存队列
+		logger.Errorf("open spool %s err:%v", dir, err)
+		return spool.NewQueue(DefaultSendQueueMaxSize, nil, decode)
+	}
+
+	if n := sp.Len(); n > 0 {
+		logger.Infof("spool %s has %d items to replay", dir, n)
+	}
+	return spool.NewQueue(DefaultSendQueueMaxSize, sp, decode)
+}
+
+func newTsdbQueue(name string) *spool.Queue {
+	spoolQueues.Lock()
+	defer spoolQueues.Unlock()
+
+	q := newSendQueue("tsdb", name, decodeTsdbItem)
+	spoolQueues.tsdb[name] = q
+	return q
+}
+
+// NewJudgeQueue 返回judge实例的发送队列，created为false时队列已经存在，发送任务也已经启动
+func NewJudgeQueue(instance string) (q *spool.Queue, created bool) {
+	spoolQueues.Lock()
+	defer spoolQueues.Unlock()
+
+	if q, exists := spoolQueues.judge[instance]; exists {
+		return q, false
+	}
+
+	q = newSendQueue("judge", instance, decodeJudgeItem)
+	spoolQueues.judge[instance] = q
+	return q, true
+}
+
+func decodeTsdbItem(bs []byte) (interface{}, error) {
+	item := &dataobj.TsdbItem{}
+	err := json.Unmarshal(bs, item)
+	return item, err
+}
+
+func decodeJudgeItem(bs []byte) (interface{}, error) {
+	item := &dataobj.JudgeItem{}
+	err := json.Unmarshal(bs, item)
+	return item, err
+}
+
+// SpoolStats 每个发送队列的内存队列长度，spool中的数据个数、大小和最早数据的等待时间
+func SpoolStats() map[string][]SpoolStat {
+	spoolQueues.RLock()
+	defer spoolQueues.RUnlock()
+
+	now := time.Now().Unix()
+	ret := map[string][]SpoolStat{
+		"tsdb":  spoolStats(spoolQueues.tsdb, now),
+		"judge": spoolStats(spoolQueues.judge, now),
+	}
+	return ret
+}
+
+func spoolStats(queues map[string]*spool.Queue, now int64) []SpoolStat {
+	list := make([]SpoolStat, 0, len(queues))
+	for name, q := range queues {
+		list = append(list, SpoolStat{
+			Name:   name,
+			Memory: q.Len(),
+			Depth:  q.SpoolLen(),
+			Size:   q.SpoolSize(),
+			Age:    q.SpoolAge(now),
+		})
+	}
+	return list
+}
+
+// reportSpool 定期把spool中的数据刷到磁盘，并上报积压的个数和最大等待时间
+func reportSpool() {
+	t := time.NewTicker(time.Duration(10) * time.Second)
+	for {
+		<-t.C
+		for kind, list := range SpoolStats() {
+			var depth, age int64
+			for _, s := range list {
+				depth += s.Depth
+				if s.Age > age {
+					age = s.Age
+				}
+			}
+			stats.Gauge.Set("spool."+kind+".depth", int(depth))
+			stats.Gauge.Set("spool."+kind+".age", int(age))
+		}
+
+		spoolQueues.RLock()
+		for _, q := range spoolQueues.tsdb {
+			q.Sync()
+		}
+		for _, q := range spoolQueues.judge {
+			q.Sync()
+		}
+		spoolQueues.RUnlock()
+	}
+}
+
+// CloseSpool 进程退出之前关闭所有spool，需要先调用StopSendTasks
+// 内存队列中还没有发送的数据写入spool，下次启动之后重新发送
+func CloseSpool() {
+	spoolQueues.Lock()
+	defer spoolQueues.Unlock()
+
+	for name, q := range spoolQueues.tsdb {
+		closeQueue("tsdb", name, q)
+	}
+	for name, q := range spoolQueues.judge {
+		closeQueue("judge", name, q)
+	}
+}
+
+func closeQueue(kind, name string, q *spool.Queue) {
+	if dropped := q.Spill(nil); dropped > 0 {
+		logger.Errorf("spool %s %s full, drop %d items", kind, name, dropped)
+	}
+	if err := q.Close(); err != nil {
+		logger.Errorf("close spool %s %s err:%v", kind, name, err)
+	}
+}
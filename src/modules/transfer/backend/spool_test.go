@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+// 退出时内存队列中的数据写入spool，重新打开之后按顺序回放
+func TestCloseSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Config.Spool = SpoolSection{Enabled: true, Dir: dir, SegmentSize: 1, MaxSize: 10}
+	defer func() { Config.Spool = SpoolSection{} }()
+
+	name := "n1127.0.0.1:8047"
+	q := newTsdbQueue(name)
+	for i := int64(0); i < 3; i++ {
+		q.PushFront(&dataobj.TsdbItem{Endpoint: "h", Metric: "cpu.idle", Timestamp: i})
+	}
+	if q.Len() != 3 || q.SpoolLen() != 0 {
+		t.Fatalf("expect 3 items in memory, got memory %d spool %d", q.Len(), q.SpoolLen())
+	}
+
+	CloseSpool()
+
+	q = newTsdbQueue(name)
+	defer func() {
+		q.Close()
+		delete(spoolQueues.tsdb, name)
+	}()
+
+	if q.Len() != 0 || q.SpoolLen() != 3 {
+		t.Fatalf("expect 3 items in spool, got memory %d spool %d", q.Len(), q.SpoolLen())
+	}
+	items, err := q.Peek(10)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("peek %d items, err: %v", len(items), err)
+	}
+	for i, item := range toTsdbItems(items) {
+		if item.Timestamp != int64(i) {
+			t.Fatalf("item %d: expect timestamp %d, got %d", i, i, item.Timestamp)
+		}
+	}
+}
@@ -4,18 +4,18 @@ import (
 	"sync"
 	"time"
 
-	"github.com/toolkits/pkg/container/list"
+	"github.com/didi/nightingale/src/toolkits/spool"
 )
 
 type SafeJudgeQueue struct {
 	sync.RWMutex
-	Data map[string]*list.SafeListLimited
+	Data map[string]*spool.Queue
 	Ts   map[string]int64
 }
 
 func NewJudgeQueue() SafeJudgeQueue {
 	return SafeJudgeQueue{
-		Data: make(map[string]*list.SafeListLimited),
+		Data: make(map[string]*spool.Queue),
 		Ts:   make(map[string]int64),
 	}
 }
@@ -26,14 +26,14 @@ func (s *SafeJudgeQueue) Del(instance string) {
 	delete(s.Data, instance)
 }
 
-func (s *SafeJudgeQueue) Set(instance string, q *list.SafeListLimited) {
+func (s *SafeJudgeQueue) Set(instance string, q *spool.Queue) {
 	s.Lock()
 	defer s.Unlock()
 	s.Data[instance] = q
 	s.Ts[instance] = time.Now().Unix()
 }
 
-func (s *SafeJudgeQueue) Get(instance string) (*list.SafeListLimited, bool) {
+func (s *SafeJudgeQueue) Get(instance string) (*spool.Queue, bool) {
 	s.RLock()
 	defer s.RUnlock()
 	q, exists := s.Data[instance]
@@ -47,7 +47,7 @@ func (s *SafeJudgeQueue) Exists(instance string) bool {
 	return exists
 }
 
-func (s *SafeJudgeQueue) GetAll() map[string]*list.SafeListLimited {
+func (s *SafeJudgeQueue) GetAll() map[string]*spool.Queue {
 	s.RLock()
 	defer s.RUnlock()
 	return s.Data
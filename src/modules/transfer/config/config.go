@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/didi/nightingale/src/modules/transfer/backend"
+	"github.com/didi/nightingale/src/modules/transfer/receiver"
+	"github.com/didi/nightingale/src/modules/transfer/relabel"
 	"github.com/didi/nightingale/src/toolkits/logger"
 
 	"github.com/spf13/viper"
@@ -13,13 +15,19 @@ import (
 )
 
 type ConfYaml struct {
-	Debug   bool                   `yaml:"debug"`
-	MinStep int                    `yaml:"minStep"`
-	Logger  logger.LoggerSection   `yaml:"logger"`
-	Backend backend.BackendSection `yaml:"backend"`
-	HTTP    HTTPSection            `yaml:"http"`
-	RPC     RPCSection             `yaml:"rpc"`
-	Index   IndexSection           `yaml:"index"`
+	Debug    bool                     `yaml:"debug"`
+	MinStep  int                      `yaml:"minStep"`
+	Logger   logger.LoggerSection     `yaml:"logger"`
+	Backend  backend.BackendSection   `yaml:"backend"`
+	HTTP     HTTPSection              `yaml:"http"`
+	RPC      RPCSection               `yaml:"rpc"`
+	Index    IndexSection             `yaml:"index"`
+	Prom     receiver.PromSection     `yaml:"prom"`
+	Opentsdb receiver.OpentsdbSection `yaml:"opentsdb"`
+	Influx   receiver.InfluxSection   `yaml:"influx"`
+	Graphite receiver.GraphiteSection `yaml:"graphite"`
+	Statsd   receiver.StatsdSection   `yaml:"statsd"`
+	Relabel  []relabel.Rule           `yaml:"relabel"`
 }
 
 type IndexSection struct {
@@ -82,6 +90,33 @@ func Parse(conf string) error {
 	viper.SetDefault("index.timeout", 3000)
 	viper.SetDefault("minStep", 1)
 
+	viper.SetDefault("prom", map[string]interface{}{
+		"endpointLabel": "instance",
+		"stripPort":     true,
+		"step":          15,
+	})
+
+	viper.SetDefault("opentsdb", map[string]interface{}{
+		"endpointTag": "host",
+		"step":        10,
+	})
+
+	viper.SetDefault("influx", map[string]interface{}{
+		"endpointTag": "host",
+		"step":        10,
+	})
+
+	viper.SetDefault("graphite", map[string]interface{}{
+		"step": 10,
+	})
+
+	viper.SetDefault("statsd", map[string]interface{}{
+		"endpointTag": "host",
+		"step":        10,
+		"percentiles": []float64{50, 90, 99},
+		"gaugeExpire": 60,
+	})
+
 	viper.SetDefault("backend", map[string]interface{}{
 		"enabled":     true,
 		"batch":       200, //每次拉取文件的个数
@@ -91,6 +126,25 @@ func Parse(conf string) error {
 		"maxIdle":     32,   //建立的连接池的最大空闲数
 		"connTimeout": 1000, //链接超时时间，单位毫秒
 		"callTimeout": 3000, //访问超时时间，单位毫秒
+		"spool": map[string]interface{}{
+			"enabled":     false,
+			"dir":         "data/transfer/spool",
+			"segmentSize": 64,    //单个segment文件大小，单位MB
+			"maxSize":     10240, //每个队列磁盘占用上限，单位MB
+		},
+		"queryCache": map[string]interface{}{
+			"enabled":      false,
+			"maxSize":      256,  //单位MB
+			"bucket":       60,   //start和end按照60秒对齐
+			"ttl":          300,  //单位秒
+			"recentTTL":    10,   //查询范围和tsdb内存缓存重叠时的缓存时间
+			"recentWindow": 7200, //tsdb默认在内存中保留120分钟
+		},
+		"queryLimit": map[string]interface{}{
+			"maxSeries": 20000,   //单个请求最多查询的曲线数
+			"maxPoints": 5000000, //单个请求最多返回的点数
+			"timeout":   30000,   //单个请求的查询时间，单位毫秒
+		},
 	})
 
 	err = viper.Unmarshal(&Config)
@@ -4,8 +4,6 @@ import (
 	"time"
 
 	"github.com/didi/nightingale/src/modules/transfer/backend"
-
-	"github.com/toolkits/pkg/container/list"
 )
 
 func UpdateJudgeQueue() {
@@ -24,9 +22,11 @@ func updateJudgeQueue() {
 
 	for _, instance := range instances {
 		if !backend.JudgeQueues.Exists(instance) {
-			q := list.NewSafeListLimited(backend.DefaultSendQueueMaxSize)
+			q, created := backend.NewJudgeQueue(instance)
 			backend.JudgeQueues.Set(instance, q)
-			go backend.Send2JudgeTask(q, instance, backend.Config.WorkerNum)
+			if created {
+				go backend.Send2JudgeTask(q, instance, backend.Config.WorkerNum)
+			}
 		} else {
 			backend.JudgeQueues.UpdateTS(instance)
 		}
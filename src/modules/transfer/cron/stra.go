@@ -61,8 +61,8 @@ func getStrategy() {
 		if len(stra.Exprs) < 1 {
 			continue
 		}
-		if stra.Exprs[0].Func == "nodata" {
-			//nodata策略 不使用push模式
+		if stra.Exprs[0].Func == "nodata" || stra.IsAggr() {
+			//nodata策略和集群策略 不使用push模式
 			continue
 		}
 
@@ -0,0 +1,135 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EndpointLabel 在matcher和by中用来表示endpoint
+const EndpointLabel = "endpoint"
+
+type Node interface {
+	String() string
+}
+
+type NumberLiteral struct {
+	Val float64
+}
+
+type Matcher struct {
+	Name  string
+	Op    string // = != =~ !~
+	Value string
+	re    *regexp.Regexp
+}
+
+// Selector metric{tag="v",endpoint=~"a|b"}
+type Selector struct {
+	Metric   string
+	Matchers []*Matcher
+}
+
+// Call rate(e) topk(k, e) bottomk(k, e)
+type Call struct {
+	Func string
+	Args []Node
+}
+
+// Aggregate sum(e) by (tag) 或者 sum by (tag) (e)，op是calc支持的聚合函数
+type Aggregate struct {
+	Op   string
+	Expr Node
+	By   []string
+}
+
+type Binary struct {
+	Op  string
+	LHS Node
+	RHS Node
+}
+
+// Neg 一元负号
+type Neg struct {
+	Expr Node
+}
+
+func newMatcher(name, op, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Op: op, Value: value}
+	if op == "=~" || op == "!~" {
+		// 和prometheus一样，正则是完整匹配
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("bad regexp %q: %v", value, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Match 缺失的tag按照空字符串处理
+func (m *Matcher) Match(v string) bool {
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return m.Name + m.Op + strconv.Quote(m.Value)
+}
+
+func (n *NumberLiteral) String() string {
+	return strconv.FormatFloat(n.Val, 'g', -1, 64)
+}
+
+func (n *Selector) String() string {
+	if len(n.Matchers) == 0 {
+		return n.Metric
+	}
+	ms := make([]string, len(n.Matchers))
+	for i, m := range n.Matchers {
+		ms[i] = m.String()
+	}
+	return n.Metric + "{" + strings.Join(ms, ",") + "}"
+}
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = a.String()
+	}
+	return n.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (n *Aggregate) String() string {
+	s := n.Op + "(" + n.Expr.String() + ")"
+	if len(n.By) > 0 {
+		s += " by (" + strings.Join(n.By, ", ") + ")"
+	}
+	return s
+}
+
+func (n *Binary) String() string {
+	return operand(n.LHS) + " " + n.Op + " " + operand(n.RHS)
+}
+
+func (n *Neg) String() string {
+	return "-" + operand(n.Expr)
+}
+
+// 子表达式是二元运算时加上括号，保证String之后可以重新解析
+func operand(n Node) string {
+	if _, ok := n.(*Binary); ok {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
@@ -0,0 +1,420 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/calc"
+)
+
+// Fetcher 根据selector查询原始数据，返回的数据在计算时还会再按照matcher过滤一次
+type Fetcher func(sel *Selector, start, end int64) ([]*dataobj.TsdbQueryResponse, error)
+
+// 没有配置MaxPoints时，常数表达式最多生成的点数
+const defaultMaxScalarPoints = 10000
+
+type Evaluator struct {
+	Start     int64
+	End       int64
+	Step      int // 表达式结果是常数时，按照step生成点
+	MaxPoints int // 常数表达式最多生成的点数，0使用默认值
+	Fetch     Fetcher
+}
+
+// series 计算过程中的一条曲线，name用于展示，不参与匹配
+type series struct {
+	name     string
+	endpoint string
+	tags     map[string]string
+	step     int
+	values   []*dataobj.RRDData
+}
+
+// value 常数或者一组曲线
+type value struct {
+	isScalar bool
+	scalar   float64
+	series   []*series
+}
+
+// Query 解析并计算表达式
+func (e *Evaluator) Query(input string) ([]*dataobj.TsdbQueryResponse, error) {
+	n, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(n)
+}
+
+func (e *Evaluator) Eval(n Node) ([]*dataobj.TsdbQueryResponse, error) {
+	v, err := e.eval(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.isScalar {
+		if e.Step <= 0 {
+			return nil, fmt.Errorf("step is required when expression is a scalar")
+		}
+		maxPoints := e.MaxPoints
+		if maxPoints <= 0 {
+			maxPoints = defaultMaxScalarPoints
+		}
+		if (e.End-e.Start)/int64(e.Step) > int64(maxPoints) {
+			return nil, fmt.Errorf("too many points for scalar expression, max %d, increase step", maxPoints)
+		}
+		resp := &dataobj.TsdbQueryResponse{Start: e.Start, End: e.End, Counter: n.String(), DsType: "GAUGE", Step: e.Step}
+		for ts := e.Start - e.Start%int64(e.Step); ts <= e.End; ts += int64(e.Step) {
+			if ts >= e.Start {
+				resp.Values = append(resp.Values, dataobj.NewRRDData(ts, v.scalar))
+			}
+		}
+		return []*dataobj.TsdbQueryResponse{resp}, nil
+	}
+
+	resp := make([]*dataobj.TsdbQueryResponse, 0, len(v.series))
+	for _, s := range v.series {
+		resp = append(resp, &dataobj.TsdbQueryResponse{
+			Start:    e.Start,
+			End:      e.End,
+			Endpoint: s.endpoint,
+			Counter:  dataobj.PKWithTags(s.name, dataobj.SortedTags(s.tags)),
+			DsType:   "GAUGE",
+			Step:     s.step,
+			Values:   s.values,
+		})
+	}
+	return resp, nil
+}
+
+func (e *Evaluator) eval(n Node) (*value, error) {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		return &value{isScalar: true, scalar: n.Val}, nil
+	case *Selector:
+		return e.evalSelector(n)
+	case *Neg:
+		v, err := e.eval(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return binary("*", &value{isScalar: true, scalar: -1}, v)
+	case *Binary:
+		lhs, err := e.eval(n.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := e.eval(n.RHS)
+		if err != nil {
+			return nil, err
+		}
+		return binary(n.Op, lhs, rhs)
+	case *Call:
+		return e.evalCall(n)
+	case *Aggregate:
+		v, err := e.eval(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if v.isScalar {
+			return nil, fmt.Errorf("%s expected a series argument", n.Op)
+		}
+		return aggregate(n.Op, n.By, v.series), nil
+	}
+	return nil, fmt.Errorf("unknown node %T", n)
+}
+
+func (e *Evaluator) evalSelector(n *Selector) (*value, error) {
+	if e.Fetch == nil {
+		return nil, fmt.Errorf("fetcher is nil")
+	}
+	datas, err := e.Fetch(n, e.Start, e.End)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &value{}
+	for _, d := range datas {
+		if d == nil || d.Endpoint == "" {
+			continue
+		}
+
+		metric, tagstr := d.Counter, ""
+		if idx := strings.Index(d.Counter, "/"); idx != -1 {
+			metric, tagstr = d.Counter[:idx], d.Counter[idx+1:]
+		}
+		if metric != n.Metric {
+			continue
+		}
+		tags, err := dataobj.SplitTagsString(tagstr)
+		if err != nil {
+			continue
+		}
+		if !n.Match(d.Endpoint, tags) {
+			continue
+		}
+
+		s := &series{name: metric, endpoint: d.Endpoint, tags: tags, step: d.Step}
+		s.values = make([]*dataobj.RRDData, 0, len(d.Values))
+		for _, p := range d.Values {
+			if p.Timestamp < e.Start || p.Timestamp > e.End {
+				continue
+			}
+			s.values = append(s.values, &dataobj.RRDData{Timestamp: p.Timestamp, Value: p.Value})
+		}
+		sort.Sort(dataobj.RRDValues(s.values))
+		v.series = append(v.series, s)
+	}
+
+	// FetchData并发查询，返回的顺序不固定
+	sort.Slice(v.series, func(i, j int) bool { return v.series[i].key() < v.series[j].key() })
+	return v, nil
+}
+
+// Match endpoint和tags是否满足selector中所有的matcher
+func (n *Selector) Match(endpoint string, tags map[string]string) bool {
+	for _, m := range n.Matchers {
+		v := tags[m.Name]
+		if m.Name == EndpointLabel {
+			v = endpoint
+		}
+		if !m.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// key 二元运算时按照endpoint和tags匹配左右两边的曲线
+func (s *series) key() string {
+	return s.endpoint + "/" + dataobj.SortedTags(s.tags)
+}
+
+func binary(op string, lhs, rhs *value) (*value, error) {
+	if lhs.isScalar && rhs.isScalar {
+		return &value{isScalar: true, scalar: apply(op, lhs.scalar, rhs.scalar)}, nil
+	}
+
+	if lhs.isScalar || rhs.isScalar {
+		v := &value{series: []*series{}}
+		for _, s := range lhs.series {
+			v.series = append(v.series, s.mapValues(s.name+" "+op+" "+fmtScalar(rhs.scalar), func(x float64) float64 {
+				return apply(op, x, rhs.scalar)
+			}))
+		}
+		for _, s := range rhs.series {
+			v.series = append(v.series, s.mapValues(fmtScalar(lhs.scalar)+" "+op+" "+s.name, func(x float64) float64 {
+				return apply(op, lhs.scalar, x)
+			}))
+		}
+		return v, nil
+	}
+
+	right := make(map[string]*series, len(rhs.series))
+	for _, s := range rhs.series {
+		k := s.key()
+		if _, exists := right[k]; exists {
+			return nil, fmt.Errorf("duplicate series %s on right side of %s", k, op)
+		}
+		right[k] = s
+	}
+
+	v := &value{series: []*series{}}
+	for _, l := range lhs.series {
+		r, exists := right[l.key()]
+		if !exists {
+			continue
+		}
+
+		// 时间戳没有对齐的点直接丢弃
+		rv := make(map[int64]float64, len(r.values))
+		for _, p := range r.values {
+			rv[p.Timestamp] = float64(p.Value)
+		}
+		s := &series{name: l.name + " " + op + " " + r.name, endpoint: l.endpoint, tags: l.tags, step: l.step}
+		s.values = []*dataobj.RRDData{}
+		for _, p := range l.values {
+			if x, exists := rv[p.Timestamp]; exists {
+				s.values = append(s.values, dataobj.NewRRDData(p.Timestamp, apply(op, float64(p.Value), x)))
+			}
+		}
+		v.series = append(v.series, s)
+	}
+	return v, nil
+}
+
+func apply(op string, a, b float64) float64 {
+	var r float64
+	switch op {
+	case "+":
+		r = a + b
+	case "-":
+		r = a - b
+	case "*":
+		r = a * b
+	case "/":
+		r = a / b
+	}
+	// 除0的结果按照没有数据处理
+	if math.IsInf(r, 0) {
+		return math.NaN()
+	}
+	return r
+}
+
+func fmtScalar(f float64) string {
+	return (&NumberLiteral{Val: f}).String()
+}
+
+func (s *series) mapValues(name string, f func(float64) float64) *series {
+	ns := &series{name: name, endpoint: s.endpoint, tags: s.tags, step: s.step}
+	ns.values = make([]*dataobj.RRDData, len(s.values))
+	for i, p := range s.values {
+		ns.values[i] = dataobj.NewRRDData(p.Timestamp, f(float64(p.Value)))
+	}
+	return ns
+}
+
+func (e *Evaluator) evalCall(n *Call) (*value, error) {
+	arg := n.Args[len(n.Args)-1]
+	v, err := e.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+	if v.isScalar {
+		return nil, fmt.Errorf("%s expected a series argument", n.Func)
+	}
+
+	switch n.Func {
+	case "rate":
+		res := &value{series: make([]*series, len(v.series))}
+		for i, s := range v.series {
+			res.series[i] = rate(s)
+		}
+		return res, nil
+	case "topk", "bottomk":
+		k := int(n.Args[0].(*NumberLiteral).Val)
+		return &value{series: topk(v.series, k, n.Func == "bottomk")}, nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.Func)
+}
+
+// rate 每秒的增长速率，计数器重置(值变小)时按照从0开始计算，第一个点没有速率
+func rate(s *series) *series {
+	ns := &series{name: "rate(" + s.name + ")", endpoint: s.endpoint, tags: s.tags, step: s.step}
+	ns.values = []*dataobj.RRDData{}
+
+	var prev *dataobj.RRDData
+	for _, p := range s.values {
+		if math.IsNaN(float64(p.Value)) {
+			if prev != nil {
+				ns.values = append(ns.values, dataobj.NewRRDData(p.Timestamp, math.NaN()))
+			}
+			continue
+		}
+		if prev != nil {
+			dt := float64(p.Timestamp - prev.Timestamp)
+			delta := float64(p.Value - prev.Value)
+			if delta < 0 {
+				delta = float64(p.Value)
+			}
+			ns.values = append(ns.values, dataobj.NewRRDData(p.Timestamp, delta/dt))
+		}
+		prev = p
+	}
+	return ns
+}
+
+// topk 按照时间范围内的平均值排序，没有数据的曲线排在最后
+func topk(ss []*series, k int, bottom bool) []*series {
+	type ranked struct {
+		s    *series
+		mean float64
+	}
+	rs := make([]ranked, len(ss))
+	for i, s := range ss {
+		sum, cnt := 0.0, 0
+		for _, p := range s.values {
+			if !math.IsNaN(float64(p.Value)) {
+				sum += float64(p.Value)
+				cnt++
+			}
+		}
+		rs[i] = ranked{s: s, mean: math.NaN()}
+		if cnt > 0 {
+			rs[i].mean = sum / float64(cnt)
+		}
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		a, b := rs[i].mean, rs[j].mean
+		if math.IsNaN(a) || math.IsNaN(b) {
+			return !math.IsNaN(a) && math.IsNaN(b)
+		}
+		if bottom {
+			return a < b
+		}
+		return a > b
+	})
+
+	if k > len(rs) {
+		k = len(rs)
+	}
+	res := make([]*series, k)
+	for i := 0; i < k; i++ {
+		res[i] = rs[i].s
+	}
+	return res
+}
+
+// aggregate 按照by中的tag分组，每组使用calc.Compute计算，by中可以使用endpoint
+func aggregate(op string, by []string, ss []*series) *value {
+	groups := make(map[string][]*series)
+	keys := []string{}
+	for _, s := range ss {
+		k := dataobj.SortedTags(groupTags(s, by))
+		if _, exists := groups[k]; !exists {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], s)
+	}
+	sort.Strings(keys)
+
+	v := &value{series: []*series{}}
+	for _, k := range keys {
+		group := groups[k]
+		datas := make([]*dataobj.TsdbQueryResponse, len(group))
+		for i, s := range group {
+			datas[i] = &dataobj.TsdbQueryResponse{Endpoint: s.endpoint, Step: s.step, Values: s.values}
+		}
+
+		first := group[0]
+		tags := groupTags(first, by)
+		ns := &series{name: op + "(" + first.name + ")", tags: tags, step: first.step}
+		if endpoint, exists := tags[EndpointLabel]; exists {
+			ns.endpoint = endpoint
+			delete(tags, EndpointLabel)
+		}
+		ns.values = calc.Compute(op, datas)
+		if ns.values == nil {
+			ns.values = []*dataobj.RRDData{}
+		}
+		v.series = append(v.series, ns)
+	}
+	return v
+}
+
+func groupTags(s *series, by []string) map[string]string {
+	tags := make(map[string]string, len(by))
+	for _, k := range by {
+		if k == EndpointLabel {
+			tags[k] = s.endpoint
+		} else if v, exists := s.tags[k]; exists {
+			tags[k] = v
+		}
+	}
+	return tags
+}
@@ -0,0 +1,187 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+func newResp(endpoint, counter string, vals ...float64) *dataobj.TsdbQueryResponse {
+	d := &dataobj.TsdbQueryResponse{Endpoint: endpoint, Counter: counter, Step: 10}
+	for i, v := range vals {
+		d.Values = append(d.Values, dataobj.NewRRDData(int64(100+i*10), v))
+	}
+	return d
+}
+
+var testData = []*dataobj.TsdbQueryResponse{
+	newResp("h1", "disk.read/device=sda", 1, 2, 3),
+	newResp("h1", "disk.read/device=sdb", 10, 20, 30),
+	newResp("h2", "disk.read/device=sda", 5, 5, 5),
+	newResp("h1", "disk.write/device=sda", 1, 1, 1),
+	newResp("h1", "disk.write/device=sdb", 2, 2, 2),
+	newResp("h1", "net.in", 100, 200, 50),
+}
+
+func testEvaluator() *Evaluator {
+	return &Evaluator{
+		Start: 100,
+		End:   120,
+		Step:  10,
+		Fetch: func(sel *Selector, start, end int64) ([]*dataobj.TsdbQueryResponse, error) {
+			return testData, nil
+		},
+	}
+}
+
+func values(d *dataobj.TsdbQueryResponse) []float64 {
+	vs := make([]float64, len(d.Values))
+	for i, v := range d.Values {
+		vs[i] = float64(v.Value)
+	}
+	return vs
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.IsNaN(a[i]) != math.IsNaN(b[i]) || (!math.IsNaN(a[i]) && a[i] != b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"a + b * 2", "a + (b * 2)"},
+		{"(a + b) * 2", "(a + b) * 2"},
+		{"-a", "-a"},
+		{"-2 * 3", "-2 * 3"},
+		{`disk.read{device=~"sd.*",endpoint!='h1'}`, `disk.read{device=~"sd.*",endpoint!="h1"}`},
+		{"sum by (device) (rate(a))", "sum(rate(a)) by (device)"},
+		{"max(a) by (endpoint, device)", "max(a) by (endpoint, device)"},
+		{"topk(2, a)", "topk(2, a)"},
+		{"sum", "sum"},
+	}
+	for _, c := range cases {
+		n, err := Parse(c.input)
+		if err != nil {
+			t.Errorf("Parse(%q) err: %v", c.input, err)
+			continue
+		}
+		if n.String() != c.want {
+			t.Errorf("Parse(%q) = %q, want %q", c.input, n.String(), c.want)
+		}
+	}
+
+	for _, input := range []string{"", "a +", "a{b=c}", `a{b="c"`, "topk(a, b)", "topk(1.5, a)", "rate(a, b)", "sum by () (a)", "a $ b", `a{b=~"("}`} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) expected error", input)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	cases := []struct {
+		expr     string
+		endpoint []string
+		counter  []string
+		values   [][]float64
+	}{
+		{
+			expr:     `disk.read{device="sda",endpoint="h1"} + disk.write`,
+			endpoint: []string{"h1"},
+			counter:  []string{"disk.read + disk.write/device=sda"},
+			values:   [][]float64{{2, 3, 4}},
+		},
+		{
+			expr:     `net.in / 0`,
+			endpoint: []string{"h1"},
+			counter:  []string{"net.in / 0"},
+			values:   [][]float64{{math.NaN(), math.NaN(), math.NaN()}},
+		},
+		{
+			// 计数器重置时按照从0开始计算
+			expr:     `rate(net.in)`,
+			endpoint: []string{"h1"},
+			counter:  []string{"rate(net.in)"},
+			values:   [][]float64{{10, 5}},
+		},
+		{
+			expr:     `sum(disk.read) by (device)`,
+			endpoint: []string{"", ""},
+			counter:  []string{"sum(disk.read)/device=sda", "sum(disk.read)/device=sdb"},
+			values:   [][]float64{{6, 7, 8}, {10, 20, 30}},
+		},
+		{
+			expr:     `max by (endpoint) (disk.read)`,
+			endpoint: []string{"h1", "h2"},
+			counter:  []string{"max(disk.read)", "max(disk.read)"},
+			values:   [][]float64{{10, 20, 30}, {5, 5, 5}},
+		},
+		{
+			expr:     `topk(1, disk.read{device="sda"})`,
+			endpoint: []string{"h2"},
+			counter:  []string{"disk.read/device=sda"},
+			values:   [][]float64{{5, 5, 5}},
+		},
+		{
+			expr:     `bottomk(1, disk.read)`,
+			endpoint: []string{"h1"},
+			counter:  []string{"disk.read/device=sda"},
+			values:   [][]float64{{1, 2, 3}},
+		},
+		{
+			expr:     `1 + 2 * 3`,
+			endpoint: []string{""},
+			counter:  []string{"1 + (2 * 3)"},
+			values:   [][]float64{{7, 7, 7}},
+		},
+	}
+
+	for _, c := range cases {
+		resp, err := testEvaluator().Query(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if len(resp) != len(c.counter) {
+			t.Errorf("%s: got %d series, want %d", c.expr, len(resp), len(c.counter))
+			continue
+		}
+		for i, d := range resp {
+			if d.Endpoint != c.endpoint[i] || d.Counter != c.counter[i] || !equal(values(d), c.values[i]) {
+				t.Errorf("%s: series %d got %s %s %v, want %s %s %v", c.expr, i,
+					d.Endpoint, d.Counter, values(d), c.endpoint[i], c.counter[i], c.values[i])
+			}
+		}
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	for _, input := range []string{`rate(1)`, `sum(2)`, `topk(1, 2)`} {
+		if _, err := testEvaluator().Query(input); err == nil {
+			t.Errorf("%s expected error", input)
+		}
+	}
+
+	// 常数表达式的点数超过限制
+	e := testEvaluator()
+	e.Step = 1
+	e.End = e.Start + defaultMaxScalarPoints + 1
+	if _, err := e.Query("1"); err == nil {
+		t.Error("expected error for too many points")
+	}
+	e.MaxPoints = 10
+	e.End = e.Start + 20
+	if _, err := e.Query("1"); err == nil {
+		t.Error("expected error for too many points")
+	}
+}
@@ -0,0 +1,158 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tEOF tokenType = iota
+	tNumber
+	tIdent
+	tString
+	tLParen
+	tRParen
+	tLBrace
+	tRBrace
+	tComma
+	tAdd
+	tSub
+	tMul
+	tDiv
+	tEq
+	tNeq
+	tRe
+	tNre
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == tEOF {
+		return "EOF"
+	}
+	return strconv.Quote(t.val)
+}
+
+// metric名中可以有.和:，不能有-，否则和减号冲突
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.' || c == ':'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lex(input string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c):
+			start := i
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+				i++
+			}
+			// 科学计数法 1e3 1e-3
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				i++
+				if i < len(input) && (input[i] == '+' || input[i] == '-') {
+					i++
+				}
+				for i < len(input) && isDigit(input[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tNumber, input[start:i], start})
+		case isIdentStart(c):
+			start := i
+			for i < len(input) && isIdentChar(input[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tIdent, input[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			for i < len(input) && input[i] != c {
+				if input[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(input) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			s, err := unquote(input[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d: %v", start, err)
+			}
+			tokens = append(tokens, token{tString, s, start})
+		default:
+			typ, n := punct(input[i:])
+			if n == 0 {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{typ, input[i : i+n], i})
+			i += n
+		}
+	}
+	return append(tokens, token{tEOF, "", len(input)}), nil
+}
+
+func unquote(s string) (string, error) {
+	if s[0] == '\'' {
+		s = `"` + strings.Replace(s[1:len(s)-1], `"`, `\"`, -1) + `"`
+	}
+	return strconv.Unquote(s)
+}
+
+func punct(s string) (tokenType, int) {
+	if len(s) >= 2 {
+		switch s[:2] {
+		case "!=":
+			return tNeq, 2
+		case "=~":
+			return tRe, 2
+		case "!~":
+			return tNre, 2
+		}
+	}
+
+	switch s[0] {
+	case '(':
+		return tLParen, 1
+	case ')':
+		return tRParen, 1
+	case '{':
+		return tLBrace, 1
+	case '}':
+		return tRBrace, 1
+	case ',':
+		return tComma, 1
+	case '+':
+		return tAdd, 1
+	case '-':
+		return tSub, 1
+	case '*':
+		return tMul, 1
+	case '/':
+		return tDiv, 1
+	case '=':
+		return tEq, 1
+	}
+	return tEOF, 0
+}
@@ -0,0 +1,275 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/didi/nightingale/src/toolkits/calc"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse 语法:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = NUMBER | "(" expr ")" | selector | call | aggregate
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, fmt.Errorf("expected %s but got %s at %d", what, t, t.pos)
+	}
+	return t, nil
+}
+
+func (p *parser) parseExpr() (Node, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tAdd && t.typ != tSub {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: t.val, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseTerm() (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tMul && t.typ != tDiv {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: t.val, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().typ != tSub {
+		return p.parsePrimary()
+	}
+	p.next()
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if num, ok := n.(*NumberLiteral); ok {
+		num.Val = -num.Val
+		return num, nil
+	}
+	return &Neg{Expr: n}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.typ {
+	case tNumber:
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %s at %d", t, t.pos)
+		}
+		return &NumberLiteral{Val: v}, nil
+	case tLParen:
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tRParen, `")"`); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tIdent:
+		next := p.peek()
+		switch {
+		case t.val == "rate" && next.typ == tLParen:
+			return p.parseRate()
+		case (t.val == "topk" || t.val == "bottomk") && next.typ == tLParen:
+			return p.parseTopk(t.val)
+		case calc.ValidFunc(t.val) && (next.typ == tLParen || (next.typ == tIdent && next.val == "by")):
+			return p.parseAggregate(t.val)
+		}
+		return p.parseSelector(t.val)
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+func (p *parser) parseArgs(fn string, n int) ([]Node, error) {
+	p.next() // (
+	args := []Node{}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().typ != tComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tRParen, `")"`); err != nil {
+		return nil, err
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("%s expected %d arguments but got %d", fn, n, len(args))
+	}
+	return args, nil
+}
+
+func (p *parser) parseRate() (Node, error) {
+	args, err := p.parseArgs("rate", 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Call{Func: "rate", Args: args}, nil
+}
+
+func (p *parser) parseTopk(fn string) (Node, error) {
+	args, err := p.parseArgs(fn, 2)
+	if err != nil {
+		return nil, err
+	}
+	k, ok := args[0].(*NumberLiteral)
+	if !ok || k.Val < 1 || k.Val != float64(int(k.Val)) {
+		return nil, fmt.Errorf("%s expected a positive integer as first argument", fn)
+	}
+	return &Call{Func: fn, Args: args}, nil
+}
+
+func (p *parser) parseAggregate(op string) (Node, error) {
+	n := &Aggregate{Op: op}
+
+	var err error
+	if p.peek().typ == tIdent {
+		if n.By, err = p.parseBy(); err != nil {
+			return nil, err
+		}
+	}
+
+	args, err := p.parseArgs(op, 1)
+	if err != nil {
+		return nil, err
+	}
+	n.Expr = args[0]
+
+	if n.By == nil && p.peek().typ == tIdent && p.peek().val == "by" {
+		if n.By, err = p.parseBy(); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// by (a, b)
+func (p *parser) parseBy() ([]string, error) {
+	p.next() // by
+	if _, err := p.expect(tLParen, `"("`); err != nil {
+		return nil, err
+	}
+	by := []string{}
+	for p.peek().typ != tRParen {
+		t, err := p.expect(tIdent, "label name")
+		if err != nil {
+			return nil, err
+		}
+		by = append(by, t.val)
+		if p.peek().typ != tComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tRParen, `")"`); err != nil {
+		return nil, err
+	}
+	if len(by) == 0 {
+		return nil, fmt.Errorf("by expected at least one label")
+	}
+	return by, nil
+}
+
+// metric{k="v", k!="v", k=~"re", k!~"re"}
+func (p *parser) parseSelector(metric string) (Node, error) {
+	n := &Selector{Metric: metric}
+	if p.peek().typ != tLBrace {
+		return n, nil
+	}
+	p.next()
+
+	for p.peek().typ != tRBrace {
+		name, err := p.expect(tIdent, "label name")
+		if err != nil {
+			return nil, err
+		}
+		op := p.next()
+		if op.typ != tEq && op.typ != tNeq && op.typ != tRe && op.typ != tNre {
+			return nil, fmt.Errorf("expected matcher operator but got %s at %d", op, op.pos)
+		}
+		value, err := p.expect(tString, "quoted label value")
+		if err != nil {
+			return nil, err
+		}
+		m, err := newMatcher(name.val, op.val, value.val)
+		if err != nil {
+			return nil, err
+		}
+		n.Matchers = append(n.Matchers, m)
+
+		if p.peek().typ != tComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tRBrace, `"}"`); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
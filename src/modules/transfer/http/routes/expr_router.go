@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/transfer/backend"
+	"github.com/didi/nightingale/src/modules/transfer/expr"
+	"github.com/didi/nightingale/src/toolkits/http/render"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+)
+
+type ExprQueryReq struct {
+	Expr       string   `json:"expr"`
+	Start      int64    `json:"start"`
+	End        int64    `json:"end"`
+	Endpoints  []string `json:"endpoints"`
+	Step       int      `json:"step"`
+	ConsolFunc string   `json:"consolFunc"`
+}
+
+// QueryExpr 计算表达式，例如 sum(rate(disk.io.read.bytes{device=~"sd.*"})) by (endpoint)
+// 每个selector使用endpoints和endpoint的matcher确定查询的机器
+func QueryExpr(c *gin.Context) {
+	stats.Counter.Set("data.expr.qp10s", 1)
+
+	var input ExprQueryReq
+	errors.Dangerous(c.ShouldBindJSON(&input))
+
+	if input.Expr == "" {
+		errors.Bomb("expr is blank")
+	}
+	if input.End <= input.Start {
+		errors.Bomb("end must be greater than start")
+	}
+	if input.ConsolFunc == "" {
+		input.ConsolFunc = "AVERAGE"
+	}
+
+	//表达式中所有selector的查询共用限制
+	l := backend.NewQueryLimiter()
+	e := &expr.Evaluator{
+		Start:     input.Start,
+		End:       input.End,
+		Step:      input.Step,
+		MaxPoints: backend.Config.QueryLimit.MaxPoints,
+		Fetch:     exprFetcher(input, l),
+	}
+	resp, err := e.Query(input.Expr)
+	if err != nil {
+		render.Message(c, err)
+		return
+	}
+	renderQuery(c, resp, &l.Stat)
+}
+
+func exprFetcher(input ExprQueryReq, l *backend.QueryLimiter) expr.Fetcher {
+	return func(sel *expr.Selector, start, end int64) ([]*dataobj.TsdbQueryResponse, error) {
+		endpoints := selectorEndpoints(sel, input.Endpoints)
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("%s: no endpoint, set endpoints or use endpoint=\"...\"", sel)
+		}
+
+		var cresp cludeResp
+		req := []cludeReq{{Endpoints: endpoints, Metric: sel.Metric, Include: selectorInclude(sel)}}
+		if err := postIndex(indexCludePath, req, &cresp); err != nil {
+			return nil, err
+		}
+		if cresp.Err != "" {
+			return nil, fmt.Errorf("index: %s", cresp.Err)
+		}
+
+		queryDatas := []dataobj.QueryData{}
+		for _, item := range cresp.Dat {
+			counters := []string{}
+			for _, tag := range item.Tags {
+				tagsMap, err := dataobj.SplitTagsString(tag)
+				if err != nil || !sel.Match(item.Endpoint, tagsMap) {
+					continue
+				}
+				counters = append(counters, dataobj.PKWithTags(item.Metric, dataobj.SortedTags(tagsMap)))
+			}
+			if len(item.Tags) == 0 && sel.Match(item.Endpoint, nil) {
+				counters = append(counters, item.Metric)
+			}
+			if len(counters) == 0 {
+				continue
+			}
+
+			step := item.Step
+			if input.Step > 0 {
+				step = input.Step
+			}
+			queryDatas = append(queryDatas, dataobj.QueryData{
+				Start:      start,
+				End:        end,
+				Endpoints:  []string{item.Endpoint},
+				Counters:   counters,
+				ConsolFunc: input.ConsolFunc,
+				DsType:     item.DsType,
+				Step:       step,
+			})
+		}
+
+		return l.FetchData(queryDatas), nil
+	}
+}
+
+// selectorEndpoints 请求中的endpoints按照endpoint的matcher过滤
+// 请求中没有endpoints时，使用endpoint="a"或者endpoint=~"a|b"中的机器
+func selectorEndpoints(sel *expr.Selector, endpoints []string) []string {
+	if len(endpoints) == 0 {
+		for _, m := range sel.Matchers {
+			if m.Name != expr.EndpointLabel {
+				continue
+			}
+			if m.Op == "=" {
+				endpoints = append(endpoints, m.Value)
+			} else if m.Op == "=~" && literalAlternation.MatchString(m.Value) {
+				endpoints = append(endpoints, strings.Split(m.Value, "|")...)
+			}
+		}
+	}
+
+	res := []string{}
+	for _, endpoint := range endpoints {
+		matched := true
+		for _, m := range sel.Matchers {
+			if m.Name == expr.EndpointLabel && !m.Match(endpoint) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			res = append(res, endpoint)
+		}
+	}
+	return res
+}
+
+// selectorInclude 等于的matcher交给索引过滤
+func selectorInclude(sel *expr.Selector) []*Tagkv {
+	include := []*Tagkv{}
+	for _, m := range sel.Matchers {
+		if m.Op == "=" && m.Value != "" && m.Name != expr.EndpointLabel {
+			include = append(include, &Tagkv{TagK: m.Name, TagV: []string{m.Value}})
+		}
+	}
+	return include
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/didi/nightingale/src/modules/transfer/config"
+	"github.com/didi/nightingale/src/modules/transfer/receiver"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/logger"
+)
+
+// InfluxWrite 兼容influxdb的 /write?precision=，解析成功的行照常写入
+// 有解析失败的行时返回400，和influxdb的partial write行为一致
+func InfluxWrite(c *gin.Context) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, errs := receiver.ParseInflux(body, c.Query("precision"), config.Config.Influx)
+	receiver.Push(items)
+
+	if len(errs) > 0 {
+		stats.Counter.Set("influx.parse.err", len(errs))
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		logger.Warningf("parse influx lines err:%s", strings.Join(msgs, "; "))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "partial write: " + strings.Join(msgs, "; ")})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/transfer/config"
+	"github.com/didi/nightingale/src/modules/transfer/receiver"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/logger"
+)
+
+// OpentsdbPut 兼容opentsdb的 /api/put，body可以是单个点也可以是数组
+// 全部成功返回204，有失败的点返回400和成功失败的个数
+func OpentsdbPut(c *gin.Context) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	points := []*receiver.OpentsdbPoint{}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		var p receiver.OpentsdbPoint
+		err = json.Unmarshal(body, &p)
+		points = append(points, &p)
+	} else {
+		err = json.Unmarshal(body, &points)
+	}
+	if err != nil {
+		stats.Counter.Set("opentsdb.parse.err", 1)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unmarshal body err: " + err.Error()})
+		return
+	}
+
+	items := make([]*dataobj.MetricValue, 0, len(points))
+	failed := 0
+	for _, p := range points {
+		item, err := receiver.ConvertOpentsdbPoint(p, config.Config.Opentsdb)
+		if err != nil {
+			stats.Counter.Set("opentsdb.parse.err", 1)
+			logger.Warningf("parse opentsdb point %+v err:%v", p, err)
+			failed++
+			continue
+		}
+		items = append(items, item)
+	}
+
+	invalid, _ := receiver.Push(items)
+	failed += invalid
+	if failed > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": len(points) - failed, "failed": failed})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,283 @@
+package routes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/transfer/backend"
+	"github.com/didi/nightingale/src/modules/transfer/config"
+	"github.com/didi/nightingale/src/toolkits/prompb"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+const (
+	indexMetricsPath = "/api/index/metrics"
+	indexCludePath   = "/api/index/counter/clude"
+)
+
+// PromRead 接收prometheus remote_read，matcher中必须指定__name__和endpoint对应的label
+// endpoint的label只支持=和只包含a|b|c的正则，其他label的matcher在查询索引之后过滤
+func PromRead(c *gin.Context) {
+	compressed, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bs, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		c.String(http.StatusBadRequest, "snappy decode err: "+err.Error())
+		return
+	}
+
+	var req prompb.ReadRequest
+	if err := proto.Unmarshal(bs, &req); err != nil {
+		c.String(http.StatusBadRequest, "unmarshal ReadRequest err: "+err.Error())
+		return
+	}
+
+	stats.Counter.Set("prom.read", 1)
+	l := backend.NewQueryLimiter()
+	resp := &prompb.ReadResponse{}
+	for _, q := range req.Queries {
+		series, err := promQuery(q, config.Config.Prom.EndpointLabel, l)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		resp.Results = append(resp.Results, &prompb.QueryResult{Timeseries: series})
+	}
+
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// remote_read协议中没有表示结果不完整的字段，通过header返回触发的限制
+	if l.Stat.Partial {
+		c.Header("X-Query-Partial", strings.Join(l.Stat.Limits, ","))
+	}
+	c.Header("Content-Encoding", "snappy")
+	c.Data(http.StatusOK, "application/x-protobuf", snappy.Encode(nil, data))
+}
+
+type promMatchers struct {
+	name      string
+	endpoints []string
+	matchers  []*prompb.LabelMatcher
+	regexps   map[*prompb.LabelMatcher]*regexp.Regexp
+}
+
+var literalAlternation = regexp.MustCompile(`^[a-zA-Z0-9._\-]+(\|[a-zA-Z0-9._\-]+)*$`)
+
+func parsePromMatchers(ms []*prompb.LabelMatcher, endpointLabel string) (*promMatchers, error) {
+	pm := &promMatchers{regexps: make(map[*prompb.LabelMatcher]*regexp.Regexp)}
+	for _, m := range ms {
+		if m.Type == prompb.LabelMatcher_RE || m.Type == prompb.LabelMatcher_NRE {
+			// prometheus的正则是完整匹配
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("bad regexp %s: %v", m.Value, err)
+			}
+			pm.regexps[m] = re
+		}
+
+		switch {
+		case m.Name == "__name__":
+			if m.Type != prompb.LabelMatcher_EQ {
+				return nil, fmt.Errorf("__name__ only support =")
+			}
+			pm.name = m.Value
+		case m.Name == endpointLabel && m.Type == prompb.LabelMatcher_EQ:
+			pm.endpoints = append(pm.endpoints, m.Value)
+		case m.Name == endpointLabel && m.Type == prompb.LabelMatcher_RE && literalAlternation.MatchString(m.Value):
+			pm.endpoints = append(pm.endpoints, strings.Split(m.Value, "|")...)
+		default:
+			pm.matchers = append(pm.matchers, m)
+		}
+	}
+
+	if pm.name == "" {
+		return nil, fmt.Errorf("__name__ is required")
+	}
+	if len(pm.endpoints) == 0 {
+		return nil, fmt.Errorf("%s is required, use = or a|b", endpointLabel)
+	}
+	return pm, nil
+}
+
+// match 其他label的matcher，缺失的label按照空字符串处理
+func (pm *promMatchers) match(labels map[string]string) bool {
+	for _, m := range pm.matchers {
+		v := labels[m.Name]
+		switch m.Type {
+		case prompb.LabelMatcher_EQ:
+			if v != m.Value {
+				return false
+			}
+		case prompb.LabelMatcher_NEQ:
+			if v == m.Value {
+				return false
+			}
+		case prompb.LabelMatcher_RE:
+			if !pm.regexps[m].MatchString(v) {
+				return false
+			}
+		case prompb.LabelMatcher_NRE:
+			if pm.regexps[m].MatchString(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// include 等于的matcher交给索引过滤，减少返回的counter
+func (pm *promMatchers) include(endpointLabel string) []*Tagkv {
+	include := []*Tagkv{}
+	for _, m := range pm.matchers {
+		if m.Type == prompb.LabelMatcher_EQ && m.Value != "" && m.Name != endpointLabel {
+			include = append(include, &Tagkv{TagK: m.Name, TagV: []string{m.Value}})
+		}
+	}
+	return include
+}
+
+type cludeReq struct {
+	Endpoints []string `json:"endpoints"`
+	Metric    string   `json:"metric"`
+	Include   []*Tagkv `json:"include"`
+}
+
+type cludeResp struct {
+	Dat []struct {
+		Endpoint string   `json:"endpoint"`
+		Metric   string   `json:"metric"`
+		Tags     []string `json:"tags"`
+		Step     int      `json:"step"`
+		DsType   string   `json:"dstype"`
+	} `json:"dat"`
+	Err string `json:"err"`
+}
+
+type metricsResp struct {
+	Dat struct {
+		Metrics []string `json:"metrics"`
+	} `json:"dat"`
+	Err string `json:"err"`
+}
+
+func promQuery(q *prompb.Query, endpointLabel string, l *backend.QueryLimiter) ([]*prompb.TimeSeries, error) {
+	pm, err := parsePromMatchers(q.Matchers, endpointLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := q.StartTimestampMs/1000, q.EndTimestampMs/1000
+
+	// nightingale的metric中可能有.，转换成prometheus的名字之后匹配
+	var mresp metricsResp
+	if err := postIndex(indexMetricsPath, map[string][]string{"endpoints": pm.endpoints}, &mresp); err != nil {
+		return nil, err
+	}
+	metrics := []string{}
+	for _, m := range mresp.Dat.Metrics {
+		if m == pm.name || prompb.MetricName(m) == pm.name {
+			metrics = append(metrics, m)
+		}
+	}
+	if len(metrics) == 0 {
+		return []*prompb.TimeSeries{}, nil
+	}
+
+	reqs := make([]cludeReq, 0, len(metrics))
+	for _, m := range metrics {
+		reqs = append(reqs, cludeReq{Endpoints: pm.endpoints, Metric: m, Include: pm.include(endpointLabel)})
+	}
+
+	var cresp cludeResp
+	if err := postIndex(indexCludePath, reqs, &cresp); err != nil {
+		return nil, err
+	}
+
+	queryDatas := []dataobj.QueryData{}
+	for _, item := range cresp.Dat {
+		counters := []string{}
+		for _, tag := range item.Tags {
+			tagsMap, err := dataobj.SplitTagsString(tag)
+			if err != nil {
+				continue
+			}
+			if !pm.match(promTagLabels(item.Endpoint, tagsMap, endpointLabel)) {
+				continue
+			}
+			counters = append(counters, dataobj.PKWithTags(item.Metric, dataobj.SortedTags(tagsMap)))
+		}
+		if len(item.Tags) == 0 && pm.match(promTagLabels(item.Endpoint, nil, endpointLabel)) {
+			counters = append(counters, item.Metric)
+		}
+		if len(counters) == 0 || item.Step == 0 {
+			continue
+		}
+
+		queryDatas = append(queryDatas, dataobj.QueryData{
+			Start:      start,
+			End:        end,
+			Endpoints:  []string{item.Endpoint},
+			Counters:   counters,
+			ConsolFunc: "AVERAGE",
+			DsType:     item.DsType,
+			Step:       item.Step,
+		})
+	}
+
+	return toPromSeries(l.FetchData(queryDatas), endpointLabel, q.StartTimestampMs, q.EndTimestampMs), nil
+}
+
+func promTagLabels(endpoint string, tags map[string]string, endpointLabel string) map[string]string {
+	labels := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		labels[prompb.LabelName(k)] = v
+	}
+	labels[endpointLabel] = endpoint
+	return labels
+}
+
+func toPromSeries(data []*dataobj.TsdbQueryResponse, endpointLabel string, startMs, endMs int64) []*prompb.TimeSeries {
+	series := []*prompb.TimeSeries{}
+	for _, d := range data {
+		if d == nil || d.Endpoint == "" {
+			continue
+		}
+
+		metric, tags := d.Counter, ""
+		if idx := strings.Index(d.Counter, "/"); idx != -1 {
+			metric, tags = d.Counter[:idx], d.Counter[idx+1:]
+		}
+
+		item := &dataobj.MetricValue{Metric: metric, Endpoint: d.Endpoint, TagsMap: dataobj.DictedTagstring(tags)}
+		ts := &prompb.TimeSeries{Labels: backend.PromLabels(item, endpointLabel)}
+
+		for _, v := range d.Values {
+			ms := v.Timestamp * 1000
+			if math.IsNaN(float64(v.Value)) || ms < startMs || ms > endMs {
+				continue
+			}
+			ts.Samples = append(ts.Samples, &prompb.Sample{Value: float64(v.Value), Timestamp: ms})
+		}
+		sort.Slice(ts.Samples, func(i, j int) bool { return ts.Samples[i].Timestamp < ts.Samples[j].Timestamp })
+		series = append(series, ts)
+	}
+	return series
+}
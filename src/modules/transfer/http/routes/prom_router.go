@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/didi/nightingale/src/modules/transfer/config"
+	"github.com/didi/nightingale/src/modules/transfer/receiver"
+	"github.com/didi/nightingale/src/toolkits/prompb"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/toolkits/pkg/logger"
+)
+
+// PromWrite 接收prometheus remote_write，body是snappy压缩的WriteRequest
+// 请求格式错误返回400，prometheus不会重试
+func PromWrite(c *gin.Context) {
+	compressed, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bs, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		c.String(http.StatusBadRequest, "snappy decode err: "+err.Error())
+		return
+	}
+
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(bs, &req); err != nil {
+		c.String(http.StatusBadRequest, "unmarshal WriteRequest err: "+err.Error())
+		return
+	}
+
+	stats.Counter.Set("prom.write", 1)
+	_, msg := receiver.Push(receiver.ConvertPromWrite(&req, config.Config.Prom))
+	if msg != "" {
+		logger.Debugf("prom write invalid points: %s", msg)
+	}
+
+	c.Status(http.StatusNoContent)
+}
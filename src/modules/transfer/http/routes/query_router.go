@@ -53,8 +53,9 @@ func QueryDataForJudge(c *gin.Context) {
 	var inputs []dataobj.QueryData
 
 	errors.Dangerous(c.ShouldBindJSON(&inputs))
-	resp := backend.FetchData(inputs)
-	render.Data(c, resp, nil)
+	l := backend.NewQueryLimiter()
+	resp := l.FetchData(inputs)
+	renderQuery(c, resp, &l.Stat)
 }
 
 func QueryData(c *gin.Context) {
@@ -71,8 +72,9 @@ func QueryData(c *gin.Context) {
 		return
 	}
 
-	resp := backend.FetchData(queryData)
-	render.Data(c, resp, nil)
+	l := backend.NewQueryLimiter()
+	resp := l.FetchData(queryData)
+	renderQuery(c, resp, &l.Stat)
 }
 
 func QueryDataForUI(c *gin.Context) {
@@ -82,48 +84,58 @@ func QueryDataForUI(c *gin.Context) {
 
 	errors.Dangerous(c.ShouldBindJSON(&input))
 
-	resp := backend.FetchDataForUI(input)
+	//环比的查询和当前的查询共用限制
+	l := backend.NewQueryLimiter()
+	resp := l.FetchDataForUI(input)
 	if len(input.Comparisons) > 1 {
 		for i := 1; i < len(input.Comparisons); i++ {
 			input.Start = input.Start - input.Comparisons[i]
 			input.End = input.End - input.Comparisons[i]
-			res := backend.FetchDataForUI(input)
+			res := l.FetchDataForUI(input)
 			resp = append(resp, res...)
 		}
 	}
 
-	render.Data(c, resp, nil)
+	renderQuery(c, resp, &l.Stat)
 }
 
-func GetSeries(start, end int64, req []SeriesReq) ([]dataobj.QueryData, error) {
-	var res SeriesResp
-	var queryDatas []dataobj.QueryData
-
-	if len(req) < 1 {
-		return queryDatas, fmt.Errorf("req err")
+// renderQuery 超过查询限制时，返回中增加partial和limits，dat中是已经查到的数据
+func renderQuery(c *gin.Context, resp interface{}, stat *backend.QueryStat) {
+	if !stat.Partial {
+		render.Data(c, resp, nil)
+		return
 	}
 
-	addrs := address.GetHTTPAddresses("index")
+	c.JSON(200, gin.H{"dat": resp, "err": "", "partial": true, "limits": stat.Limits})
+}
 
+// 随机选一个index实例发送请求
+func postIndex(path string, req, resp interface{}) error {
+	addrs := address.GetHTTPAddresses("index")
 	if len(addrs) < 1 {
-		return queryDatas, fmt.Errorf("index addr is nil")
+		return fmt.Errorf("index addr is nil")
 	}
 
-	i := rand.Intn(len(addrs))
-	addr := fmt.Sprintf("http://%s%s", addrs[i], config.Config.Index.Path)
-
-	resp, code, err := httplib.PostJSON(addr, time.Duration(config.Config.Index.Timeout)*time.Millisecond, req, nil)
+	addr := fmt.Sprintf("http://%s%s", addrs[rand.Intn(len(addrs))], path)
+	bs, code, err := httplib.PostJSON(addr, time.Duration(config.Config.Index.Timeout)*time.Millisecond, req, nil)
 	if err != nil {
-		return queryDatas, err
+		return err
 	}
-
 	if code != 200 {
-		return nil, fmt.Errorf("index response status code != 200")
+		return fmt.Errorf("index response status code %d", code)
 	}
+	return json.Unmarshal(bs, resp)
+}
 
-	err = json.Unmarshal(resp, &res)
-	if err != nil {
-		logger.Error(string(resp))
+func GetSeries(start, end int64, req []SeriesReq) ([]dataobj.QueryData, error) {
+	var res SeriesResp
+	var queryDatas []dataobj.QueryData
+
+	if len(req) < 1 {
+		return queryDatas, fmt.Errorf("req err")
+	}
+
+	if err := postIndex(config.Config.Index.Path, req, &res); err != nil {
 		return queryDatas, err
 	}
 
@@ -156,5 +168,5 @@ func GetSeries(start, end int64, req []SeriesReq) ([]dataobj.QueryData, error) {
 		queryDatas = append(queryDatas, queryData)
 	}
 
-	return queryDatas, err
+	return queryDatas, nil
 }
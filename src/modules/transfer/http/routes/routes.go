@@ -13,10 +13,14 @@ func Config(r *gin.Engine) {
 		sys.GET("/version", version)
 		sys.GET("/pid", pid)
 		sys.GET("/addr", addr)
+		sys.GET("/spool", spoolStats)
 
 		sys.POST("/push", PushData)
+		sys.POST("/prom/write", PromWrite)
+		sys.POST("/prom/read", PromRead)
 		sys.POST("/data", QueryDataForJudge)
 		sys.POST("/data/ui", QueryDataForUI)
+		sys.POST("/query", QueryExpr)
 	}
 
 	v2 := r.Group("/api/transfer/v2")
@@ -24,5 +28,9 @@ func Config(r *gin.Engine) {
 		v2.POST("/data", QueryData)
 	}
 
+	// 兼容opentsdb和influxdb的写入接口，已有的采集端只需要修改地址
+	r.POST("/api/put", OpentsdbPut)
+	r.POST("/write", InfluxWrite)
+
 	pprof.Register(r, "/api/transfer/debug/pprof")
 }
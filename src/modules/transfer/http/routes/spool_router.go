@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/didi/nightingale/src/modules/transfer/backend"
+	"github.com/didi/nightingale/src/toolkits/http/render"
+
+	"github.com/gin-gonic/gin"
+)
+
+// spoolStats 每个tsdb和judge发送队列的积压情况
+func spoolStats(c *gin.Context) {
+	render.Data(c, backend.SpoolStats(), nil)
+}
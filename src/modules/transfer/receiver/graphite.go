@@ -0,0 +1,206 @@
+package receiver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// GraphiteSection listen非空时开启graphite plaintext协议的tcp端口
+// templates按顺序匹配，第一个filter匹配的template生效，都不匹配时整个path作为metric
+type GraphiteSection struct {
+	Listen    string             `yaml:"listen"`
+	Step      int                `yaml:"step"`
+	Templates []GraphiteTemplate `yaml:"templates"`
+}
+
+// GraphiteTemplate filter中的*匹配任意一段，filter比path短时按前缀匹配
+// template按.切分后和path逐段对应：
+// endpoint 作为endpoint，metric 拼接到metric中，metric* 剩余所有段都拼接到metric中，
+// _ 或者空 忽略这一段，其他的作为tag名，这一段作为tag值
+type GraphiteTemplate struct {
+	Filter   string            `yaml:"filter"`
+	Template string            `yaml:"template"`
+	Tags     map[string]string `yaml:"tags"`
+}
+
+func StartGraphite(cfg GraphiteSection) {
+	if cfg.Listen == "" {
+		return
+	}
+
+	if cfg.Step <= 0 {
+		logger.Warningf("graphite step %d is illegal, use %d", cfg.Step, defaultReceiverStep)
+		cfg.Step = defaultReceiverStep
+	}
+
+	l, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.Fatal("cannot listen ", cfg.Listen, err)
+		return
+	}
+	logger.Info("graphite listening ", cfg.Listen)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			logger.Warning("graphite listener accept error: ", err)
+			time.Sleep(time.Duration(100) * time.Millisecond)
+			continue
+		}
+		go handleGraphiteConn(conn, cfg)
+	}
+}
+
+func handleGraphiteConn(conn net.Conn, cfg GraphiteSection) {
+	defer conn.Close()
+
+	// template中没有endpoint时使用发送端的ip
+	peer, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		item, err := ParseGraphiteLine(line, peer, cfg)
+		if err != nil {
+			stats.Counter.Set("graphite.parse.err", 1)
+			logger.Warningf("parse graphite line %q err:%v", line, err)
+			continue
+		}
+		Push([]*dataobj.MetricValue{item})
+	}
+}
+
+// ParseGraphiteLine 解析 <path> <value> [timestamp]，path支持 a.b.c;tag1=v1;tag2=v2 的格式
+func ParseGraphiteLine(line, defaultEndpoint string, cfg GraphiteSection) (*dataobj.MetricValue, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("expect 2 or 3 fields, got %d", len(fields))
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %s", fields[1])
+	}
+
+	var ts int64
+	if len(fields) == 3 {
+		// graphite中-1表示使用当前时间，时间戳可能带小数
+		t, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %s", fields[2])
+		}
+		ts = normalizeTimestamp(int64(t))
+	}
+
+	tagParts := strings.Split(fields[0], ";")
+	endpoint, metric, tags, err := applyGraphiteTemplate(tagParts[0], cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kv := range tagParts[1:] {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("invalid tag: %s", kv)
+		}
+		tags[pair[0]] = pair[1]
+	}
+
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+
+	return &dataobj.MetricValue{
+		Metric:       metric,
+		Endpoint:     endpoint,
+		Timestamp:    ts,
+		Step:         int64(cfg.Step),
+		ValueUntyped: value,
+		CounterType:  dataobj.GAUGE,
+		TagsMap:      tags,
+	}, nil
+}
+
+func applyGraphiteTemplate(path string, templates []GraphiteTemplate) (string, string, map[string]string, error) {
+	parts := strings.Split(path, ".")
+	tags := make(map[string]string)
+
+	var tpl *GraphiteTemplate
+	for i := range templates {
+		if matchGraphiteFilter(templates[i].Filter, parts) {
+			tpl = &templates[i]
+			break
+		}
+	}
+
+	if tpl == nil {
+		return "", path, tags, nil
+	}
+
+	var endpoint string
+	metric := []string{}
+	for i, seg := range strings.Split(tpl.Template, ".") {
+		if i >= len(parts) {
+			break
+		}
+
+		switch seg {
+		case "", "_":
+		case "endpoint":
+			endpoint = parts[i]
+		case "metric":
+			metric = append(metric, parts[i])
+		case "metric*":
+			metric = append(metric, parts[i:]...)
+		default:
+			tags[seg] = parts[i]
+		}
+
+		if seg == "metric*" {
+			break
+		}
+	}
+
+	if len(metric) == 0 {
+		return "", "", nil, fmt.Errorf("template %q has no metric for path %s", tpl.Template, path)
+	}
+
+	for k, v := range tpl.Tags {
+		if _, exists := tags[k]; !exists {
+			tags[k] = v
+		}
+	}
+
+	return endpoint, strings.Join(metric, "."), tags, nil
+}
+
+func matchGraphiteFilter(filter string, parts []string) bool {
+	if filter == "" {
+		return true
+	}
+
+	fs := strings.Split(filter, ".")
+	if len(fs) > len(parts) {
+		return false
+	}
+
+	for i, f := range fs {
+		if f != "*" && f != parts[i] {
+			return false
+		}
+	}
+	return true
+}
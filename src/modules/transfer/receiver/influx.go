@@ -0,0 +1,205 @@
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+// InfluxSection 一行中的每个field生成一个点，metric为 measurement.field
+// field名是value时metric直接使用measurement
+type InfluxSection struct {
+	EndpointTag string `yaml:"endpointTag"`
+	Step        int    `yaml:"step"`
+}
+
+// 不同精度的时间戳换算成秒需要除以的值
+var influxPrecisions = map[string]int64{
+	"":   1e9,
+	"n":  1e9,
+	"ns": 1e9,
+	"u":  1e6,
+	"us": 1e6,
+	"ms": 1e3,
+	"s":  1,
+}
+
+// ParseInflux 解析line protocol，返回解析出来的点和每一行的解析错误
+func ParseInflux(body []byte, precision string, cfg InfluxSection) ([]*dataobj.MetricValue, []error) {
+	divisor, exists := influxPrecisions[precision]
+	if !exists {
+		return nil, []error{fmt.Errorf("invalid precision: %s", precision)}
+	}
+
+	items := []*dataobj.MetricValue{}
+	errs := []error{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		lineItems, err := ParseInfluxLine(line, divisor, cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %q: %v", line, err))
+			continue
+		}
+		items = append(items, lineItems...)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return items, errs
+}
+
+// ParseInfluxLine measurement[,tag=v...] field=v[,field=v...] [timestamp]
+func ParseInfluxLine(line string, divisor int64, cfg InfluxSection) ([]*dataobj.MetricValue, error) {
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("expect 2 or 3 sections, got %d", len(sections))
+	}
+
+	keys := splitUnescaped(sections[0], ',', false)
+	measurement := unescapeInflux(keys[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("missing measurement")
+	}
+
+	tags := make(map[string]string)
+	for _, kv := range keys[1:] {
+		pair := splitUnescaped(kv, '=', false)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("invalid tag: %s", kv)
+		}
+		tags[unescapeInflux(pair[0])] = unescapeInflux(pair[1])
+	}
+	endpoint := tags[cfg.EndpointTag]
+	delete(tags, cfg.EndpointTag)
+
+	var ts int64
+	if len(sections) == 3 {
+		t, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %s", sections[2])
+		}
+		ts = t / divisor
+	}
+
+	items := []*dataobj.MetricValue{}
+	for _, kv := range splitUnescaped(sections[1], ',', true) {
+		idx := indexUnescaped(kv, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid field: %s", kv)
+		}
+
+		field := unescapeInflux(kv[:idx])
+		value, ok, err := parseInfluxValue(kv[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", field, err)
+		}
+		if !ok {
+			// 字符串类型的field没法存储，直接忽略
+			continue
+		}
+
+		metric := measurement
+		if field != "value" {
+			metric = measurement + "." + field
+		}
+
+		items = append(items, &dataobj.MetricValue{
+			Metric:       metric,
+			Endpoint:     endpoint,
+			Timestamp:    ts,
+			Step:         int64(cfg.Step),
+			ValueUntyped: value,
+			CounterType:  dataobj.GAUGE,
+			TagsMap:      tags,
+		})
+	}
+
+	return items, nil
+}
+
+// 返回值，是否是数值类型
+func parseInfluxValue(s string) (float64, bool, error) {
+	if s == "" {
+		return 0, false, fmt.Errorf("missing value")
+	}
+
+	if s[0] == '"' {
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return 0, false, fmt.Errorf("unterminated string: %s", s)
+		}
+		return 0, false, nil
+	}
+
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	last := s[len(s)-1]
+	if last == 'i' || last == 'u' {
+		v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid integer: %s", s)
+		}
+		return float64(v), true, nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid float: %s", s)
+	}
+	return v, true, nil
+}
+
+// splitUnescaped 按照没有被反斜杠转义的sep切分，quoted为true时双引号中的sep不切分
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	parts := []string{}
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\"`, `"`, `\\`, `\`)
+
+func unescapeInflux(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+	return influxUnescaper.Replace(s)
+}
@@ -0,0 +1,143 @@
+package receiver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// OpentsdbSection listen非空时开启telnet的put协议，http的/api/put始终可用
+// endpointTag对应的tag作为endpoint，不再作为tag
+type OpentsdbSection struct {
+	Listen      string `yaml:"listen"`
+	EndpointTag string `yaml:"endpointTag"`
+	Step        int    `yaml:"step"`
+}
+
+// OpentsdbPoint /api/put 的body，value可能是数字也可能是字符串
+type OpentsdbPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     json.Number       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func StartOpentsdb(cfg OpentsdbSection) {
+	if cfg.Listen == "" {
+		return
+	}
+
+	l, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.Fatal("cannot listen ", cfg.Listen, err)
+		return
+	}
+	logger.Info("opentsdb listening ", cfg.Listen)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			logger.Warning("opentsdb listener accept error: ", err)
+			time.Sleep(time.Duration(100) * time.Millisecond)
+			continue
+		}
+		go handleOpentsdbConn(conn, cfg)
+	}
+}
+
+func handleOpentsdbConn(conn net.Conn, cfg OpentsdbSection) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "put":
+			item, err := ParseOpentsdbPut(fields[1:], cfg)
+			if err != nil {
+				stats.Counter.Set("opentsdb.parse.err", 1)
+				logger.Warningf("parse opentsdb line %q err:%v", line, err)
+				fmt.Fprintf(conn, "put: %v\n", err)
+				continue
+			}
+			Push([]*dataobj.MetricValue{item})
+		case "version":
+			fmt.Fprintf(conn, "nightingale transfer\n")
+		case "exit":
+			return
+		default:
+			stats.Counter.Set("opentsdb.parse.err", 1)
+			fmt.Fprintf(conn, "unknown command: %s\n", fields[0])
+		}
+	}
+}
+
+// ParseOpentsdbPut 解析 put <metric> <timestamp> <value> <tagk1=tagv1 ...> 中put之后的部分
+func ParseOpentsdbPut(fields []string, cfg OpentsdbSection) (*dataobj.MetricValue, error) {
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("not enough arguments (need least 4, got %d)", len(fields)+1)
+	}
+
+	ts, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %s", fields[1])
+	}
+
+	value, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %s", fields[2])
+	}
+
+	tags := make(map[string]string)
+	for _, kv := range fields[3:] {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("invalid tag: %s", kv)
+		}
+		tags[pair[0]] = pair[1]
+	}
+
+	return opentsdbItem(fields[0], ts, value, tags, cfg), nil
+}
+
+func ConvertOpentsdbPoint(p *OpentsdbPoint, cfg OpentsdbSection) (*dataobj.MetricValue, error) {
+	value, err := p.Value.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %s", p.Value)
+	}
+
+	tags := make(map[string]string, len(p.Tags))
+	for k, v := range p.Tags {
+		tags[k] = v
+	}
+	return opentsdbItem(p.Metric, p.Timestamp, value, tags, cfg), nil
+}
+
+func opentsdbItem(metric string, ts int64, value float64, tags map[string]string, cfg OpentsdbSection) *dataobj.MetricValue {
+	endpoint := tags[cfg.EndpointTag]
+	delete(tags, cfg.EndpointTag)
+
+	return &dataobj.MetricValue{
+		Metric:       metric,
+		Endpoint:     endpoint,
+		Timestamp:    normalizeTimestamp(ts),
+		Step:         int64(cfg.Step),
+		ValueUntyped: value,
+		CounterType:  dataobj.GAUGE,
+		TagsMap:      tags,
+	}
+}
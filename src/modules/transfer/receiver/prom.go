@@ -0,0 +1,67 @@
+package receiver
+
+import (
+	"math"
+	"net"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/prompb"
+)
+
+// PromSection prometheus remote_write的label映射
+// __name__作为metric，endpointLabel作为endpoint，其余label作为tags
+type PromSection struct {
+	EndpointLabel string   `yaml:"endpointLabel"`
+	StripPort     bool     `yaml:"stripPort"` // 去掉instance中的端口
+	DropLabels    []string `yaml:"dropLabels"`
+	Step          int      `yaml:"step"` // prometheus的采集周期，单位秒
+}
+
+func ConvertPromWrite(req *prompb.WriteRequest, cfg PromSection) []*dataobj.MetricValue {
+	drop := make(map[string]struct{}, len(cfg.DropLabels))
+	for _, l := range cfg.DropLabels {
+		drop[l] = struct{}{}
+	}
+
+	items := []*dataobj.MetricValue{}
+	for _, ts := range req.Timeseries {
+		var metric, endpoint string
+		tags := make(map[string]string)
+		for _, l := range ts.Labels {
+			switch {
+			case l.Name == "__name__":
+				metric = l.Value
+			case l.Name == cfg.EndpointLabel:
+				endpoint = l.Value
+			default:
+				if _, exists := drop[l.Name]; !exists && l.Value != "" {
+					tags[l.Name] = l.Value
+				}
+			}
+		}
+
+		if cfg.StripPort {
+			if host, _, err := net.SplitHostPort(endpoint); err == nil {
+				endpoint = host
+			}
+		}
+
+		for _, s := range ts.Samples {
+			// prometheus用NaN表示series已经失效
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			items = append(items, &dataobj.MetricValue{
+				Metric:       metric,
+				Endpoint:     endpoint,
+				Timestamp:    s.Timestamp / 1000,
+				Step:         int64(cfg.Step),
+				ValueUntyped: s.Value,
+				CounterType:  dataobj.GAUGE,
+				TagsMap:      tags,
+			})
+		}
+	}
+	return items
+}
@@ -0,0 +1,44 @@
+package receiver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/didi/nightingale/src/toolkits/prompb"
+)
+
+func TestConvertPromWrite(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			{
+				Labels: []*prompb.Label{
+					{Name: "__name__", Value: "node_filesystem_avail_bytes"},
+					{Name: "instance", Value: "10.0.0.1:9100"},
+					{Name: "job", Value: "node"},
+					{Name: "mountpoint", Value: "/data"},
+				},
+				Samples: []*prompb.Sample{
+					{Value: 1024, Timestamp: 1600000000123},
+					{Value: math.NaN(), Timestamp: 1600000015123},
+				},
+			},
+		},
+	}
+
+	cfg := PromSection{EndpointLabel: "instance", StripPort: true, DropLabels: []string{"job"}, Step: 15}
+	items := ConvertPromWrite(req, cfg)
+	if len(items) != 1 {
+		t.Fatalf("stale NaN sample should be skipped, got %d items", len(items))
+	}
+
+	item := items[0]
+	if item.Metric != "node_filesystem_avail_bytes" || item.Endpoint != "10.0.0.1" || item.Timestamp != 1600000000 || item.Step != 15 {
+		t.Fatalf("unexpected item %v", item)
+	}
+	if len(item.TagsMap) != 1 || item.TagsMap["mountpoint"] != "/data" {
+		t.Fatalf("unexpected tags %v", item.TagsMap)
+	}
+	if err := item.CheckValidity(); err != nil {
+		t.Fatal(err)
+	}
+}
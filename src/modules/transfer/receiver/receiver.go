@@ -0,0 +1,58 @@
+package receiver
+
+import (
+	"fmt"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/modules/transfer/backend"
+	"github.com/didi/nightingale/src/modules/transfer/relabel"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// Push 校验之后发送给tsdb和judge，返回不合法的点的个数和原因
+func Push(recvMetricValues []*dataobj.MetricValue) (int, string) {
+	metricValues := []*dataobj.MetricValue{}
+
+	var msg string
+	var invalid int
+	for _, v := range recvMetricValues {
+		logger.Debug("->recv: ", v)
+		stats.Counter.Set("points.in", 1)
+
+		if !relabel.Apply(v) {
+			continue
+		}
+
+		err := v.CheckValidity()
+		if err != nil {
+			stats.Counter.Set("points.in.err", 1)
+			msg += fmt.Sprintf("recv metric %v err:%v\n", v, err)
+			logger.Warningf("recv metric %v err:%v", v, err)
+			invalid++
+			continue
+		}
+		metricValues = append(metricValues, v)
+	}
+
+	if backend.Config.Enabled {
+		backend.Push2TsdbSendQueue(metricValues)
+	}
+
+	if backend.Config.Enabled {
+		backend.Push2JudgeSendQueue(metricValues)
+	}
+
+	backend.Push2RemoteWriteQueue(metricValues)
+
+	return invalid, msg
+}
+
+// 毫秒和纳秒的时间戳统一转成秒
+func normalizeTimestamp(ts int64) int64 {
+	for ts > 1e11 {
+		ts /= 1000
+	}
+	return ts
+}
@@ -0,0 +1,182 @@
+package receiver
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	cfg := InfluxSection{EndpointTag: "host", Step: 10}
+	line := `cpu,host=host01,core=0\ 1 value=1.5,idle=98i,up=t,desc="a b" 1579000000000000000`
+
+	items, err := ParseInfluxLine(line, influxPrecisions["ns"], cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("expect 3 items, got %d", len(items))
+	}
+
+	expect := map[string]float64{"cpu": 1.5, "cpu.idle": 98, "cpu.up": 1}
+	for _, item := range items {
+		if item.Endpoint != "host01" || item.Timestamp != 1579000000 || item.Step != 10 {
+			t.Fatalf("unexpected item: %+v", item)
+		}
+		if item.TagsMap["core"] != "0 1" || len(item.TagsMap) != 1 {
+			t.Fatalf("unexpected tags: %v", item.TagsMap)
+		}
+		if v, exists := expect[item.Metric]; !exists || item.ValueUntyped.(float64) != v {
+			t.Fatalf("unexpected metric %s value %v", item.Metric, item.ValueUntyped)
+		}
+	}
+
+	if _, err := ParseInfluxLine("cpu value=abc", 1, cfg); err == nil {
+		t.Fatal("expect error for invalid value")
+	}
+
+	if _, errs := ParseInflux([]byte("cpu value=1\nbad\n"), "s", cfg); len(errs) != 1 {
+		t.Fatalf("expect 1 error, got %v", errs)
+	}
+}
+
+func TestParseOpentsdbPut(t *testing.T) {
+	cfg := OpentsdbSection{EndpointTag: "host", Step: 10}
+
+	item, err := ParseOpentsdbPut([]string{"sys.cpu.user", "1579000000000", "42.5", "host=web01", "cpu=0"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.Metric != "sys.cpu.user" || item.Endpoint != "web01" {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+	if item.Timestamp != 1579000000 || item.ValueUntyped.(float64) != 42.5 {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+	if len(item.TagsMap) != 1 || item.TagsMap["cpu"] != "0" {
+		t.Fatalf("unexpected tags: %v", item.TagsMap)
+	}
+
+	if _, err := ParseOpentsdbPut([]string{"sys.cpu.user", "1579000000"}, cfg); err == nil {
+		t.Fatal("expect error for missing value")
+	}
+}
+
+func TestParseGraphiteLine(t *testing.T) {
+	cfg := GraphiteSection{
+		Step: 10,
+		Templates: []GraphiteTemplate{
+			{Filter: "servers.*.cpu", Template: "_.endpoint.metric*", Tags: map[string]string{"source": "graphite"}},
+			{Filter: "apps", Template: "_.app.metric.metric"},
+		},
+	}
+
+	cases := []struct {
+		line     string
+		endpoint string
+		metric   string
+		tags     map[string]string
+	}{
+		{"servers.host01.cpu.idle 98.5 1579000000", "host01", "cpu.idle", map[string]string{"source": "graphite"}},
+		{"apps.order.req.count 3 1579000000", "10.0.0.1", "req.count", map[string]string{"app": "order"}},
+		{"other.metric;dc=bj 1 1579000000", "10.0.0.1", "other.metric", map[string]string{"dc": "bj"}},
+	}
+
+	for _, c := range cases {
+		item, err := ParseGraphiteLine(c.line, "10.0.0.1", cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", c.line, err)
+		}
+		if item.Endpoint != c.endpoint || item.Metric != c.metric || item.Timestamp != 1579000000 {
+			t.Fatalf("%s: unexpected item %+v", c.line, item)
+		}
+		if len(item.TagsMap) != len(c.tags) {
+			t.Fatalf("%s: unexpected tags %v", c.line, item.TagsMap)
+		}
+		for k, v := range c.tags {
+			if item.TagsMap[k] != v {
+				t.Fatalf("%s: unexpected tags %v", c.line, item.TagsMap)
+			}
+		}
+	}
+
+	if _, err := ParseGraphiteLine("a.b abc", "10.0.0.1", cfg); err == nil {
+		t.Fatal("expect error for invalid value")
+	}
+}
+
+func TestStatsdAggregator(t *testing.T) {
+	cfg := StatsdSection{EndpointTag: "host", Step: 10, Percentiles: []float64{50, 99}, GaugeExpire: 2}
+	agg := NewStatsdAggregator(cfg)
+
+	lines := []string{
+		"req:1|c|#host:web01,api:login",
+		"req:2|c|@0.5|#host:web01,api:login",
+		"conn:10|g|#host:web01",
+		"conn:-3|g|#host:web01",
+		"uid:a|s|#host:web01",
+		"uid:a|s|#host:web01",
+		"uid:b|s|#host:web01",
+	}
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("latency:%d|ms|#host:web01", i))
+	}
+
+	for _, line := range lines {
+		s, err := ParseStatsdLine(line, "10.0.0.1", cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		agg.Add(s)
+	}
+
+	expect := map[string]float64{
+		"req":           5,
+		"conn":          7,
+		"uid":           2,
+		"latency.count": 100,
+		"latency.min":   1,
+		"latency.max":   100,
+		"latency.mean":  50.5,
+		"latency.p50":   50,
+		"latency.p99":   99,
+	}
+
+	items := agg.Flush(1579000000)
+	if len(items) != len(expect) {
+		t.Fatalf("expect %d items, got %d", len(expect), len(items))
+	}
+	for _, item := range items {
+		if item.Endpoint != "web01" || item.Timestamp != 1579000000 {
+			t.Fatalf("unexpected item %+v", item)
+		}
+		if v, exists := expect[item.Metric]; !exists || item.ValueUntyped.(float64) != v {
+			t.Fatalf("unexpected metric %s value %v", item.Metric, item.ValueUntyped)
+		}
+	}
+
+	// gauge没有更新时不再发送，counter和timer每个step清空
+	if items := agg.Flush(1579000010); len(items) != 0 {
+		t.Fatalf("expect no items, got %d", len(items))
+	}
+
+	// 没有发送的gauge保留最后的值，+N和-N继续在这个值上计算
+	s, _ := ParseStatsdLine("conn:+3|g|#host:web01", "10.0.0.1", cfg)
+	agg.Add(s)
+	if items := agg.Flush(1579000020); len(items) != 1 || items[0].ValueUntyped.(float64) != 10 {
+		t.Fatalf("expect conn 10, got %v", items)
+	}
+
+	// 连续GaugeExpire个step没有更新的gauge被删除，之后的+N从0开始计算
+	agg.Flush(1579000030)
+	agg.Flush(1579000040)
+	agg.Add(s)
+	if items := agg.Flush(1579000050); len(items) != 1 || items[0].ValueUntyped.(float64) != 3 {
+		t.Fatalf("expect conn 3, got %v", items)
+	}
+
+	if _, err := ParseStatsdLine("req:1|x", "10.0.0.1", cfg); err == nil {
+		t.Fatal("expect error for unsupported type")
+	}
+}
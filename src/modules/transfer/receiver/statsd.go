@@ -0,0 +1,363 @@
+package receiver
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// StatsdSection listen非空时开启statsd的udp端口，每个step把聚合结果发送给tsdb和judge
+// tag使用dogstatsd的 |#k:v,k2:v2 格式，endpointTag对应的tag作为endpoint，没有时使用发送端的ip
+type StatsdSection struct {
+	Listen      string    `yaml:"listen"`
+	EndpointTag string    `yaml:"endpointTag"`
+	Step        int       `yaml:"step"`
+	Percentiles []float64 `yaml:"percentiles"`
+	GaugeExpire int       `yaml:"gaugeExpire"` // gauge连续多少个step没有更新之后不再保留
+}
+
+const (
+	statsdCounter = "c"
+	statsdGauge   = "g"
+	statsdTimer   = "ms"
+	statsdHisto   = "h"
+	statsdDistrib = "d"
+	statsdSet     = "s"
+)
+
+// statsd和graphite没有配置step时使用的默认值
+const defaultReceiverStep = 10
+
+// 没有配置gaugeExpire时使用的默认值
+const defaultGaugeExpire = 60
+
+type StatsdSample struct {
+	Metric   string
+	Endpoint string
+	Tags     map[string]string
+	Type     string
+	Value    float64
+	Raw      string // set类型按照原始字符串去重
+	Rate     float64
+	Relative bool // gauge的+N和-N
+}
+
+func StartStatsd(cfg StatsdSection) {
+	if cfg.Listen == "" {
+		return
+	}
+
+	if cfg.Step <= 0 {
+		logger.Warningf("statsd step %d is illegal, use %d", cfg.Step, defaultReceiverStep)
+		cfg.Step = defaultReceiverStep
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		logger.Fatal("cannot resolve ", cfg.Listen, err)
+		return
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		logger.Fatal("cannot listen ", cfg.Listen, err)
+		return
+	}
+	logger.Info("statsd listening ", cfg.Listen)
+
+	agg := NewStatsdAggregator(cfg)
+	go agg.loop()
+
+	buf := make([]byte, 65535)
+	for {
+		n, peer, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			logger.Warning("statsd read error: ", err)
+			continue
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+
+			sample, err := ParseStatsdLine(line, peer.IP.String(), cfg)
+			if err != nil {
+				stats.Counter.Set("statsd.parse.err", 1)
+				logger.Warningf("parse statsd line %q err:%v", line, err)
+				continue
+			}
+			agg.Add(sample)
+		}
+	}
+}
+
+// ParseStatsdLine 解析 <metric>:<value>|<type>[|@<rate>][|#k:v,...]
+func ParseStatsdLine(line, defaultEndpoint string, cfg StatsdSection) (*StatsdSample, error) {
+	idx := strings.LastIndex(line[:strings.IndexByte(line+"|", '|')], ":")
+	if idx <= 0 {
+		return nil, fmt.Errorf("missing metric name")
+	}
+
+	s := &StatsdSample{
+		Metric:   line[:idx],
+		Endpoint: defaultEndpoint,
+		Tags:     make(map[string]string),
+		Rate:     1,
+	}
+
+	fields := strings.Split(line[idx+1:], "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("missing metric type")
+	}
+
+	s.Type = fields[1]
+	switch s.Type {
+	case statsdCounter, statsdGauge, statsdTimer, statsdHisto, statsdDistrib:
+		raw := fields[0]
+		if s.Type == statsdGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+			s.Relative = true
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %s", raw)
+		}
+		s.Value = v
+	case statsdSet:
+		s.Raw = fields[0]
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", s.Type)
+	}
+
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			rate, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate: %s", f)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(f, "#"):
+			for _, kv := range strings.Split(f[1:], ",") {
+				pair := strings.SplitN(kv, ":", 2)
+				if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+					return nil, fmt.Errorf("invalid tag: %s", kv)
+				}
+				s.Tags[pair[0]] = pair[1]
+			}
+		}
+	}
+
+	if endpoint, exists := s.Tags[cfg.EndpointTag]; exists {
+		s.Endpoint = endpoint
+		delete(s.Tags, cfg.EndpointTag)
+	}
+
+	return s, nil
+}
+
+type statsdCounterValue struct {
+	sample *StatsdSample
+	value  float64
+}
+
+type statsdTimerValue struct {
+	sample *StatsdSample
+	values []float64
+	count  float64 // 按照采样率折算之后的个数
+}
+
+type statsdSetValue struct {
+	sample *StatsdSample
+	values map[string]struct{}
+}
+
+type statsdGaugeValue struct {
+	sample  *StatsdSample
+	value   float64
+	updated bool
+	idle    int // 连续没有更新的step个数
+}
+
+// StatsdAggregator 在内存中聚合一个step内收到的点
+// counter和timer每个step重新计算，gauge保留上一次的值用于+N和-N
+type StatsdAggregator struct {
+	sync.Mutex
+	cfg      StatsdSection
+	counters map[string]*statsdCounterValue
+	timers   map[string]*statsdTimerValue
+	sets     map[string]*statsdSetValue
+	gauges   map[string]*statsdGaugeValue
+}
+
+func NewStatsdAggregator(cfg StatsdSection) *StatsdAggregator {
+	return &StatsdAggregator{
+		cfg:      cfg,
+		counters: make(map[string]*statsdCounterValue),
+		timers:   make(map[string]*statsdTimerValue),
+		sets:     make(map[string]*statsdSetValue),
+		gauges:   make(map[string]*statsdGaugeValue),
+	}
+}
+
+func (this *StatsdAggregator) Add(s *StatsdSample) {
+	key := s.Endpoint + "/" + s.Metric + "/" + dataobj.SortedTags(s.Tags)
+
+	this.Lock()
+	defer this.Unlock()
+
+	switch s.Type {
+	case statsdCounter:
+		c, exists := this.counters[key]
+		if !exists {
+			c = &statsdCounterValue{sample: s}
+			this.counters[key] = c
+		}
+		c.value += s.Value / s.Rate
+	case statsdGauge:
+		g, exists := this.gauges[key]
+		if !exists {
+			g = &statsdGaugeValue{sample: s}
+			this.gauges[key] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.updated = true
+	case statsdTimer, statsdHisto, statsdDistrib:
+		t, exists := this.timers[key]
+		if !exists {
+			t = &statsdTimerValue{sample: s}
+			this.timers[key] = t
+		}
+		t.values = append(t.values, s.Value)
+		t.count += 1 / s.Rate
+	case statsdSet:
+		st, exists := this.sets[key]
+		if !exists {
+			st = &statsdSetValue{sample: s, values: make(map[string]struct{})}
+			this.sets[key] = st
+		}
+		st.values[s.Raw] = struct{}{}
+	}
+}
+
+func (this *StatsdAggregator) loop() {
+	t := time.NewTicker(time.Duration(this.cfg.Step) * time.Second)
+	for now := range t.C {
+		items := this.Flush(now.Unix())
+		if len(items) > 0 {
+			Push(items)
+		}
+	}
+}
+
+// Flush 返回一个step的聚合结果并清空
+// 这个step内没有更新的gauge不再发送，但是保留最后的值，之后收到的+N和-N在这个值上计算
+// 连续GaugeExpire个step没有更新的gauge删除，之后的+N和-N从0开始计算
+func (this *StatsdAggregator) Flush(ts int64) []*dataobj.MetricValue {
+	this.Lock()
+	counters, timers, sets := this.counters, this.timers, this.sets
+	this.counters = make(map[string]*statsdCounterValue)
+	this.timers = make(map[string]*statsdTimerValue)
+	this.sets = make(map[string]*statsdSetValue)
+
+	expire := this.cfg.GaugeExpire
+	if expire <= 0 {
+		expire = defaultGaugeExpire
+	}
+
+	gauges := make([]*statsdGaugeValue, 0, len(this.gauges))
+	for key, g := range this.gauges {
+		if !g.updated {
+			g.idle++
+			if g.idle >= expire {
+				delete(this.gauges, key)
+			}
+			continue
+		}
+		gauges = append(gauges, &statsdGaugeValue{sample: g.sample, value: g.value})
+		g.updated = false
+		g.idle = 0
+	}
+	this.Unlock()
+
+	items := []*dataobj.MetricValue{}
+	for _, c := range counters {
+		items = append(items, this.item(c.sample, "", ts, c.value))
+	}
+
+	for _, g := range gauges {
+		items = append(items, this.item(g.sample, "", ts, g.value))
+	}
+
+	for _, st := range sets {
+		items = append(items, this.item(st.sample, "", ts, float64(len(st.values))))
+	}
+
+	for _, t := range timers {
+		vs := t.values
+		sort.Float64s(vs)
+
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+
+		items = append(items,
+			this.item(t.sample, ".count", ts, t.count),
+			this.item(t.sample, ".min", ts, vs[0]),
+			this.item(t.sample, ".max", ts, vs[len(vs)-1]),
+			this.item(t.sample, ".mean", ts, sum/float64(len(vs))),
+		)
+
+		for _, p := range this.cfg.Percentiles {
+			suffix := ".p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", -1)
+			items = append(items, this.item(t.sample, suffix, ts, statsdPercentile(vs, p)))
+		}
+	}
+
+	return items
+}
+
+func (this *StatsdAggregator) item(s *StatsdSample, suffix string, ts int64, value float64) *dataobj.MetricValue {
+	tags := make(map[string]string, len(s.Tags))
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+
+	return &dataobj.MetricValue{
+		Metric:       s.Metric + suffix,
+		Endpoint:     s.Endpoint,
+		Timestamp:    ts,
+		Step:         int64(this.cfg.Step),
+		ValueUntyped: value,
+		CounterType:  dataobj.GAUGE,
+		TagsMap:      tags,
+	}
+}
+
+// statsdPercentile 最近秩方法，vs已经升序排列
+func statsdPercentile(vs []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(vs))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(vs) {
+		rank = len(vs)
+	}
+	return vs[rank-1]
+}
@@ -0,0 +1,195 @@
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+const (
+	ActionDrop     = "drop"     // 丢弃整个点
+	ActionRename   = "rename"   // metric按照正则替换为replacement，支持$1
+	ActionDropTags = "droptags" // 去掉tags中列出的tag
+	ActionAddTags  = "addtags"  // 增加addTags中的tag，已有的tag会被覆盖
+)
+
+// Rule metric和endpoint都是正则，为空时匹配所有，两个都匹配时才执行action
+type Rule struct {
+	Name        string            `yaml:"name"`
+	Action      string            `yaml:"action"`
+	Metric      string            `yaml:"metric"`
+	Endpoint    string            `yaml:"endpoint"`
+	Replacement string            `yaml:"replacement"`
+	Tags        []string          `yaml:"tags"`
+	AddTags     map[string]string `yaml:"addTags"`
+}
+
+type rule struct {
+	Rule
+	metricRe   *regexp.Regexp
+	endpointRe *regexp.Regexp
+	tags       map[string]struct{}
+}
+
+// Pipeline 按照配置的顺序执行，一个点被drop之后不再执行后面的规则
+type Pipeline struct {
+	rules []*rule
+}
+
+func Compile(rules []Rule) (*Pipeline, error) {
+	p := &Pipeline{rules: make([]*rule, 0, len(rules))}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule%d", i)
+		}
+
+		cr := &rule{Rule: r}
+		switch r.Action {
+		case ActionDrop:
+		case ActionRename:
+			if r.Metric == "" || r.Replacement == "" {
+				return nil, fmt.Errorf("relabel %s: rename need metric and replacement", r.Name)
+			}
+		case ActionDropTags:
+			if len(r.Tags) == 0 {
+				return nil, fmt.Errorf("relabel %s: droptags need tags", r.Name)
+			}
+			cr.tags = make(map[string]struct{}, len(r.Tags))
+			for _, t := range r.Tags {
+				cr.tags[t] = struct{}{}
+			}
+		case ActionAddTags:
+			if len(r.AddTags) == 0 {
+				return nil, fmt.Errorf("relabel %s: addtags need addTags", r.Name)
+			}
+		default:
+			return nil, fmt.Errorf("relabel %s: unknown action %q", r.Name, r.Action)
+		}
+
+		var err error
+		if r.Metric != "" {
+			if cr.metricRe, err = regexp.Compile(r.Metric); err != nil {
+				return nil, fmt.Errorf("relabel %s: bad metric regexp: %v", r.Name, err)
+			}
+		}
+		if r.Endpoint != "" {
+			if cr.endpointRe, err = regexp.Compile(r.Endpoint); err != nil {
+				return nil, fmt.Errorf("relabel %s: bad endpoint regexp: %v", r.Name, err)
+			}
+		}
+
+		p.rules = append(p.rules, cr)
+	}
+	return p, nil
+}
+
+// Apply 返回false表示这个点需要丢弃
+func (p *Pipeline) Apply(m *dataobj.MetricValue) bool {
+	if p == nil || len(p.rules) == 0 || m == nil {
+		return true
+	}
+
+	tagsParsed := false
+	for _, r := range p.rules {
+		if r.metricRe != nil && !r.metricRe.MatchString(m.Metric) {
+			continue
+		}
+		if r.endpointRe != nil && !r.endpointRe.MatchString(m.Endpoint) {
+			continue
+		}
+
+		switch r.Action {
+		case ActionDrop:
+			stats.Counter.Set("relabel."+r.Name+".drop", 1)
+			return false
+		case ActionRename:
+			metric := r.metricRe.ReplaceAllString(m.Metric, r.Replacement)
+			if metric == m.Metric {
+				continue
+			}
+			m.Metric = metric
+		case ActionDropTags, ActionAddTags:
+			if !tagsParsed {
+				if !parseTags(m) {
+					// tags格式错误，留给CheckValidity处理
+					return true
+				}
+				tagsParsed = true
+			}
+			if !r.rewriteTags(m) {
+				continue
+			}
+		}
+		stats.Counter.Set("relabel."+r.Name+".rewrite", 1)
+	}
+
+	if tagsParsed {
+		// CheckValidity在TagsMap为空时会重新解析Tags
+		m.Tags = dataobj.SortedTags(m.TagsMap)
+	}
+	return true
+}
+
+func (r *rule) rewriteTags(m *dataobj.MetricValue) bool {
+	changed := false
+	if r.Action == ActionDropTags {
+		for k := range m.TagsMap {
+			if _, exists := r.tags[k]; exists {
+				delete(m.TagsMap, k)
+				changed = true
+			}
+		}
+		return changed
+	}
+
+	for k, v := range r.AddTags {
+		if m.TagsMap[k] != v {
+			m.TagsMap[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// 上报的点可能只填了Tags字符串，统一转成TagsMap再修改
+func parseTags(m *dataobj.MetricValue) bool {
+	if len(m.TagsMap) > 0 {
+		// 可能多个点共用一个map，修改之前复制一份
+		tags := make(map[string]string, len(m.TagsMap))
+		for k, v := range m.TagsMap {
+			tags[k] = v
+		}
+		m.TagsMap = tags
+		return true
+	}
+
+	tags, err := dataobj.SplitTagsString(m.Tags)
+	if err != nil {
+		return false
+	}
+	m.TagsMap = tags
+	return true
+}
+
+var (
+	lock     sync.RWMutex
+	pipeline *Pipeline
+)
+
+// Set 替换当前生效的规则
+func Set(p *Pipeline) {
+	lock.Lock()
+	pipeline = p
+	lock.Unlock()
+}
+
+// Apply 使用当前生效的规则处理一个点，返回false表示需要丢弃
+func Apply(m *dataobj.MetricValue) bool {
+	lock.RLock()
+	p := pipeline
+	lock.RUnlock()
+	return p.Apply(m)
+}
@@ -0,0 +1,48 @@
+package relabel
+
+import (
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+	"github.com/didi/nightingale/src/toolkits/stats"
+)
+
+func TestPipeline(t *testing.T) {
+	stats.Counter = stats.NewCounter("test")
+
+	p, err := Compile([]Rule{
+		{Name: "drop_debug", Action: ActionDrop, Metric: `^debug\.`},
+		{Name: "rename_nginx", Action: ActionRename, Metric: `^nginx_(.*)$`, Replacement: "nginx.$1"},
+		{Name: "drop_request_id", Action: ActionDropTags, Tags: []string{"request_id"}},
+		{Name: "idc_bj", Action: ActionAddTags, Endpoint: `^bj-`, AddTags: map[string]string{"idc": "bj"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Apply(&dataobj.MetricValue{Metric: "debug.x", Endpoint: "bj-01"}) {
+		t.Fatal("expect debug metric dropped")
+	}
+
+	m := &dataobj.MetricValue{Metric: "nginx_requests", Endpoint: "bj-01", Tags: "request_id=abc,code=200"}
+	if !p.Apply(m) {
+		t.Fatal("expect item kept")
+	}
+	if m.Metric != "nginx.requests" {
+		t.Fatalf("unexpected metric %s", m.Metric)
+	}
+	if m.Tags != "code=200,idc=bj" || len(m.TagsMap) != 2 {
+		t.Fatalf("unexpected tags %s %v", m.Tags, m.TagsMap)
+	}
+
+	counters := stats.Counter.Dump()
+	for _, key := range []string{"test.relabel.drop_debug.drop", "test.relabel.rename_nginx.rewrite", "test.relabel.drop_request_id.rewrite", "test.relabel.idc_bj.rewrite"} {
+		if counters[key] != 1 {
+			t.Fatalf("expect %s = 1, got %v", key, counters)
+		}
+	}
+
+	if _, err := Compile([]Rule{{Action: ActionRename, Metric: "^a"}}); err == nil {
+		t.Fatal("expect error for rename without replacement")
+	}
+}
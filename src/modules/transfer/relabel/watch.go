@@ -0,0 +1,73 @@
+package relabel
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/toolkits/pkg/file"
+	"github.com/toolkits/pkg/logger"
+)
+
+// Init 使用启动时解析的规则，规则有错误时不启动
+func Init(rules []Rule) error {
+	p, err := Compile(rules)
+	if err != nil {
+		return err
+	}
+	Set(p)
+	return nil
+}
+
+// Watch 配置文件修改之后重新加载relabel规则，新规则有错误时继续使用旧的规则
+func Watch(conf string, interval int) {
+	if interval <= 0 {
+		interval = 10
+	}
+
+	var mtime int64
+	if fi, err := os.Stat(conf); err == nil {
+		mtime = fi.ModTime().Unix()
+	}
+
+	t := time.NewTicker(time.Duration(interval) * time.Second)
+	for {
+		<-t.C
+		fi, err := os.Stat(conf)
+		if err != nil {
+			logger.Warningf("stat %s err:%v", conf, err)
+			continue
+		}
+		if fi.ModTime().Unix() == mtime {
+			continue
+		}
+		mtime = fi.ModTime().Unix()
+
+		if err := reload(conf); err != nil {
+			logger.Errorf("reload relabel rules from %s err:%v", conf, err)
+			continue
+		}
+		logger.Infof("relabel rules reloaded from %s", conf)
+	}
+}
+
+func reload(conf string) error {
+	bs, err := file.ReadBytes(conf)
+	if err != nil {
+		return err
+	}
+
+	// 使用单独的viper实例，不影响启动时解析的配置
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewBuffer(bs)); err != nil {
+		return err
+	}
+
+	var rules []Rule
+	if err := v.UnmarshalKey("relabel", &rules); err != nil {
+		return err
+	}
+	return Init(rules)
+}
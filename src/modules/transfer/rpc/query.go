@@ -7,6 +7,9 @@ import (
 
 func (this *Transfer) Query(args []dataobj.QueryData, reply *dataobj.QueryDataResp) error {
 	//start := time.Now()
-	reply.Data = backend.FetchData(args)
+	l := backend.NewRPCQueryLimiter()
+	reply.Data = l.FetchData(args)
+	reply.Partial = l.Stat.Partial
+	reply.Limits = l.Stat.Limits
 	return nil
 }
@@ -11,6 +11,8 @@ import (
 	"github.com/didi/nightingale/src/modules/transfer/config"
 	"github.com/didi/nightingale/src/modules/transfer/cron"
 	"github.com/didi/nightingale/src/modules/transfer/http/routes"
+	"github.com/didi/nightingale/src/modules/transfer/receiver"
+	"github.com/didi/nightingale/src/modules/transfer/relabel"
 	"github.com/didi/nightingale/src/modules/transfer/rpc"
 	"github.com/didi/nightingale/src/toolkits/http"
 	tlogger "github.com/didi/nightingale/src/toolkits/logger"
@@ -57,10 +59,19 @@ func main() {
 	tlogger.Init(cfg.Logger)
 	go stats.Init("n9e.transfer")
 
+	if err := relabel.Init(cfg.Relabel); err != nil {
+		fmt.Println("cannot init relabel rules:", err)
+		os.Exit(1)
+	}
+	go relabel.Watch(*conf, 10)
+
 	backend.Init(cfg.Backend)
 	cron.Init()
 
 	go rpc.Start()
+	go receiver.StartOpentsdb(cfg.Opentsdb)
+	go receiver.StartGraphite(cfg.Graphite)
+	go receiver.StartStatsd(cfg.Statsd)
 
 	r := gin.New()
 	routes.Config(r)
@@ -105,8 +116,10 @@ func ending() {
 		fmt.Printf("stop signal caught, stopping... pid=%d\n", os.Getpid())
 	}
 
-	logger.Close()
 	http.Shutdown()
+	backend.StopSendTasks()
+	backend.CloseSpool()
+	logger.Close()
 	fmt.Println("sender stopped successfully")
 }
 
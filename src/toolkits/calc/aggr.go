@@ -0,0 +1,145 @@
+package calc
+
+import (
+	"math"
+	"sort"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+// 每个时间点上对多条曲线的值进行计算，传入的值不包含NaN，至少有一个
+var (
+	validFuncName = map[string]func([]float64) float64{
+		"sum":    sum,
+		"avg":    avg,
+		"max":    max,
+		"min":    min,
+		"count":  count,
+		"p50":    percentile(50),
+		"p90":    percentile(90),
+		"p99":    percentile(99),
+		"stddev": stddev,
+		"spread": spread,
+	}
+)
+
+// ValidFunc 判断是否是支持的聚合函数
+func ValidFunc(f string) bool {
+	_, exists := validFuncName[f]
+	return exists
+}
+
+func Compute(f string, datas []*dataobj.TsdbQueryResponse) []*dataobj.RRDData {
+	datasLen := len(datas)
+	if datasLen < 1 {
+		return nil
+	}
+
+	fn, exists := validFuncName[f]
+	if !exists {
+		return nil
+	}
+
+	var tmpValues dataobj.RRDValues
+	for ts, values := range Collect(datas) {
+		d := &dataobj.RRDData{
+			Timestamp: ts,
+			Value:     dataobj.JsonFloat(fn(values)),
+		}
+		tmpValues = append(tmpValues, d)
+	}
+	sort.Sort(tmpValues)
+	return tmpValues
+}
+
+// Collect 按照时间戳收集所有曲线的值，跳过NaN
+// 时间戳按照曲线的step对齐，不同机器上报时间不一致时也能落在同一个点上
+func Collect(datas []*dataobj.TsdbQueryResponse) map[int64][]float64 {
+	dataMap := make(map[int64][]float64)
+	for _, data := range datas {
+		if data == nil {
+			continue
+		}
+		step := int64(data.Step)
+		for _, v := range data.Values {
+			if math.IsNaN(float64(v.Value)) {
+				continue
+			}
+			ts := v.Timestamp
+			if step > 0 {
+				ts = ts - ts%step
+			}
+			dataMap[ts] = append(dataMap[ts], float64(v.Value))
+		}
+	}
+	return dataMap
+}
+
+func sum(values []float64) float64 {
+	s := 0.0
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+func avg(values []float64) float64 {
+	a := 0.0
+	for i, v := range values {
+		a += (v - a) / float64(i+1)
+	}
+	return a
+}
+
+func max(values []float64) float64 {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+func min(values []float64) float64 {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func count(values []float64) float64 {
+	return float64(len(values))
+}
+
+// percentile 使用nearest-rank，结果一定是其中一条曲线的值
+func percentile(p float64) func([]float64) float64 {
+	return func(values []float64) float64 {
+		sorted := make([]float64, len(values))
+		copy(sorted, values)
+		sort.Float64s(sorted)
+
+		idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return sorted[idx]
+	}
+}
+
+// stddev 总体标准差
+func stddev(values []float64) float64 {
+	mean := avg(values)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+func spread(values []float64) float64 {
+	return max(values) - min(values)
+}
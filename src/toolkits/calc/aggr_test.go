@@ -0,0 +1,86 @@
+package calc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/didi/nightingale/src/dataobj"
+)
+
+var nan = math.NaN()
+
+// points ts, value, ts, value ...
+func newResp(step int, points ...float64) *dataobj.TsdbQueryResponse {
+	d := &dataobj.TsdbQueryResponse{Step: step}
+	for i := 0; i+1 < len(points); i += 2 {
+		d.Values = append(d.Values, dataobj.NewRRDData(int64(points[i]), points[i+1]))
+	}
+	return d
+}
+
+func TestCompute(t *testing.T) {
+	aligned := []*dataobj.TsdbQueryResponse{
+		newResp(10, 100, 1, 110, 4),
+		newResp(10, 100, 2, 110, nan),
+		newResp(10, 100, 3, 110, 6),
+		newResp(10, 100, 10, 110, nan),
+	}
+	// 同样step的曲线，上报时间不一致
+	misaligned := []*dataobj.TsdbQueryResponse{
+		newResp(10, 100, 1, 110, 2),
+		newResp(10, 103, 3, 113, 4),
+		newResp(10, 109, 5, 121, 6),
+	}
+	allNaN := []*dataobj.TsdbQueryResponse{
+		newResp(10, 100, nan),
+		newResp(10, 100, nan),
+	}
+
+	cases := []struct {
+		f     string
+		datas []*dataobj.TsdbQueryResponse
+		want  []float64 // ts, value, ts, value ...
+	}{
+		{"sum", aligned, []float64{100, 16, 110, 10}},
+		{"avg", aligned, []float64{100, 4, 110, 5}},
+		{"max", aligned, []float64{100, 10, 110, 6}},
+		{"min", aligned, []float64{100, 1, 110, 4}},
+		{"count", aligned, []float64{100, 4, 110, 2}},
+		{"p50", aligned, []float64{100, 2, 110, 4}},
+		{"p90", aligned, []float64{100, 10, 110, 6}},
+		{"p99", aligned, []float64{100, 10, 110, 6}},
+		{"stddev", aligned, []float64{100, math.Sqrt(12.5), 110, 1}},
+		{"spread", aligned, []float64{100, 9, 110, 2}},
+
+		{"sum", misaligned, []float64{100, 9, 110, 6, 120, 6}},
+		{"count", misaligned, []float64{100, 3, 110, 2, 120, 1}},
+		{"p50", misaligned, []float64{100, 3, 110, 2, 120, 6}},
+		{"spread", misaligned, []float64{100, 4, 110, 2, 120, 0}},
+
+		{"count", allNaN, []float64{}},
+		{"p99", allNaN, []float64{}},
+	}
+
+	for _, c := range cases {
+		got := Compute(c.f, c.datas)
+		if len(got)*2 != len(c.want) {
+			t.Errorf("%s: got %d points, want %d", c.f, len(got), len(c.want)/2)
+			continue
+		}
+		for i, p := range got {
+			ts, v := int64(c.want[i*2]), c.want[i*2+1]
+			if p.Timestamp != ts || math.Abs(float64(p.Value)-v) > 1e-9 {
+				t.Errorf("%s: point %d got %d:%v, want %d:%v", c.f, i, p.Timestamp, p.Value, ts, v)
+			}
+		}
+	}
+}
+
+func TestComputeInvalid(t *testing.T) {
+	if Compute("p75", []*dataobj.TsdbQueryResponse{newResp(10, 100, 1)}) != nil {
+		t.Error("unknown func should return nil")
+	}
+	if Compute("sum", nil) != nil {
+		t.Error("empty datas should return nil")
+	}
+}
@@ -0,0 +1,34 @@
+package prompb
+
+// MetricName nightingale的metric中可能有.等字符，转换成prometheus合法的metric名
+// 合法的字符为 [a-zA-Z0-9_:]，不能以数字开头
+func MetricName(s string) string {
+	return sanitize(s, true)
+}
+
+// LabelName 合法的字符为 [a-zA-Z0-9_]，不能以数字开头
+func LabelName(s string) string {
+	return sanitize(s, false)
+}
+
+func sanitize(s string, colon bool) string {
+	if s == "" {
+		return "_"
+	}
+
+	bs := []byte(s)
+	for i, b := range bs {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b == '_':
+		case b >= '0' && b <= '9':
+		case b == ':' && colon:
+		default:
+			bs[i] = '_'
+		}
+	}
+
+	if s[0] >= '0' && s[0] <= '9' {
+		return "_" + string(bs)
+	}
+	return string(bs)
+}
@@ -0,0 +1,278 @@
+package redispool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/toolkits/pkg/logger"
+)
+
+const (
+	clusterSlots = 16384
+	maxRedirects = 5
+)
+
+// clusterClient 根据CLUSTER SLOTS缓存slot所在的节点，收到MOVED/ASK时按照redis的约定重定向
+type clusterClient struct {
+	sync.RWMutex
+	opts  Options
+	slots [clusterSlots]string
+	pools map[string]*redis.Pool
+}
+
+func newCluster(opts Options) *clusterClient {
+	c := &clusterClient{opts: opts, pools: make(map[string]*redis.Pool)}
+	if err := c.refresh(); err != nil {
+		logger.Errorf("get redis cluster slots err:%v", err)
+	}
+	return c
+}
+
+// refresh 先问已知的节点，再问配置的种子节点，拿到一份slot分布即可
+func (c *clusterClient) refresh() error {
+	c.RLock()
+	addrs := make([]string, 0, len(c.pools)+len(c.opts.Addrs))
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.RUnlock()
+	addrs = append(addrs, c.opts.Addrs...)
+
+	var err error
+	for _, addr := range addrs {
+		var reply []interface{}
+		reply, err = redis.Values(doOn(c.getPool(addr), "CLUSTER", "SLOTS"))
+		if err != nil {
+			continue
+		}
+
+		var slots [clusterSlots]string
+		if slots, err = parseSlots(reply); err != nil {
+			continue
+		}
+
+		c.Lock()
+		c.slots = slots
+		c.Unlock()
+		return nil
+	}
+	return fmt.Errorf("cannot get cluster slots, last err:%v", err)
+}
+
+// CLUSTER SLOTS 的每一项是 [start, end, [ip, port, ...], 副本...]，只用master
+func parseSlots(reply []interface{}) ([clusterSlots]string, error) {
+	var slots [clusterSlots]string
+	for _, r := range reply {
+		item, err := redis.Values(r, nil)
+		if err != nil || len(item) < 3 {
+			return slots, fmt.Errorf("illegal cluster slots item: %v", r)
+		}
+
+		start, err1 := redis.Int(item[0], nil)
+		end, err2 := redis.Int(item[1], nil)
+		node, err3 := redis.Values(item[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(node) < 2 {
+			return slots, fmt.Errorf("illegal cluster slots item: %v", r)
+		}
+
+		host, _ := redis.String(node[0], nil)
+		port, _ := redis.Int(node[1], nil)
+		addr := hostPort(host, port)
+		for s := start; s <= end && s < clusterSlots; s++ {
+			slots[s] = addr
+		}
+	}
+	return slots, nil
+}
+
+func (c *clusterClient) getPool(addr string) *redis.Pool {
+	c.RLock()
+	pool, exists := c.pools[addr]
+	c.RUnlock()
+	if exists {
+		return pool
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if pool, exists = c.pools[addr]; !exists {
+		pool = newPool(addr, c.opts, nil)
+		c.pools[addr] = pool
+	}
+	return pool
+}
+
+func (c *clusterClient) addrOf(slot int) string {
+	c.RLock()
+	addr := c.slots[slot]
+	c.RUnlock()
+	if addr != "" {
+		return addr
+	}
+
+	if err := c.refresh(); err != nil {
+		logger.Errorf("refresh redis cluster slots err:%v", err)
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+	if c.slots[slot] != "" {
+		return c.slots[slot]
+	}
+	// 没有slot信息时随便找一个节点，由MOVED重定向
+	return c.opts.Addrs[0]
+}
+
+func (c *clusterClient) Do(cmd string, args ...interface{}) (interface{}, error) {
+	slot := 0
+	if len(args) > 0 {
+		slot = keySlot(fmt.Sprint(args[0]))
+	}
+
+	addr := c.addrOf(slot)
+	asking := false
+	refreshed := false
+	for i := 0; i < maxRedirects; i++ {
+		reply, err := c.doOn(addr, asking, cmd, args...)
+		if err == nil {
+			return reply, nil
+		}
+
+		e, ok := err.(redis.Error)
+		if !ok {
+			// 节点挂掉之后slot会迁移到其他节点，刷新一次再试
+			if refreshed {
+				return reply, err
+			}
+			refreshed = true
+			if rerr := c.refresh(); rerr != nil {
+				return reply, err
+			}
+			addr = c.addrOf(slot)
+			continue
+		}
+
+		msg := string(e)
+		switch {
+		case strings.HasPrefix(msg, "MOVED "):
+			s, to, perr := parseRedirect(msg)
+			if perr != nil {
+				return reply, err
+			}
+			c.Lock()
+			c.slots[s] = to
+			c.Unlock()
+			addr, asking = to, false
+		case strings.HasPrefix(msg, "ASK "):
+			_, to, perr := parseRedirect(msg)
+			if perr != nil {
+				return reply, err
+			}
+			addr, asking = to, true
+		default:
+			return reply, err
+		}
+	}
+	return nil, fmt.Errorf("too many cluster redirects, cmd:%s", cmd)
+}
+
+func (c *clusterClient) doOn(addr string, asking bool, cmd string, args ...interface{}) (interface{}, error) {
+	rc := c.getPool(addr).Get()
+	defer rc.Close()
+
+	if asking {
+		if _, err := rc.Do("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return rc.Do(cmd, args...)
+}
+
+// BRPop keys在同一个slot时直接BRPOP，否则按顺序RPOP轮询，保证高优先级的队列先被消费
+func (c *clusterClient) BRPop(timeout int, keys ...string) (string, string, error) {
+	if len(keys) == 0 {
+		return "", "", fmt.Errorf("brpop keys is blank")
+	}
+
+	sameSlot := true
+	for _, key := range keys[1:] {
+		if keySlot(key) != keySlot(keys[0]) {
+			sameSlot = false
+			break
+		}
+	}
+	if sameSlot {
+		return parseBRPop(c.Do("BRPOP", brpopArgs(timeout, keys)...))
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		for _, key := range keys {
+			val, err := redis.String(c.Do("RPOP", key))
+			if err == redis.ErrNil {
+				continue
+			}
+			if err != nil {
+				return "", "", err
+			}
+			return key, val, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", "", redis.ErrNil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (c *clusterClient) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	for _, pool := range c.pools {
+		pool.Close()
+	}
+	return nil
+}
+
+// MOVED 3999 127.0.0.1:6381
+func parseRedirect(msg string) (int, string, error) {
+	fields := strings.Fields(msg)
+	if len(fields) != 3 {
+		return 0, "", fmt.Errorf("illegal redirect: %s", msg)
+	}
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 || slot >= clusterSlots {
+		return 0, "", fmt.Errorf("illegal redirect: %s", msg)
+	}
+	return slot, fields[2], nil
+}
+
+// keySlot 和redis cluster一致，有{hashtag}时只对hashtag计算crc16
+func keySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// CRC16/XMODEM
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
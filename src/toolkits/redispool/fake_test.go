@@ -0,0 +1,202 @@
+package redispool
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 测试用的进程内redis，只实现了用到的命令
+type status string
+type fakeErr string
+
+type fakeRedis struct {
+	sync.Mutex
+	ln    net.Listener
+	kv    map[string]string
+	lists map[string][]string
+
+	role   string
+	master [2]string      // sentinel: get-master-addr-by-name 的返回
+	owned  func(int) bool // cluster: 返回false时回复MOVED到movedTo
+	slots  []interface{}  // cluster: CLUSTER SLOTS 的返回
+	moveTo string
+}
+
+func newFakeRedis() *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	f := &fakeRedis{ln: ln, kv: map[string]string{}, lists: map[string][]string{}, role: "master"}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) Addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeRedis) Close() {
+	f.ln.Close()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, f.handle(args))
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) handle(args []string) interface{} {
+	f.Lock()
+	defer f.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "PING":
+		return status("PONG")
+	case "AUTH", "ASKING":
+		return status("OK")
+	case "ROLE":
+		return []interface{}{f.role, int64(0), []interface{}{}}
+	case "SENTINEL":
+		return []interface{}{f.master[0], f.master[1]}
+	case "CLUSTER":
+		return f.slots
+	}
+
+	if len(args) < 2 {
+		return fakeErr("ERR wrong number of arguments")
+	}
+	if f.owned != nil && !f.owned(keySlot(args[1])) {
+		return fakeErr(fmt.Sprintf("MOVED %d %s", keySlot(args[1]), f.moveTo))
+	}
+	if f.role != "master" && (cmd == "SET" || cmd == "RPUSH" || cmd == "LPUSH" || cmd == "DEL") {
+		return fakeErr("READONLY You can't write against a read only replica.")
+	}
+
+	switch cmd {
+	case "GET":
+		if v, exists := f.kv[args[1]]; exists {
+			return v
+		}
+		return nil
+	case "SET":
+		f.kv[args[1]] = args[2]
+		return status("OK")
+	case "DEL":
+		delete(f.kv, args[1])
+		return int64(1)
+	case "RPUSH":
+		f.lists[args[1]] = append(f.lists[args[1]], args[2:]...)
+		return int64(len(f.lists[args[1]]))
+	case "LPUSH":
+		for _, v := range args[2:] {
+			f.lists[args[1]] = append([]string{v}, f.lists[args[1]]...)
+		}
+		return int64(len(f.lists[args[1]]))
+	case "RPOP":
+		return f.rpop(args[1])
+	case "BRPOP":
+		// 不真正阻塞，所有队列为空时直接返回nil
+		for _, key := range args[1 : len(args)-1] {
+			if v := f.rpop(key); v != nil {
+				return []interface{}{key, v}
+			}
+		}
+		return nil
+	}
+	return fakeErr("ERR unknown command " + cmd)
+}
+
+func (f *fakeRedis) rpop(key string) interface{} {
+	l := f.lists[key]
+	if len(l) == 0 {
+		return nil
+	}
+	f.lists[key] = l[:len(l)-1]
+	return l[len(l)-1]
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, v interface{}) {
+	switch t := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case status:
+		w.WriteString("+" + string(t) + "\r\n")
+	case fakeErr:
+		w.WriteString("-" + string(t) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(t, 10) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(t)) + "\r\n" + t + "\r\n")
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(t)) + "\r\n")
+		for _, item := range t {
+			writeReply(w, item)
+		}
+	}
+}
+
+// 生成CLUSTER SLOTS中的一项
+func slotsItem(start, end int, addr string) []interface{} {
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.ParseInt(port, 10, 64)
+	return []interface{}{int64(start), int64(end), []interface{}{host, p}}
+}
@@ -0,0 +1,148 @@
+package redispool
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/toolkits/pkg/logger"
+)
+
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Options 三种模式下Addrs的含义不同
+// standalone: redis地址，按顺序尝试，前面的连不上再用后面的
+// sentinel:   sentinel地址，通过MasterName发现master
+// cluster:    集群中的任意几个节点，用来获取slot分布
+type Options struct {
+	Mode         string
+	Addrs        []string
+	MasterName   string
+	Pass         string
+	Idle         int
+	ConnTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+type Client interface {
+	// Do cluster模式下按照第一个参数计算slot，命令只能操作一个key
+	Do(cmd string, args ...interface{}) (interface{}, error)
+	// BRPop 按照keys的顺序返回第一个非空队列弹出的数据，超时返回redis.ErrNil
+	BRPop(timeout int, keys ...string) (string, string, error)
+	Close() error
+}
+
+func New(opts Options) (Client, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, fmt.Errorf("redis addrs is blank")
+	}
+
+	switch opts.Mode {
+	case "", ModeStandalone:
+		return newStandalone(opts), nil
+	case ModeSentinel:
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("redis masterName is blank in sentinel mode")
+		}
+		return newSentinel(opts), nil
+	case ModeCluster:
+		return newCluster(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode: %s", opts.Mode)
+	}
+}
+
+func newPool(addr string, opts Options, check func(redis.Conn) error) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     opts.Idle,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			c, err := dial(addr, opts)
+			if err != nil {
+				logger.Errorf("conn redis %s err:%v", addr, err)
+				return nil, err
+			}
+
+			if opts.Pass != "" {
+				if _, err := c.Do("AUTH", opts.Pass); err != nil {
+					c.Close()
+					logger.Errorf("redis %s auth fail:%v", addr, err)
+					return nil, err
+				}
+			}
+
+			if check != nil {
+				if err := check(c); err != nil {
+					c.Close()
+					return nil, err
+				}
+			}
+
+			return c, nil
+		},
+		TestOnBorrow: PingRedis,
+	}
+}
+
+func dial(addr string, opts Options) (redis.Conn, error) {
+	return redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(opts.ConnTimeout),
+		redis.DialReadTimeout(opts.ReadTimeout),
+		redis.DialWriteTimeout(opts.WriteTimeout))
+}
+
+func PingRedis(c redis.Conn, t time.Time) error {
+	_, err := c.Do("PING")
+	if err != nil {
+		logger.Errorf("ping redis fail: %v", err)
+	}
+	return err
+}
+
+func doOn(pool *redis.Pool, cmd string, args ...interface{}) (interface{}, error) {
+	rc := pool.Get()
+	defer rc.Close()
+	return rc.Do(cmd, args...)
+}
+
+func brpopArgs(timeout int, keys []string) []interface{} {
+	args := make([]interface{}, 0, len(keys)+1)
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	return append(args, timeout)
+}
+
+func parseBRPop(reply interface{}, err error) (string, string, error) {
+	kv, err := redis.Strings(reply, err)
+	if err != nil {
+		return "", "", err
+	}
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("unexpected brpop reply: %v", kv)
+	}
+	return kv[0], kv[1], nil
+}
+
+// redis返回的错误说明连接是好的，换节点重试没有意义
+func isServerError(err error) bool {
+	_, ok := err.(redis.Error)
+	return ok
+}
+
+// sentinel切换之后旧master变成slave，写操作会返回READONLY
+func isReadonly(err error) bool {
+	e, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(string(e), "READONLY")
+}
+
+func hostPort(host string, port interface{}) string {
+	return net.JoinHostPort(host, fmt.Sprint(port))
+}
@@ -0,0 +1,158 @@
+package redispool
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func testOptions(mode string, addrs ...string) Options {
+	return Options{
+		Mode:         mode,
+		Addrs:        addrs,
+		MasterName:   "mymaster",
+		Idle:         2,
+		ConnTimeout:  500 * time.Millisecond,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+}
+
+func deadAddr() string {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func (f *fakeRedis) list(key string) []string {
+	f.Lock()
+	defer f.Unlock()
+	return f.lists[key]
+}
+
+func TestKeySlot(t *testing.T) {
+	if crc16("123456789") != 0x31C3 {
+		t.Fatalf("crc16 mismatch: %x", crc16("123456789"))
+	}
+	if keySlot("foo") != 12182 {
+		t.Fatalf("slot of foo should be 12182, got %d", keySlot("foo"))
+	}
+	if keySlot("{user1000}.following") != keySlot("{user1000}.followers") {
+		t.Fatalf("keys with the same hashtag should be in the same slot")
+	}
+}
+
+func TestStandaloneFailover(t *testing.T) {
+	f := newFakeRedis()
+	defer f.Close()
+
+	c, err := New(testOptions(ModeStandalone, deadAddr(), f.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("RPUSH", "/n9e/event/p1", "e1"); err != nil {
+		t.Fatal(err)
+	}
+	key, val, err := c.BRPop(1, "/n9e/event/p1", "/n9e/event/p2")
+	if err != nil || key != "/n9e/event/p1" || val != "e1" {
+		t.Fatalf("unexpected brpop: %s %s %v", key, val, err)
+	}
+}
+
+func TestSentinelFailover(t *testing.T) {
+	m1, m2, s := newFakeRedis(), newFakeRedis(), newFakeRedis()
+	defer m1.Close()
+	defer m2.Close()
+	defer s.Close()
+
+	host, port, _ := net.SplitHostPort(m1.Addr())
+	s.master = [2]string{host, port}
+
+	c, err := New(testOptions(ModeSentinel, deadAddr(), s.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("RPUSH", "q", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if l := m1.list("q"); len(l) != 1 {
+		t.Fatalf("event should be pushed to m1, got %v", l)
+	}
+
+	// 切换master，m1变成只读的slave
+	host, port, _ = net.SplitHostPort(m2.Addr())
+	s.Lock()
+	s.master = [2]string{host, port}
+	s.Unlock()
+	m1.Lock()
+	m1.role = "slave"
+	m1.Unlock()
+
+	if _, err := c.Do("RPUSH", "q", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if l := m2.list("q"); len(l) != 1 || l[0] != "b" {
+		t.Fatalf("event should be pushed to m2 after failover, got %v", l)
+	}
+}
+
+func TestClusterRedirect(t *testing.T) {
+	a, b := newFakeRedis(), newFakeRedis()
+	defer a.Close()
+	defer b.Close()
+
+	// 两个节点各负责一半的slot，但是CLUSTER SLOTS返回的是过期的分布
+	a.owned = func(slot int) bool { return slot < 8192 }
+	a.moveTo = b.Addr()
+	b.owned = func(slot int) bool { return slot >= 8192 }
+	b.moveTo = a.Addr()
+	a.slots = []interface{}{slotsItem(0, clusterSlots-1, a.Addr())}
+	b.slots = a.slots
+
+	var low, high string
+	for i := 0; low == "" || high == ""; i++ {
+		key := fmt.Sprintf("/n9e/event/p%d", i)
+		if keySlot(key) < 8192 {
+			low = key
+		} else {
+			high = key
+		}
+	}
+
+	c, err := New(testOptions(ModeCluster, a.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("RPUSH", high, "h"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("RPUSH", low, "l"); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.list(high)) != 1 || len(a.list(low)) != 1 {
+		t.Fatalf("keys should be routed by slot, a:%v b:%v", a.list(low), b.list(high))
+	}
+
+	// 不同slot的队列按照参数顺序消费
+	key, val, err := c.BRPop(1, high, low)
+	if err != nil || key != high || val != "h" {
+		t.Fatalf("unexpected brpop: %s %s %v", key, val, err)
+	}
+	key, val, err = c.BRPop(1, high, low)
+	if err != nil || key != low || val != "l" {
+		t.Fatalf("unexpected brpop: %s %s %v", key, val, err)
+	}
+	if _, _, err = c.BRPop(1, high, low); err != redis.ErrNil {
+		t.Fatalf("empty queues should return ErrNil, got %v", err)
+	}
+}
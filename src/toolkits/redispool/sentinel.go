@@ -0,0 +1,130 @@
+package redispool
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/toolkits/pkg/logger"
+)
+
+// sentinelClient 通过sentinel发现master，连接出错或者master变成只读之后重新发现
+type sentinelClient struct {
+	sync.RWMutex
+	opts   Options
+	master string
+	pool   *redis.Pool
+}
+
+func newSentinel(opts Options) *sentinelClient {
+	c := &sentinelClient{opts: opts}
+	if _, err := c.refresh(); err != nil {
+		logger.Errorf("discover redis master %s err:%v", opts.MasterName, err)
+	}
+	return c
+}
+
+// discover 依次询问每个sentinel，返回第一个拿到的master地址
+func (c *sentinelClient) discover() (string, error) {
+	var err error
+	for _, addr := range c.opts.Addrs {
+		var conn redis.Conn
+		conn, err = dial(addr, c.opts)
+		if err != nil {
+			continue
+		}
+
+		var hp []string
+		hp, err = redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", c.opts.MasterName))
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		if len(hp) != 2 {
+			err = fmt.Errorf("sentinel %s returns illegal master addr: %v", addr, hp)
+			continue
+		}
+		return hostPort(hp[0], hp[1]), nil
+	}
+	return "", fmt.Errorf("no sentinel available, last err:%v", err)
+}
+
+// refresh 重新发现master，master变化时替换连接池，返回master是否变化
+func (c *sentinelClient) refresh() (bool, error) {
+	addr, err := c.discover()
+	if err != nil {
+		return false, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if addr == c.master {
+		return false, nil
+	}
+
+	logger.Warningf("redis master %s switch from %s to %s", c.opts.MasterName, c.master, addr)
+	old := c.pool
+	c.master = addr
+	c.pool = newPool(addr, c.opts, checkMaster)
+	if old != nil {
+		old.Close()
+	}
+	return true, nil
+}
+
+func (c *sentinelClient) getPool() *redis.Pool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.pool
+}
+
+func (c *sentinelClient) Do(cmd string, args ...interface{}) (interface{}, error) {
+	pool := c.getPool()
+	if pool == nil {
+		if _, err := c.refresh(); err != nil {
+			return nil, err
+		}
+		pool = c.getPool()
+	}
+
+	reply, err := doOn(pool, cmd, args...)
+	if err == nil || (isServerError(err) && !isReadonly(err)) {
+		return reply, err
+	}
+
+	changed, rerr := c.refresh()
+	if rerr != nil {
+		logger.Errorf("rediscover redis master %s err:%v", c.opts.MasterName, rerr)
+		return reply, err
+	}
+	if !changed {
+		return reply, err
+	}
+	return doOn(c.getPool(), cmd, args...)
+}
+
+func (c *sentinelClient) BRPop(timeout int, keys ...string) (string, string, error) {
+	return parseBRPop(c.Do("BRPOP", brpopArgs(timeout, keys)...))
+}
+
+func (c *sentinelClient) Close() error {
+	if pool := c.getPool(); pool != nil {
+		return pool.Close()
+	}
+	return nil
+}
+
+// 新建连接时确认对方还是master，避免sentinel还没有切换完成时连到旧master
+func checkMaster(c redis.Conn) error {
+	role, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(role) == 0 {
+		return fmt.Errorf("empty role reply")
+	}
+	if r, _ := redis.String(role[0], nil); r != "master" {
+		return fmt.Errorf("redis role is %s, not master", r)
+	}
+	return nil
+}
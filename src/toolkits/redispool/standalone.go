@@ -0,0 +1,39 @@
+package redispool
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// standaloneClient 按顺序使用配置的地址，连接失败时换下一个
+type standaloneClient struct {
+	pools []*redis.Pool
+}
+
+func newStandalone(opts Options) *standaloneClient {
+	c := &standaloneClient{}
+	for _, addr := range opts.Addrs {
+		c.pools = append(c.pools, newPool(addr, opts, nil))
+	}
+	return c
+}
+
+func (c *standaloneClient) Do(cmd string, args ...interface{}) (reply interface{}, err error) {
+	for _, pool := range c.pools {
+		reply, err = doOn(pool, cmd, args...)
+		if err == nil || isServerError(err) {
+			return
+		}
+	}
+	return
+}
+
+func (c *standaloneClient) BRPop(timeout int, keys ...string) (string, string, error) {
+	return parseBRPop(c.Do("BRPOP", brpopArgs(timeout, keys)...))
+}
+
+func (c *standaloneClient) Close() error {
+	for _, pool := range c.pools {
+		pool.Close()
+	}
+	return nil
+}
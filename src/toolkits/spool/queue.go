@@ -0,0 +1,181 @@
+package spool
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/toolkits/pkg/container/list"
+)
+
+// Queue 内存队列加上可选的磁盘spool
+// 内存队列满了或者发送失败之后进入spill状态，之后的数据都写入spool，保证回放的顺序
+// spool中的数据全部发送成功之后恢复使用内存队列
+type Queue struct {
+	sync.Mutex
+	mem      *list.SafeListLimited
+	spool    *Spool
+	decode   func([]byte) (interface{}, error)
+	spilling bool
+}
+
+// NewQueue sp为nil时和list.SafeListLimited的行为一致，队列满了之后丢弃数据
+func NewQueue(maxSize int, sp *Spool, decode func([]byte) (interface{}, error)) *Queue {
+	q := &Queue{
+		mem:    list.NewSafeListLimited(maxSize),
+		spool:  sp,
+		decode: decode,
+	}
+	if sp != nil && sp.Len() > 0 {
+		q.spilling = true
+	}
+	return q
+}
+
+// PushFront 返回false表示数据被丢弃
+func (q *Queue) PushFront(item interface{}) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.spool == nil {
+		return q.mem.PushFront(item)
+	}
+
+	if !q.spilling {
+		if q.mem.PushFront(item) {
+			return true
+		}
+		// 内存队列满了，先把内存中的数据写入spool，spool中的顺序和进入队列的顺序保持一致
+		q.spilling = true
+		q.spillMem()
+	}
+
+	return q.put(item) == nil
+}
+
+func (q *Queue) put(item interface{}) error {
+	bs, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return q.spool.Put(bs)
+}
+
+func (q *Queue) PopBackBy(max int) []interface{} {
+	return q.mem.PopBackBy(max)
+}
+
+// Spill 发送失败的数据写入spool，内存队列中剩余的数据也一起写入，保持先后顺序
+// 返回写入失败被丢弃的个数
+func (q *Queue) Spill(items []interface{}) int {
+	if q.spool == nil {
+		return len(items)
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	q.spilling = true
+	dropped := 0
+	for _, item := range items {
+		if q.put(item) != nil {
+			dropped++
+		}
+	}
+	return dropped + q.spillMem()
+}
+
+// spillMem 内存队列中的数据按照先后顺序写入spool，返回写入失败的个数
+func (q *Queue) spillMem() int {
+	dropped := 0
+	for {
+		rest := q.mem.PopBackBy(1024)
+		if len(rest) == 0 {
+			return dropped
+		}
+		for _, item := range rest {
+			if q.put(item) != nil {
+				dropped++
+			}
+		}
+	}
+}
+
+// Peek 从spool中按顺序读取最多max条数据，处理成功之后调用Ack
+// 无法解析的数据直接跳过
+func (q *Queue) Peek(max int) ([]interface{}, error) {
+	if q.spool == nil {
+		return nil, nil
+	}
+
+	records, err := q.spool.Peek(max)
+	items := make([]interface{}, 0, len(records))
+	for _, rec := range records {
+		item, err := q.decode(rec.Data)
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, err
+}
+
+func (q *Queue) Ack() error {
+	if q.spool == nil {
+		return nil
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	err := q.spool.Ack()
+	if q.spool.Len() == 0 {
+		q.spilling = false
+	}
+	return err
+}
+
+func (q *Queue) Len() int {
+	return q.mem.Len()
+}
+
+// SpoolLen spool中还没有发送的数据个数
+func (q *Queue) SpoolLen() int64 {
+	if q.spool == nil {
+		return 0
+	}
+	return q.spool.Len()
+}
+
+// SpoolAge spool中最早的数据等待的时间，单位秒
+func (q *Queue) SpoolAge(now int64) int64 {
+	if q.spool == nil {
+		return 0
+	}
+
+	ts := q.spool.OldestTs()
+	if ts == 0 {
+		return 0
+	}
+	return now - ts
+}
+
+func (q *Queue) SpoolSize() int64 {
+	if q.spool == nil {
+		return 0
+	}
+	return q.spool.Size()
+}
+
+func (q *Queue) Sync() error {
+	if q.spool == nil {
+		return nil
+	}
+	return q.spool.Sync()
+}
+
+func (q *Queue) Close() error {
+	if q.spool == nil {
+		return nil
+	}
+	return q.spool.Close()
+}
@@ -0,0 +1,477 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// 每条记录的格式：len(4) crc32(4) ts(8) data(len)，crc32覆盖ts和data
+const headerSize = 16
+
+const (
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+)
+
+var (
+	ErrFull    = errors.New("spool is full")
+	errEnd     = errors.New("end of spool")
+	errCorrupt = errors.New("corrupt record")
+)
+
+type Options struct {
+	SegmentSize int64 // 单个segment文件的大小，超过之后切换到新文件
+	MaxSize     int64 // 所有segment的总大小，超过之后Put返回ErrFull，0表示不限制
+}
+
+type Record struct {
+	Ts   int64
+	Data []byte
+}
+
+// Spool 磁盘上的先进先出队列，数据按顺序写入segment文件
+// 读取的位置记录在cursor文件中，Ack之后才会前进，进程重启之后从cursor继续读取
+// 只支持一个读取者
+type Spool struct {
+	sync.Mutex
+	dir  string
+	opts Options
+
+	segs  []int64
+	sizes map[int64]int64
+	size  int64
+	count int64
+
+	w     *os.File
+	wid   int64
+	wsize int64
+
+	readers map[int64]*os.File
+	rid     int64
+	roff    int64
+
+	peeked     bool
+	pendingId  int64
+	pendingOff int64
+	pendingN   int
+}
+
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 * 1024 * 1024
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:     dir,
+		opts:    opts,
+		sizes:   make(map[int64]int64),
+		readers: make(map[int64]*os.File),
+	}
+
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segs = append(s.segs, id)
+		s.sizes[id] = f.Size()
+	}
+	sort.Slice(s.segs, func(i, j int) bool { return s.segs[i] < s.segs[j] })
+
+	if len(s.segs) == 0 {
+		s.segs = []int64{1}
+		s.sizes[1] = 0
+	}
+
+	s.rid, s.roff = s.segs[0], 0
+	if bs, err := ioutil.ReadFile(filepath.Join(s.dir, cursorFile)); err == nil {
+		var id, off int64
+		if _, err := fmt.Sscanf(string(bs), "%d %d", &id, &off); err == nil && id >= s.segs[0] {
+			s.rid, s.roff = id, off
+		}
+	}
+	s.removeBefore(s.rid)
+	if len(s.segs) == 0 {
+		// cursor指向的segment已经不存在
+		s.segs = []int64{s.rid}
+		s.sizes[s.rid] = 0
+		s.roff = 0
+	}
+	if s.segs[0] != s.rid {
+		s.rid, s.roff = s.segs[0], 0
+	}
+
+	// 进程崩溃时最后一个segment可能只写了半条记录，截断到最后一条完整的记录
+	s.wid = s.segs[len(s.segs)-1]
+	s.w, err = os.OpenFile(s.segPath(s.wid), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	valid, err := s.validSize(s.wid)
+	if err != nil {
+		return err
+	}
+	if valid != s.sizes[s.wid] {
+		logger.Warningf("spool %s truncate segment %d from %d to %d", s.dir, s.wid, s.sizes[s.wid], valid)
+		if err := s.w.Truncate(valid); err != nil {
+			return err
+		}
+	}
+	if _, err := s.w.Seek(valid, io.SeekStart); err != nil {
+		return err
+	}
+	s.wsize = valid
+	s.sizes[s.wid] = valid
+	if s.rid == s.wid && s.roff > valid {
+		s.roff = valid
+	}
+
+	for _, id := range s.segs {
+		s.size += s.sizes[id]
+	}
+	s.count = s.countFrom(s.rid, s.roff)
+	return nil
+}
+
+func (s *Spool) segPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", id, segmentSuffix))
+}
+
+func (s *Spool) validSize(id int64) (int64, error) {
+	var off int64
+	for {
+		_, n, err := s.readRecord(id, off)
+		if err != nil {
+			return off, nil
+		}
+		off += n
+	}
+}
+
+func (s *Spool) countFrom(id, off int64) int64 {
+	var count int64
+	for {
+		_, nid, noff, err := s.next(id, off)
+		if err != nil {
+			return count
+		}
+		count++
+		id, off = nid, noff
+	}
+}
+
+// Put 追加一条记录
+func (s *Spool) Put(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	n := int64(headerSize + len(data))
+	if s.opts.MaxSize > 0 && s.size+n > s.opts.MaxSize {
+		return ErrFull
+	}
+
+	if s.wsize > 0 && s.wsize+n > s.opts.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, n)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(time.Now().Unix()))
+	copy(buf[headerSize:], data)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+
+	if _, err := s.w.Write(buf); err != nil {
+		return err
+	}
+
+	s.wsize += n
+	s.sizes[s.wid] = s.wsize
+	s.size += n
+	s.count++
+	return nil
+}
+
+func (s *Spool) rotate() error {
+	if err := s.w.Sync(); err != nil {
+		return err
+	}
+	s.w.Close()
+
+	id := s.wid + 1
+	w, err := os.OpenFile(s.segPath(id), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.w, s.wid, s.wsize = w, id, 0
+	s.segs = append(s.segs, id)
+	s.sizes[id] = 0
+	return nil
+}
+
+// Peek 从读取位置开始最多返回n条记录，不移动读取位置，Ack之后才算消费
+// 重复调用Peek会返回相同的记录
+func (s *Spool) Peek(n int) ([]Record, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	records := []Record{}
+	id, off := s.rid, s.roff
+	for len(records) < n {
+		rec, nid, noff, err := s.next(id, off)
+		if err == errEnd {
+			break
+		}
+		if err == errCorrupt {
+			// 跳过损坏的segment剩余的部分，重新计算记录个数
+			nid, err = s.skipSegment(id)
+			if err != nil {
+				return records, err
+			}
+			logger.Errorf("spool %s segment %d corrupt at %d, skip", s.dir, id, off)
+			id, off = nid, 0
+			s.count = int64(len(records)) + s.countFrom(id, off)
+			continue
+		}
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, rec)
+		id, off = nid, noff
+	}
+
+	s.peeked = true
+	s.pendingId, s.pendingOff, s.pendingN = id, off, len(records)
+	return records, nil
+}
+
+// Ack 确认上一次Peek返回的记录已经处理完成
+func (s *Spool) Ack() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.peeked {
+		return nil
+	}
+
+	s.rid, s.roff = s.pendingId, s.pendingOff
+	s.count -= int64(s.pendingN)
+	if s.count < 0 {
+		s.count = 0
+	}
+	s.peeked = false
+	s.pendingN = 0
+
+	s.removeBefore(s.rid)
+	return s.saveCursor()
+}
+
+func (s *Spool) saveCursor() error {
+	tmp := filepath.Join(s.dir, cursorFile+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", s.rid, s.roff)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, cursorFile))
+}
+
+// 删除已经读完的segment
+func (s *Spool) removeBefore(id int64) {
+	i := 0
+	for ; i < len(s.segs) && s.segs[i] < id; i++ {
+		sid := s.segs[i]
+		if r, exists := s.readers[sid]; exists {
+			r.Close()
+			delete(s.readers, sid)
+		}
+		if err := os.Remove(s.segPath(sid)); err != nil && !os.IsNotExist(err) {
+			logger.Warningf("spool %s remove segment %d err:%v", s.dir, sid, err)
+		}
+		s.size -= s.sizes[sid]
+		delete(s.sizes, sid)
+	}
+	s.segs = s.segs[i:]
+}
+
+func (s *Spool) skipSegment(id int64) (int64, error) {
+	if id == s.wid {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	for _, sid := range s.segs {
+		if sid > id {
+			return sid, nil
+		}
+	}
+	return s.wid, nil
+}
+
+// next 读取(id, off)位置的记录，当前segment读完之后切换到下一个segment
+func (s *Spool) next(id, off int64) (Record, int64, int64, error) {
+	for {
+		rec, n, err := s.readRecord(id, off)
+		if err == nil {
+			return rec, id, off + n, nil
+		}
+		if err != io.EOF {
+			return rec, id, off, err
+		}
+
+		if id >= s.wid {
+			return rec, id, off, errEnd
+		}
+		// 切换到下一个segment
+		nid := id
+		for _, sid := range s.segs {
+			if sid > id {
+				nid = sid
+				break
+			}
+		}
+		if nid == id {
+			return rec, id, off, errEnd
+		}
+		id, off = nid, 0
+	}
+}
+
+// readRecord segment正好读完时返回io.EOF
+func (s *Spool) readRecord(id, off int64) (Record, int64, error) {
+	var rec Record
+
+	size := s.sizes[id]
+	if off >= size {
+		return rec, 0, io.EOF
+	}
+	if off+headerSize > size {
+		return rec, 0, errCorrupt
+	}
+
+	r, err := s.reader(id)
+	if err != nil {
+		return rec, 0, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, off); err != nil {
+		return rec, 0, errCorrupt
+	}
+
+	n := int64(binary.BigEndian.Uint32(header[0:4]))
+	if off+headerSize+n > size {
+		return rec, 0, errCorrupt
+	}
+
+	buf := make([]byte, 8+n)
+	copy(buf, header[8:16])
+	if _, err := r.ReadAt(buf[8:], off+headerSize); err != nil {
+		return rec, 0, errCorrupt
+	}
+	if crc32.ChecksumIEEE(buf) != binary.BigEndian.Uint32(header[4:8]) {
+		return rec, 0, errCorrupt
+	}
+
+	rec.Ts = int64(binary.BigEndian.Uint64(header[8:16]))
+	rec.Data = buf[8:]
+	return rec, headerSize + n, nil
+}
+
+func (s *Spool) reader(id int64) (*os.File, error) {
+	if r, exists := s.readers[id]; exists {
+		return r, nil
+	}
+
+	r, err := os.Open(s.segPath(id))
+	if err != nil {
+		return nil, err
+	}
+	s.readers[id] = r
+	return r, nil
+}
+
+// Len 还没有Ack的记录个数
+func (s *Spool) Len() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.count
+}
+
+// Size 所有segment文件的大小
+func (s *Spool) Size() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.size
+}
+
+// OldestTs 最早的一条没有Ack的记录写入的时间，没有记录时返回0
+func (s *Spool) OldestTs() int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, _, _, err := s.next(s.rid, s.roff)
+	if err != nil {
+		return 0
+	}
+	return rec.Ts
+}
+
+// Sync 把写入的数据刷到磁盘
+func (s *Spool) Sync() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Sync()
+}
+
+func (s *Spool) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, r := range s.readers {
+		r.Close()
+		delete(s.readers, id)
+	}
+
+	if s.w == nil {
+		return nil
+	}
+	s.w.Sync()
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
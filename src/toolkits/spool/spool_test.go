@@ -0,0 +1,142 @@
+package spool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func peekAll(t *testing.T, s *Spool) []string {
+	records, err := s.Peek(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := make([]string, 0, len(records))
+	for _, rec := range records {
+		ret = append(ret, string(rec.Data))
+	}
+	return ret
+}
+
+func TestSpoolReplayInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// segment很小，每个segment只能放下两条记录
+	opts := Options{SegmentSize: 2 * (headerSize + 6)}
+	s, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := s.Put([]byte(fmt.Sprintf("item-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Len() != 5 || s.OldestTs() == 0 {
+		t.Fatalf("unexpected len %d ts %d", s.Len(), s.OldestTs())
+	}
+
+	records, err := s.Peek(3)
+	if err != nil || len(records) != 3 || string(records[2].Data) != "item-2" {
+		t.Fatalf("unexpected peek %v err:%v", records, err)
+	}
+	if err := s.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读完的segment被删除
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segs) != 2 {
+		t.Fatalf("expect 2 segments left, got %v", segs)
+	}
+
+	// Peek之后没有Ack，重启之后依然能读到
+	s.Peek(1)
+	s.Close()
+
+	s, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := peekAll(t, s); fmt.Sprint(got) != "[item-3 item-4]" || s.Len() != 2 {
+		t.Fatalf("unexpected records after reopen: %v len %d", got, s.Len())
+	}
+	s.Ack()
+	if s.Len() != 0 || s.OldestTs() != 0 {
+		t.Fatalf("expect empty spool, got len %d", s.Len())
+	}
+	s.Close()
+}
+
+func TestSpoolCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{SegmentSize: 2 * (headerSize + 6)}
+	s, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		s.Put([]byte(fmt.Sprintf("item-%d", i)))
+	}
+	s.Close()
+
+	// 第一个segment中的第二条记录损坏，最后一个segment只写了半条记录
+	first := filepath.Join(dir, fmt.Sprintf("%016d%s", 1, segmentSuffix))
+	bs, _ := ioutil.ReadFile(first)
+	bs[len(bs)-1] ^= 0xff
+	ioutil.WriteFile(first, bs, 0644)
+
+	last := filepath.Join(dir, fmt.Sprintf("%016d%s", 2, segmentSuffix))
+	f, _ := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0, 0, 0, 6, 1, 2})
+	f.Close()
+
+	s, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if got := peekAll(t, s); fmt.Sprint(got) != "[item-0 item-2 item-3]" {
+		t.Fatalf("unexpected records: %v", got)
+	}
+	s.Ack()
+
+	s.Put([]byte("item-4"))
+	if got := peekAll(t, s); fmt.Sprint(got) != "[item-4]" || s.Len() != 1 {
+		t.Fatalf("unexpected records after truncate: %v len %d", got, s.Len())
+	}
+}
+
+func TestSpoolFull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, Options{MaxSize: headerSize + 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Put([]byte("item-0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put([]byte("item-1")); err != ErrFull {
+		t.Fatalf("expect ErrFull, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package stats
+
+import "sync"
+
+// GaugeMetric 和CounterMetric不同，Set覆盖之前的值，Dump之后不清零
+type GaugeMetric struct {
+	sync.RWMutex
+	prefix  string
+	metrics map[string]int
+}
+
+var Gauge *GaugeMetric
+
+func NewGauge(prefix string) *GaugeMetric {
+	return &GaugeMetric{
+		metrics: make(map[string]int),
+		prefix:  prefix,
+	}
+}
+
+func (g *GaugeMetric) Set(metric string, value int) {
+	g.Lock()
+	defer g.Unlock()
+	g.metrics[metric] = value
+}
+
+func (g *GaugeMetric) Dump() map[string]int {
+	g.RLock()
+	defer g.RUnlock()
+	metrics := make(map[string]int)
+	for key, value := range g.metrics {
+		metrics[g.prefix+"."+key] = value
+	}
+
+	return metrics
+}
@@ -22,6 +22,7 @@ func Init(prefix string, addr ...string) {
 	}
 
 	Counter = NewCounter(prefix)
+	Gauge = NewGauge(prefix)
 	go Push()
 }
 
@@ -35,6 +36,10 @@ func Push() {
 			items = append(items, NewMetricValue(metric, int64(value)))
 		}
 
+		for metric, value := range Gauge.Dump() {
+			items = append(items, NewMetricValue(metric, int64(value)))
+		}
+
 		push(items)
 	}
 }
@@ -141,6 +141,8 @@ class Detail extends Component<RouteComponentProps> {
       points.push({
         metric: item.metric,
         points: item.points,
+        predPoints: item.pred_points,
+        comparison: item.comparison,
       });
     });
 
@@ -242,7 +244,7 @@ class Detail extends Component<RouteComponentProps> {
                 _.map(points, (item) => {
                   return (
                     <div>
-                      <div className="label">现场值：</div>
+                      <div className="label">{item.comparison ? `同比值(${item.comparison / 86400}天前)：` : '现场值：'}</div>
                       {item.metric}
                       <Table
                         style={{
@@ -267,6 +269,35 @@ class Detail extends Component<RouteComponentProps> {
                         ]}
                         pagination={false}
                       />
+                      {
+                        !_.isEmpty(item.predPoints) ?
+                          <div>
+                            <div className="label">预测值：</div>
+                            <Table
+                              style={{
+                                display: 'block',
+                                marginLeft: 80,
+                              }}
+                              size="small"
+                              rowKey="timestamp"
+                              dataSource={item.predPoints}
+                              columns={[
+                                {
+                                  title: '时间',
+                                  dataIndex: 'timestamp',
+                                  width: 200,
+                                  render(text) {
+                                    return <span>{moment.unix(text).format('YYYY-MM-DD HH:mm:ss')}</span>;
+                                  },
+                                }, {
+                                  title: '数值',
+                                  dataIndex: 'value',
+                                },
+                              ]}
+                              pagination={false}
+                            />
+                          </div> : null
+                      }
                     </div>
                   );
                 })
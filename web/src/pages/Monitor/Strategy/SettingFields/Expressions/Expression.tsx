@@ -1,5 +1,5 @@
 import React, { Component } from 'react';
-import { Card, Select, InputNumber } from 'antd';
+import { Card, Select, InputNumber, Input, Icon } from 'antd';
 import _ from 'lodash';
 import { funcMap, defaultExpressionValue, commonPropDefaultValue } from './config';
 
@@ -83,6 +83,92 @@ export default class Expression extends Component<Props> {
     });
   }
 
+  handleOverrideChange = (index: number, key: string, val: any) => {
+    const { value, onChange } = this.props;
+    const overrides = _.cloneDeep(value.overrides || []);
+
+    overrides[index][key] = val;
+    onChange({
+      ...value,
+      overrides,
+    });
+  }
+
+  handleOverrideAdd = () => {
+    const { value, onChange } = this.props;
+
+    onChange({
+      ...value,
+      overrides: [...(value.overrides || []), { tags: '', threshold: value.threshold }],
+    });
+  }
+
+  handleOverrideRemove = (index: number) => {
+    const { value, onChange } = this.props;
+    const overrides = _.cloneDeep(value.overrides || []);
+
+    overrides.splice(index, 1);
+    onChange({
+      ...value,
+      overrides,
+    });
+  }
+
+  renderOverridesPreview() {
+    const { value } = this.props;
+    const { eopt, overrides = [] } = value;
+
+    if (value.func === 'nodata' || _.isEmpty(overrides)) return null;
+    return (
+      <div>
+        {
+          _.map(overrides, (o, i: number) => {
+            return (
+              <div key={i} style={{ color: '#999' }}>
+                {o.tags} 时 v 为 <strong style={{ color: '#FF6F27' }}>{eopt} {o.threshold}</strong>
+              </div>
+            );
+          })
+        }
+      </div>
+    );
+  }
+
+  renderOverrides() {
+    const { value } = this.props;
+    const { overrides = [] } = value;
+
+    if (value.func === 'nodata' || value.func === 'canary') return null;
+    return (
+      <div style={{ marginTop: 5 }}>
+        {
+          _.map(overrides, (o, i: number) => {
+            return (
+              <div key={i} style={{ marginTop: 5 }}>
+                <Input
+                  style={{ width: 250 }}
+                  placeholder="标签，例如 mount=/data"
+                  value={o.tags}
+                  onChange={(e) => { this.handleOverrideChange(i, 'tags', e.target.value); }}
+                />
+                <span style={{ color: '#FF6F27', marginLeft: 10 }}>v</span>
+                <span style={{ marginRight: 8, marginLeft: 2 }}>:</span>
+                <InputNumber
+                  size="default"
+                  step={0.01}
+                  value={o.threshold}
+                  onChange={(newVal) => { this.handleOverrideChange(i, 'threshold', newVal === undefined ? value.threshold : newVal); }}
+                />
+                <Icon type="minus-circle-o" style={{ marginLeft: 10, cursor: 'pointer' }} onClick={() => { this.handleOverrideRemove(i); }} />
+              </div>
+            );
+          })
+        }
+        <a style={{ display: 'inline-block', marginTop: 5 }} onClick={this.handleOverrideAdd}>按标签覆盖阈值</a>
+      </div>
+    );
+  }
+
   renderPreview(readOnly?: boolean) {
     const { value, alertDuration } = this.props;
     const { metric, func, eopt, threshold } = value;
@@ -155,6 +241,7 @@ export default class Expression extends Component<Props> {
         { !readOnly && <span style={{ color: '#999' }}>预览：</span> }
         <span style={{ paddingRight: 5 }}>{metric || '${metric}' }</span>
         { previewNode }
+        { this.renderOverridesPreview() }
       </div>
     );
   }
@@ -192,6 +279,18 @@ export default class Expression extends Component<Props> {
         />
       );
     }
+    if (func === 'predict_linear') {
+      // 预测多少秒之后的值
+      return (
+        <InputNumber
+          key={i}
+          value={val}
+          min={1}
+          style={{ display: 'inline-block' }}
+          onChange={(newVal) => { this.handleParamsChange(i, newVal); }}
+        />
+      );
+    }
     return <span>不是合法的 param</span>;
   }
 
@@ -303,6 +402,7 @@ export default class Expression extends Component<Props> {
             </Select>
           </div>
           {this.renderParams()}
+          {this.renderOverrides()}
         </div>
         {
           value.func !== 'canary' ? this.renderPreview() : null
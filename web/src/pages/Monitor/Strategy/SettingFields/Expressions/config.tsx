@@ -55,6 +55,54 @@ export const funcMap: { [index: string]: any } = {
     params: [],
     defaultValue: [],
   },
+  stddev: {
+    label: '标准差',
+    meaning: '持续 n 秒标准差 v',
+    params: [],
+    defaultValue: [],
+  },
+  zscore: {
+    label: '偏离度',
+    meaning: '最新值偏离 n 秒内均值的标准差倍数 (区分正负) v',
+    params: [],
+    defaultValue: [],
+  },
+  p50: {
+    label: '50分位值',
+    meaning: '持续 n 秒50分位值 v',
+    params: [],
+    defaultValue: [],
+  },
+  p90: {
+    label: '90分位值',
+    meaning: '持续 n 秒90分位值 v',
+    params: [],
+    defaultValue: [],
+  },
+  p99: {
+    label: '99分位值',
+    meaning: '持续 n 秒99分位值 v',
+    params: [],
+    defaultValue: [],
+  },
+  dod_pdiff: {
+    label: '日同比变化率',
+    meaning: '持续 n 秒均值与1天前同一时段均值相比的变化率 (区分正负) v ％',
+    params: [],
+    defaultValue: [],
+  },
+  wow_pdiff: {
+    label: '周同比变化率',
+    meaning: '持续 n 秒均值与7天前同一时段均值相比的变化率 (区分正负) v ％',
+    params: [],
+    defaultValue: [],
+  },
+  predict_linear: {
+    label: '线性预测',
+    meaning: '根据 n 秒内的数据预测 m 秒后的值 v',
+    params: ['m'],
+    defaultValue: [14400],
+  },
 };
 
 export const defaultExpressionValue = {
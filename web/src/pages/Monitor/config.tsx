@@ -32,6 +32,11 @@ export const eventTypeOptions = [
     label: '恢复',
     status: 'success',
     color: '#52c41a',
+  }, {
+    value: 'flapping',
+    label: '抖动',
+    status: 'warning',
+    color: '#faad14',
   },
 ];
 